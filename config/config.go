@@ -0,0 +1,199 @@
+// Package config loads configuration from layered sources, e.g. defaults, files,
+// environment variables and command line flags, into a single gostree.STree.
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/oldenbur/gostree"
+)
+
+// Provenance identifies the source which supplied a value, and the position of
+// the value within it, which is the zero Pos if the source records none.
+type Provenance struct {
+	Source string
+	Pos    gostree.Pos
+}
+
+// String returns the provenance as the source name, followed by the position if
+// known, e.g. config.yaml:42:7.
+func (p Provenance) String() string {
+	if p.Pos.Line < 1 {
+		return p.Source
+	}
+	return fmt.Sprintf("%s:%s", p.Source, p.Pos)
+}
+
+// Loader merges the values of its sources, each overriding those before it.
+type Loader struct {
+	sources []Source
+}
+
+// NewLoader returns a Loader of the specified sources in increasing priority,
+// e.g. Defaults, then File sources, then Env and finally Flags.
+func NewLoader(sources ...Source) *Loader {
+	return &Loader{sources: sources}
+}
+
+// Add appends sources of higher priority than those already added.
+func (l *Loader) Add(sources ...Source) *Loader {
+	l.sources = append(l.sources, sources...)
+	return l
+}
+
+// Config is the STree merged by a Loader, along with the provenance of its values.
+type Config struct {
+	gostree.STree
+	provenance map[string]Provenance
+}
+
+// Provenance returns the source of the value at the specified path, which is a
+// leaf, a slice or an empty STree. Slices are supplied whole, so the elements of
+// a slice share its provenance.
+func (c Config) Provenance(path string) (Provenance, bool) {
+	p, err := gostree.ValueOfPath(path)
+	if err != nil {
+		return Provenance{}, false
+	}
+	prov, ok := c.provenance[p.String()]
+	return prov, ok
+}
+
+// Load reads each source in turn and merges its values into the result with
+// SetVal. STrees are merged key by key, while any other value, including a slice,
+// replaces the value at its path. String values supplied by Env, and by string
+// flags, are converted to the type of the value they override if that is a bool
+// or a number, and an error is returned if they do not parse as one.
+func (l *Loader) Load() (Config, error) {
+
+	c := Config{STree: gostree.NewSTree(), provenance: map[string]Provenance{}}
+	for _, src := range l.sources {
+		t, err := load(src)
+		if err != nil {
+			return Config{}, fmt.Errorf("Load error in source %s: %v", src.Name(), err)
+		}
+		_, stringValued := src.(stringSource)
+		m := &merge{c: &c, src: src.Name(), positions: t.Positions, stringValued: stringValued}
+		err = t.Visit(gostree.NewVisitorBuilder().
+			WithPrimitiveVisitor(m.primitive).
+			WithSTreeBeginVisitor(m.stree).
+			WithSliceBeginVisitor(m.sliceBegin).
+			WithSliceEndVisitor(m.sliceEnd).
+			Visitor())
+		if err != nil {
+			return Config{}, fmt.Errorf("Load error merging source %s: %v", src.Name(), err)
+		}
+	}
+	return c, nil
+}
+
+// load returns the values supplied by src, along with their positions if src
+// records them.
+func load(src Source) (gostree.PositionedSTree, error) {
+	if p, ok := src.(positionedSource); ok {
+		return p.loadPositioned()
+	}
+	t, err := src.Load()
+	return gostree.PositionedSTree{STree: t}, err
+}
+
+// merge merges the STree of one source into a Config as it is visited.
+type merge struct {
+	c            *Config
+	src          string
+	positions    gostree.Positions
+	stringValued bool
+	sliceDepth   int
+}
+
+func (m *merge) primitive(path string, val interface{}) error {
+	if m.sliceDepth > 0 {
+		m.record(path)
+		return nil
+	}
+	if s, ok := val.(string); ok && m.stringValued {
+		if cur, err := m.c.Val(path); err == nil {
+			conv, err := convertString(s, cur)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			val = conv
+		}
+	}
+	return m.set(path, val, true)
+}
+
+// stree replaces any value at path which is not an STree with an empty STree,
+// into which the keys of t are merged as they are visited.
+func (m *merge) stree(path string, t gostree.STree) error {
+	if path == "" || m.sliceDepth > 0 {
+		return nil
+	}
+	if _, err := m.c.STreeVal(path); err != nil {
+		return m.set(path, gostree.NewSTree(), len(t) < 1)
+	} else if len(t) < 1 {
+		m.record(path)
+	}
+	return nil
+}
+
+func (m *merge) sliceBegin(path string, s []interface{}) error {
+	m.sliceDepth++
+	if m.sliceDepth > 1 {
+		return nil
+	}
+	return m.set(path, s, true)
+}
+
+func (m *merge) sliceEnd(path string, s []interface{}) error {
+	m.sliceDepth--
+	return nil
+}
+
+// set stores val at path, dropping the provenance of the previous value and of any
+// values beneath it, and recording that of val if record is set.
+func (m *merge) set(path string, val interface{}, record bool) error {
+	t, err := m.c.SetVal(path, val)
+	if err != nil {
+		return err
+	}
+	m.c.STree = t
+	for p := range m.c.provenance {
+		rest := strings.TrimPrefix(p, path)
+		if rest != p && (rest == "" || rest[0] == '.' || rest[0] == '[') {
+			delete(m.c.provenance, p)
+		}
+	}
+	if record {
+		m.record(path)
+	}
+	return nil
+}
+
+func (m *merge) record(path string) {
+	pos, _ := m.positions.Position(path)
+	m.c.provenance[path] = Provenance{Source: m.src, Pos: pos}
+}
+
+// convertString returns s converted to the type of cur if cur is a bool or a
+// number, and s itself otherwise.
+func convertString(s string, cur interface{}) (interface{}, error) {
+	switch reflect.ValueOf(cur).Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		return int(i), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 0, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, 64)
+	}
+	return s, nil
+}
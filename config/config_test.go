@@ -0,0 +1,136 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	"github.com/oldenbur/gostree"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// configureTestLogger configures the global logger to print to console only
+func configureTestLogger() {
+
+	testConfig := `
+        <seelog type="sync" minlevel="debug">
+            <outputs formatid="main"><console/></outputs>
+            <formats><format id="main" format="%Date %Time [%LEVEL] %Msg%n"/></formats>
+        </seelog>`
+
+	logger, err := log.LoggerFromConfigAsBytes([]byte(testConfig))
+	if err != nil {
+		panic(err)
+	}
+
+	err = log.ReplaceLogger(logger)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func init() { configureTestLogger() }
+
+func TestLoader(t *testing.T) {
+
+	defer log.Flush()
+
+	dir, err := ioutil.TempDir("", "gostree-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlPath := filepath.Join(dir, "config.yaml")
+	err = ioutil.WriteFile(yamlPath, []byte(`server:
+  host: example.com
+  port: 8443
+  tags: [web, edge]
+log:
+  level: info
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localPath := filepath.Join(dir, "local.jsonc")
+	err = ioutil.WriteFile(localPath, []byte(`{
+  // developer overrides
+  log: {level: 'debug'},
+  server: {tags: ['dev']},
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := gostree.STree{
+		"server": gostree.STree{"host": "localhost", "port": 8080, "tls": false},
+		"log":    gostree.STree{"level": "warn", "json": true},
+		"db":     "sqlite",
+	}
+
+	Convey("Test Loader with layered sources\n", t, func() {
+		os.Setenv("GOSTREETEST_SERVER__TLS", "true")
+		os.Setenv("GOSTREETEST_DB__HOST", "db.internal")
+		defer os.Unsetenv("GOSTREETEST_SERVER__TLS")
+		defer os.Unsetenv("GOSTREETEST_DB__HOST")
+
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Int("server.port", 0, "port")
+		fs.String("log.level", "", "level")
+		So(fs.Parse([]string{"-server.port=9090"}), ShouldBeNil)
+
+		c, err := NewLoader(Defaults(defaults), File(yamlPath)).
+			Add(OptionalFile(filepath.Join(dir, "missing.yaml")), File(localPath), Env("GOSTREETEST_"), Flags(fs)).
+			Load()
+		So(err, ShouldBeNil)
+
+		So(c.StrValMust(".server.host"), ShouldEqual, "example.com")
+		So(c.IntValMust(".server.port"), ShouldEqual, 9090)
+		So(c.BoolValMust(".server.tls"), ShouldBeTrue)
+		So(c.SliceValMust(".server.tags"), ShouldResemble, []interface{}{"dev"})
+		So(c.StrValMust(".log.level"), ShouldEqual, "debug")
+		So(c.BoolValMust(".log.json"), ShouldBeTrue)
+		So(c.StrValMust(".db.host"), ShouldEqual, "db.internal")
+
+		cases := map[string]string{
+			".server.host":    yamlPath + ":2:9",
+			".server.port":    "flags",
+			".server.tls":     "env",
+			".server.tags":    localPath + ":4:18",
+			".server.tags[0]": localPath + ":4:19",
+			".log.level":      localPath + ":3:16",
+			".log.json":       "defaults",
+			".db.host":        "env",
+		}
+		for path, want := range cases {
+			p, ok := c.Provenance(path)
+			So(ok, ShouldBeTrue)
+			So(p.String(), ShouldEqual, want)
+		}
+		_, ok := c.Provenance(".server.tags[1]")
+		So(ok, ShouldBeFalse)
+		_, ok = c.Provenance(".server")
+		So(ok, ShouldBeFalse)
+
+		So(defaults["db"], ShouldEqual, "sqlite")
+	})
+
+	Convey("Test Loader errors\n", t, func() {
+		os.Setenv("GOSTREETEST_SERVER__PORT", "eighty")
+		defer os.Unsetenv("GOSTREETEST_SERVER__PORT")
+
+		_, err := NewLoader(Defaults(defaults), Env("GOSTREETEST_")).Load()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "Load error merging source env: .server.port: ")
+
+		_, err = NewLoader(File(filepath.Join(dir, "missing.yaml"))).Load()
+		So(err, ShouldNotBeNil)
+
+		_, err = NewLoader(File(filepath.Join(dir, "config.xml"))).Load()
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oldenbur/gostree"
+)
+
+// Source supplies one layer of configuration to a Loader.
+type Source interface {
+	// Name identifies the source in provenance and errors, e.g. by a file path.
+	Name() string
+	// Load returns the values supplied by the source. The STree returned belongs
+	// to the Loader.
+	Load() (gostree.STree, error)
+}
+
+// positionedSource is implemented by sources which read a document recording the
+// position of each value, which the Loader reports in Provenance.
+type positionedSource interface {
+	loadPositioned() (gostree.PositionedSTree, error)
+}
+
+// stringSource is implemented by sources whose string values may stand for values
+// of any type, as environment variables do, which the Loader converts to the type
+// of the values they override.
+type stringSource interface {
+	stringValued()
+}
+
+type defaultsSource struct {
+	tree gostree.STree
+}
+
+// Defaults returns a Source supplying a copy of t, named "defaults".
+func Defaults(t gostree.STree) Source {
+	return defaultsSource{t}
+}
+
+func (d defaultsSource) Name() string {
+	return "defaults"
+}
+
+func (d defaultsSource) Load() (gostree.STree, error) {
+	return gostree.NewSTreeCopy(d.tree)
+}
+
+type fileSource struct {
+	path     string
+	optional bool
+}
+
+// File returns a Source reading the file at path, named by the path. The format
+// is detected by the extension: .yaml and .yml files are read as yaml, .json
+// files as json, .jsonc and .json5 files as lenient json and .toml files as toml.
+// Yaml and json files record the position of each value for Provenance.
+func File(path string) Source {
+	return fileSource{path: path}
+}
+
+// OptionalFile returns a Source reading the file at path as File does, which
+// supplies no values if the file does not exist.
+func OptionalFile(path string) Source {
+	return fileSource{path: path, optional: true}
+}
+
+func (f fileSource) Name() string {
+	return f.path
+}
+
+func (f fileSource) Load() (gostree.STree, error) {
+	t, err := f.loadPositioned()
+	return t.STree, err
+}
+
+func (f fileSource) loadPositioned() (gostree.PositionedSTree, error) {
+
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) && f.optional {
+		return gostree.PositionedSTree{STree: gostree.NewSTree()}, nil
+	} else if err != nil {
+		return gostree.PositionedSTree{}, fmt.Errorf("File error opening %s: %v", f.path, err)
+	}
+	defer file.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(f.path)); ext {
+	case ".yaml", ".yml":
+		return gostree.NewPositionedSTreeYaml(file)
+	case ".json":
+		return gostree.NewPositionedSTreeJson(file)
+	case ".jsonc", ".json5":
+		return gostree.NewPositionedSTreeJson(file, gostree.WithJson5(true))
+	case ".toml":
+		t, err := gostree.NewSTreeToml(file)
+		return gostree.PositionedSTree{STree: t}, err
+	default:
+		return gostree.PositionedSTree{}, fmt.Errorf("File found unsupported extension %q of %s", ext, f.path)
+	}
+}
+
+type envSource struct {
+	prefix string
+}
+
+// Env returns a Source supplying the environment variables beginning with prefix,
+// named "env". Following NewSTreeEnv, the prefix is removed and the rest lower
+// cased and split on "__", so that with the prefix APP_, APP_DB__HOST=x maps to
+// .db.host. Values are strings.
+func Env(prefix string) Source {
+	return envSource{prefix}
+}
+
+func (e envSource) Name() string {
+	return "env"
+}
+
+func (e envSource) stringValued() {}
+
+func (e envSource) Load() (gostree.STree, error) {
+	t := gostree.NewSTree()
+	for _, kv := range os.Environ() {
+		eq := strings.IndexByte(kv, '=')
+		if eq < 0 || !strings.HasPrefix(kv[:eq], e.prefix) || eq == len(e.prefix) {
+			continue
+		}
+		path := gostree.AsPath(strings.Split(strings.ToLower(kv[len(e.prefix):eq]), "__")...)
+		var err error
+		if t, err = t.SetVal(path, kv[eq+1:]); err != nil {
+			return nil, fmt.Errorf("Env error setting %s: %v", kv[:eq], err)
+		}
+	}
+	return t, nil
+}
+
+type flagSource struct {
+	fs *flag.FlagSet
+}
+
+// Flags returns a Source supplying the flags of fs set on the command line, named
+// "flags". Flag names are split on ".", so that -server.port=80 maps to
+// .server.port. Values are stored as returned by the Get method of the flag.Getter
+// of each flag, durations as their String, and others as strings.
+func Flags(fs *flag.FlagSet) Source {
+	return flagSource{fs}
+}
+
+func (f flagSource) Name() string {
+	return "flags"
+}
+
+func (f flagSource) stringValued() {}
+
+func (f flagSource) Load() (gostree.STree, error) {
+	t := gostree.NewSTree()
+	var err error
+	f.fs.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		var val interface{} = fl.Value.String()
+		if g, ok := fl.Value.(flag.Getter); ok {
+			val = g.Get()
+		}
+		if d, ok := val.(time.Duration); ok {
+			val = d.String()
+		}
+		if t, err = t.SetVal(gostree.AsPath(strings.Split(fl.Name, ".")...), val); err != nil {
+			err = fmt.Errorf("Flags error setting %s: %v", fl.Name, err)
+		}
+	})
+	return t, err
+}
@@ -2,15 +2,12 @@ package gostree
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 	//	log "github.com/cihub/seelog"
 )
 
 type FieldPath []string
 
-var pathRegexp *regexp.Regexp = regexp.MustCompile(`\.((?:[^\.\\]|\\\.)+)`)
-
 func (p FieldPath) String() string {
 	if len(p) < 1 {
 		return ""
@@ -40,11 +37,13 @@ func (p FieldPath) shift() FieldPath {
 	}
 }
 
+// append returns a new FieldPath consisting of p followed by keys. The backing
+// array of p is never shared with the result, so sibling paths built from the
+// same parent do not overwrite one another.
 func (p FieldPath) append(keys ...string) FieldPath {
-	for _, key := range keys {
-		p = append(p, key)
-	}
-	return p
+	result := make(FieldPath, 0, len(p)+len(keys))
+	result = append(result, p...)
+	return append(result, keys...)
 }
 
 func (p FieldPath) first() string {
@@ -71,12 +70,32 @@ func ValueOfPath(p string) (FieldPath, error) {
 	if !strings.HasPrefix(p, ".") {
 		return nil, fmt.Errorf("ValueOfPath lacks prefix .: %s", p)
 	}
-	subs := pathRegexp.FindAllStringSubmatch(p, -1)
-	for i, sub := range subs {
-		if len(sub) < 2 {
-			return result, fmt.Errorf("ValueOfPath(\"%s\") unexpected submatch %d: %q", p, i, subs)
+	// components are split on unescaped dots, except within the braces of a key
+	// such as {"a.b}"}, in which quoted strings may hold braces of their own
+	var comp strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch {
+		case p[i] == '.':
+			if comp.Len() > 0 {
+				result = append(result, comp.String())
+				comp.Reset()
+			}
+		case p[i] == '\\' && i+1 < len(p) && p[i+1] == '.':
+			comp.WriteByte('.')
+			i++
+		case p[i] == '{' && comp.Len() == 0:
+			end := bracedEnd(p[i:])
+			if end < 0 {
+				return nil, fmt.Errorf("ValueOfPath(\"%s\") found unclosed braces", p)
+			}
+			comp.WriteString(unescapeBraced(p[i : i+end]))
+			i += end - 1
+		default:
+			comp.WriteByte(p[i])
 		}
-		result = append(result, strings.Replace(sub[1], `\.`, `.`, -1))
+	}
+	if comp.Len() > 0 {
+		result = append(result, comp.String())
 	}
 	return result, nil
 }
@@ -102,16 +121,11 @@ func (s STree) FieldPaths() (paths []FieldPath) {
 func (s STree) fieldPaths(parent FieldPath, tally []FieldPath) []FieldPath {
 	for k, v := range s {
 
-		var f string
 		var path FieldPath
-		if fVal, ok := k.(string); ok {
-			f = fVal
-		} else {
-			panic(fmt.Sprintf("fieldPaths failed to convert STree k '%v' to Field", k))
-		}
+		f := keyComponent(k)
 
 		if !IsSlice(v) {
-			path = append(parent, f)
+			path = parent.append(f)
 		} else {
 			tally = fieldPathsSlice(parent, tally, f, v)
 			continue
@@ -129,7 +143,7 @@ func (s STree) fieldPaths(parent FieldPath, tally []FieldPath) []FieldPath {
 func fieldPathsSlice(parent FieldPath, tally []FieldPath, key string, val interface{}) []FieldPath {
 	for i, vi := range val.([]interface{}) {
 		keySub := fmt.Sprintf("%s[%d]", key, i)
-		path := append(parent, keySub)
+		path := parent.append(keySub)
 		if vs, err := ValueOf(vi); err == nil {
 			tally = vs.fieldPaths(path, tally)
 		} else if IsSlice(vi) {
@@ -140,3 +154,30 @@ func fieldPathsSlice(parent FieldPath, tally []FieldPath, key string, val interf
 	}
 	return tally
 }
+
+// emptyPaths returns the paths of the empty STrees and slices beneath parent,
+// which hold no leaf and so are absent from FieldPaths.
+func (s STree) emptyPaths(parent FieldPath, tally []FieldPath) []FieldPath {
+	for k, v := range s {
+		tally = emptyPathsVal(parent.append(keyComponent(k)), v, tally)
+	}
+	return tally
+}
+
+func emptyPathsVal(path FieldPath, val interface{}, tally []FieldPath) []FieldPath {
+	switch tv := val.(type) {
+	case STree:
+		if len(tv) < 1 {
+			return append(tally, path)
+		}
+		return tv.emptyPaths(path, tally)
+	case []interface{}:
+		if len(tv) < 1 {
+			return append(tally, path)
+		}
+		for i, vi := range tv {
+			tally = emptyPathsVal(path[:len(path)-1].append(fmt.Sprintf("%s[%d]", path.last(), i)), vi, tally)
+		}
+	}
+	return tally
+}
@@ -0,0 +1,163 @@
+package gostree
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pointer is an RFC 6901 JSON Pointer, e.g. /a~1b/0, held as its sequence of
+// unescaped reference tokens. Unlike a FieldPath, a Pointer does not distinguish
+// slice indices from keys, so it must be resolved against a particular STree using
+// ResolvePointer to obtain the equivalent FieldPath.
+type Pointer []string
+
+// ParsePointer parses p as an RFC 6901 JSON Pointer, either in its string form,
+// e.g. /a~1b/0, or in its URI fragment form, e.g. #/a~1b/0, as found in the $ref
+// values of OpenAPI and JSON Schema documents.
+func ParsePointer(p string) (Pointer, error) {
+
+	ptr := p
+	if strings.HasPrefix(ptr, "#") {
+		var err error
+		if ptr, err = url.PathUnescape(ptr[1:]); err != nil {
+			return nil, &PathError{Op: "ParsePointer", Path: p, Err: ErrInvalidPath}
+		}
+	}
+
+	if len(ptr) < 1 {
+		return Pointer{}, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, &PathError{Op: "ParsePointer", Path: p, Err: ErrInvalidPath}
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, tok := range tokens {
+		if strings.Contains(strings.NewReplacer("~0", "", "~1", "").Replace(tok), "~") {
+			return nil, &PathError{Op: "ParsePointer", Path: p, Component: tok, Err: ErrInvalidPath}
+		}
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+	}
+	return Pointer(tokens), nil
+}
+
+func ParsePointerMust(p string) Pointer {
+	ptr, err := ParsePointer(p)
+	if err != nil {
+		panic(err)
+	}
+	return ptr
+}
+
+func (p Pointer) String() string {
+	var buf bytes.Buffer
+	for _, tok := range p {
+		buf.WriteString("/")
+		buf.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(tok))
+	}
+	return buf.String()
+}
+
+// append returns a new Pointer consisting of p followed by tokens.
+func (p Pointer) append(tokens ...string) Pointer {
+	result := make(Pointer, 0, len(p)+len(tokens))
+	result = append(result, p...)
+	return append(result, tokens...)
+}
+
+// Pointer returns the RFC 6901 JSON Pointer equivalent to the FieldPath, with each
+// subscript index of a path component becoming a separate reference token.
+func (p FieldPath) Pointer() Pointer {
+	ptr := Pointer{}
+	for _, c := range p {
+		key, idxs, err := STree(nil).parsePathComponent(c)
+		if err != nil {
+			ptr = append(ptr, c)
+			continue
+		}
+		ptr = append(ptr, keyString(key))
+		for _, idx := range idxs {
+			ptr = append(ptr, strconv.Itoa(idx))
+		}
+	}
+	return ptr
+}
+
+// pointerIndexRegexp matches a valid array index token of an RFC 6901 JSON Pointer
+var pointerIndexRegexp *regexp.Regexp = regexp.MustCompile(`^(?:0|[1-9]\d*)$`)
+
+// ResolvePointer translates the JSON Pointer p into the equivalent FieldPath within
+// this STree. Tokens are taken as keys where the tree holds an STree and as indices
+// where it holds a slice, with the token "-" denoting the index just past the end of
+// the slice. Every token but the last must name an existing value.
+func (t STree) ResolvePointer(p Pointer) (FieldPath, error) {
+	return t.resolvePointer("ResolvePointer", p.String(), p)
+}
+
+func (t STree) resolvePointer(op, ptr string, p Pointer) (FieldPath, error) {
+
+	path := FieldPath{}
+	var cur interface{} = t
+	for i, tok := range p {
+
+		var ok bool
+		switch c := cur.(type) {
+
+		case STree:
+			k := pointerKey(c, tok)
+			path = path.append(keyComponent(k))
+			cur, ok = c[k]
+
+		case []interface{}:
+			idx := len(c)
+			if tok != "-" {
+				if !pointerIndexRegexp.MatchString(tok) {
+					return nil, &PathError{Op: op, Path: ptr, Component: tok, Err: ErrInvalidPath}
+				}
+				idx, _ = strconv.Atoi(tok)
+			}
+			path[len(path)-1] = fmt.Sprintf("%s[%d]", path.last(), idx)
+			if ok = idx < len(c); ok {
+				cur = c[idx]
+			}
+
+		default:
+			return nil, &PathError{Op: op, Path: ptr, Component: tok, Expected: KindSTree, Actual: kindName(cur), Err: ErrTypeMismatch}
+		}
+
+		if !ok && i < len(p)-1 {
+			return nil, &PathError{Op: op, Path: ptr, Component: tok, Err: ErrNotFound}
+		}
+	}
+
+	return path, nil
+}
+
+// isPointer returns true if path is written in JSON Pointer rather than jq-style syntax.
+func isPointer(path string) bool {
+	return strings.HasPrefix(path, "/") || strings.HasPrefix(path, "#")
+}
+
+// fieldPathOf parses path, which may be written either in jq-style syntax, e.g.
+// .a.b[0], or as a JSON Pointer, e.g. /a/b/0, resolving the latter against this
+// STree. Failures are reported as a *PathError attributed to op.
+func (t STree) fieldPathOf(op, path string) (FieldPath, error) {
+
+	if isPointer(path) {
+		p, err := ParsePointer(path)
+		if err != nil {
+			return nil, &PathError{Op: op, Path: path, Err: ErrInvalidPath}
+		}
+		return t.resolvePointer(op, path, p)
+	}
+
+	keys, err := ValueOfPath(path)
+	if err != nil {
+		return nil, &PathError{Op: op, Path: path, Err: ErrInvalidPath}
+	}
+	return keys, nil
+}
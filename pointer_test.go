@@ -0,0 +1,156 @@
+package gostree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestPointer(t *testing.T) {
+
+	json := `
+	{
+		"key1": "val1",
+		"key2": {"key3": true, "a/b": 1, "m~n": 2, "c.d": 3, "": 4},
+		"key4": [1, [2, 3], {"key5": "val5"}]
+	}`
+
+	Convey("ParsePointer", t, func() {
+
+		p, err := ParsePointer(`/key2/a~1b/m~0n`)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, Pointer{"key2", "a/b", "m~n"})
+		So(p.String(), ShouldEqual, `/key2/a~1b/m~0n`)
+
+		p, err = ParsePointer(``)
+		So(err, ShouldBeNil)
+		So(p, ShouldBeEmpty)
+
+		p, err = ParsePointer(`/`)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, Pointer{""})
+
+		p, err = ParsePointer(`#/definitions/a%20b/0`)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, Pointer{"definitions", "a b", "0"})
+
+		p, err = ParsePointer(`#`)
+		So(err, ShouldBeNil)
+		So(p, ShouldBeEmpty)
+
+		_, err = ParsePointer(`key1`)
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		_, err = ParsePointer(`/key2/m~2n`)
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		_, err = ParsePointer(`#/a%zz`)
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		So(func() { ParsePointerMust(`key1`) }, ShouldPanic)
+	})
+
+	Convey("FieldPath Pointer", t, func() {
+		So(ValueOfPathMust(`.key1`).Pointer().String(), ShouldEqual, `/key1`)
+		So(ValueOfPathMust(`.key4[1][0]`).Pointer().String(), ShouldEqual, `/key4/1/0`)
+		So(ValueOfPathMust(`.key2.c\.d`).Pointer().String(), ShouldEqual, `/key2/c.d`)
+		So(FieldPath{"key2", "a/b"}.Pointer().String(), ShouldEqual, `/key2/a~1b`)
+		So(FieldPath{}.Pointer().String(), ShouldEqual, ``)
+	})
+
+	Convey("ResolvePointer", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		p, err := s.ResolvePointer(ParsePointerMust(`/key4/1/0`))
+		So(err, ShouldBeNil)
+		So(p.String(), ShouldEqual, `.key4[1][0]`)
+
+		p, err = s.ResolvePointer(ParsePointerMust(`/key2/a~1b`))
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, FieldPath{"key2", "a/b"})
+
+		p, err = s.ResolvePointer(ParsePointerMust(`/key4/-`))
+		So(err, ShouldBeNil)
+		So(p.String(), ShouldEqual, `.key4[3]`)
+
+		p, err = s.ResolvePointer(ParsePointerMust(`/key2/key9`))
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, FieldPath{"key2", "key9"})
+
+		_, err = s.ResolvePointer(ParsePointerMust(`/key4/01`))
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		_, err = s.ResolvePointer(ParsePointerMust(`/key9/key1`))
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		_, err = s.ResolvePointer(ParsePointerMust(`/key1/key9`))
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+
+		for _, f := range s.FieldPaths() {
+			p, err := s.ResolvePointer(f.Pointer())
+			So(err, ShouldBeNil)
+			So(p, ShouldResemble, f)
+		}
+	})
+
+	Convey("accessors accept pointers", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		So(s.StrValMust(`/key1`), ShouldEqual, "val1")
+		So(s.IntValMust(`/key4/1/1`), ShouldEqual, 3)
+		So(s.StrValMust(`/key4/2/key5`), ShouldEqual, "val5")
+		So(s.IntValMust(`/key2/m~0n`), ShouldEqual, 2)
+		So(s.IntValMust(`/key2/c.d`), ShouldEqual, 3)
+		So(s.IntValMust(`/key2/`), ShouldEqual, 4)
+		So(s.StrValMust(`#/key4/2/key5`), ShouldEqual, "val5")
+
+		_, err = s.Val(`/key4/3`)
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+		_, err = s.IntVal(`/key1`)
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		var pErr *PathError
+		So(errors.As(err, &pErr), ShouldBeTrue)
+		So(pErr.Path, ShouldEqual, `/key1`)
+		So(pErr.Component, ShouldEqual, `key1`)
+
+		m, err := s.SetVal(`/key4/1/0`, "two")
+		So(err, ShouldBeNil)
+		So(m.StrValMust(`.key4[1][0]`), ShouldEqual, "two")
+
+		m, err = s.SetVal(`/key2/a~1b`, "ab")
+		So(err, ShouldBeNil)
+		So(m.StrValMust(`/key2/a~1b`), ShouldEqual, "ab")
+
+		_, err = s.SetVal(`/key9/key10`, 1)
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+
+		m, err = s.Delete(`/key4/0`)
+		So(err, ShouldBeNil)
+		So(m.SliceValMust(`/key4`), ShouldHaveLength, 2)
+	})
+
+	Convey("pointers address keys containing brackets", t, func() {
+		s := STree{"a[0]": 1, "b": STree{"]c[": []interface{}{"x", "y"}}, "a": []interface{}{2}}
+
+		So(s.IntValMust(`/a[0]`), ShouldEqual, 1)
+		So(s.IntValMust(`/a/0`), ShouldEqual, 2)
+		So(s.StrValMust(`/b/]c[/1`), ShouldEqual, "y")
+		So(s.IntValMust(`.{"a[0]"}`), ShouldEqual, 1)
+
+		p, err := s.ResolvePointer(ParsePointerMust(`/b/]c[/1`))
+		So(err, ShouldBeNil)
+		So(p.String(), ShouldEqual, `.b.{"]c["}[1]`)
+		So(p.Pointer().String(), ShouldEqual, `/b/]c[/1`)
+
+		for _, f := range s.FieldPaths() {
+			_, err := s.Val(f.String())
+			So(err, ShouldBeNil)
+		}
+
+		m, err := s.SetVal(`/a[0]`, 3)
+		So(err, ShouldBeNil)
+		So(m.IntValMust(`/a[0]`), ShouldEqual, 3)
+		So(m.IntValMust(`/a/0`), ShouldEqual, 2)
+	})
+}
@@ -3,10 +3,27 @@ package gostree
 import (
 	"fmt"
 	"reflect"
+	"time"
 )
 
+// IsPrimitive returns true if i is a bool, number or string, including the
+// *big.Int and *big.Float values read by WithJsonNumbers(JsonNumberExact), the
+// []byte values read from MessagePack and CBOR binary data and the time.Time
+// values of toml datetimes.
 func IsPrimitive(i interface{}) bool {
-	return isPrimitiveKind(reflect.ValueOf(i).Kind())
+	return isPrimitiveKind(reflect.ValueOf(i).Kind()) || isBigNumber(i) || IsBytes(i) || IsTime(i)
+}
+
+// IsBytes returns true if i is a []byte.
+func IsBytes(i interface{}) bool {
+	_, ok := i.([]byte)
+	return ok
+}
+
+// IsTime returns true if i is a time.Time.
+func IsTime(i interface{}) bool {
+	_, ok := i.(time.Time)
+	return ok
 }
 
 // isPrimitiveKind returns true if the specified Kind represents a primitive
@@ -8,6 +8,7 @@ import (
 	"io"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 
 	log "github.com/cihub/seelog"
@@ -26,8 +27,10 @@ func NewSTreeCopy(t STree) (STree, error) {
 }
 
 // NewSTreeYaml reads yaml from the specified reader, parses it and returns
-// the structure as an STree.
-func NewSTreeYaml(r io.Reader) (stree STree, err error) {
+// the structure as an STree, treating anchors and aliases as configured by opts.
+// The root must be a mapping; documents with other roots are read by
+// NewDocumentYaml.
+func NewSTreeYaml(r io.Reader, opts ...YamlOption) (stree STree, err error) {
 
 	buf := bytes.NewBuffer([]byte{})
 	_, err = buf.ReadFrom(r)
@@ -35,9 +38,9 @@ func NewSTreeYaml(r io.Reader) (stree STree, err error) {
 		return nil, fmt.Errorf("NewSTreeJson error reading bytes: %v", err)
 	}
 
-	err = yaml.Unmarshal(buf.Bytes(), &stree)
+	stree, err = newYamlCodec(opts).unmarshal(buf.Bytes())
 	if err != nil {
-		return nil, fmt.Errorf("NewSTreeYaml error in yaml.Unmarshal: ", err)
+		return nil, fmt.Errorf("NewSTreeYaml %v", err)
 	}
 	return
 }
@@ -66,8 +69,10 @@ func (s STree) WriteJson(indent bool) ([]byte, error) {
 }
 
 // NewSTreeJson reads json from the specified reader, parses it and returns
-// the structure as an STree.
-func NewSTreeJson(r io.Reader) (stree STree, err error) {
+// the structure as an STree. Numbers are stored as float64 values unless
+// WithJsonNumbers specifies otherwise. The root must be an object; documents with
+// other roots are read by NewDocumentJson.
+func NewSTreeJson(r io.Reader, opts ...JsonOption) (stree STree, err error) {
 
 	buf := bytes.NewBuffer([]byte{})
 	_, err = buf.ReadFrom(r)
@@ -75,13 +80,11 @@ func NewSTreeJson(r io.Reader) (stree STree, err error) {
 		return nil, fmt.Errorf("NewSTreeJson error reading bytes: %v", err)
 	}
 
-	um := make(map[string]interface{})
-	err = json.Unmarshal(buf.Bytes(), &um)
+	stree, err = newJsonCodec(opts).unmarshal(buf.Bytes())
 	if err != nil {
-		return nil, fmt.Errorf("NewSTreeJson error in yaml.Unmarshal: ", err)
+		return nil, fmt.Errorf("NewSTreeJson %w", err)
 	}
-
-	return convertKeys(um)
+	return stree, nil
 }
 
 func findStructElemsPath(pre string, s interface{}, valsIn settingsMap) (vals settingsMap, err error) {
@@ -122,77 +125,98 @@ func (t STree) Keys() []interface{} {
 	return keys
 }
 
+// sortedKeys returns the top-level keys of this STree ordered by their string
+// representation, for operations that must produce deterministic output.
+func (t STree) sortedKeys() []interface{} {
+	keys := t.Keys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprintf("%v", keys[i]) < fmt.Sprintf("%v", keys[j])
+	})
+	return keys
+}
+
 // KeyStrings returns a slice containing all top-level keys of this STree converted to
-// string, or an error if the conversion fails for any key
+// path components, with keys other than strings enclosed in braces, e.g. {42}.
 func (t STree) KeyStrings() ([]string, error) {
 	keys := []string{}
 	for k, _ := range t {
-		if s, ok := k.(string); !ok {
-			return keys, fmt.Errorf("KeyStrings failed to convert %v to string type", k)
-		} else {
-			keys = append(keys, s)
-		}
+		keys = append(keys, keyComponent(k))
 	}
 	return keys, nil
 }
 
-// keyRegexp matches strings of the form key_name or slice_name[123]
-var keyRegexp *regexp.Regexp = regexp.MustCompile(`^([^\[\]]+)(?:\[(\d+)\])?$`)
+// subscriptsRegexp matches the subscripts following the key of a path component,
+// e.g. [1][23] of nested_slice_name[1][23]
+var subscriptsRegexp *regexp.Regexp = regexp.MustCompile(`^(?:\[\d+\])*$`)
 
-// Val returns the leaf value at the position specified by path, which is a slash delimited
-// list of nested keys in data, e.g. .level1.level2.key. If the key does not exist, an error
-// is returned.
+// subscriptRegexp matches a single subscript index within a path component
+var subscriptRegexp *regexp.Regexp = regexp.MustCompile(`\[(\d+)\]`)
+
+// Val returns the leaf value at the position specified by path, which is a dot delimited
+// list of nested keys in data, e.g. .level1.level2.key, or equivalently an RFC 6901 JSON
+// Pointer, e.g. /level1/level2/key. If the value cannot be found, a *PathError is returned
+// describing the component at which resolution failed.
 func (t STree) Val(path string) (interface{}, error) {
+	return t.val("Val", path)
+}
 
-	keys, err := ValueOfPath(path)
+// val resolves path against t, reporting any failure as a *PathError attributed
+// to the operation op.
+func (t STree) val(op, path string) (interface{}, error) {
+
+	keys, err := t.fieldPathOf(op, path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse path: %s", path)
+		return nil, err
+	}
+	if len(keys) < 1 {
+		return nil, &PathError{Op: op, Path: path, Err: ErrInvalidPath}
 	}
-	keyCur := keys.first()
 
-	key, idx, err := t.parsePathComponent(keyCur)
+	var val interface{} = t
+	for _, keyCur := range keys {
 
-	if len(keys) < 1 {
-		return nil, fmt.Errorf("no key remaining components")
-
-	} else if len(keys) == 1 && idx < 0 {
-		//		log.Debugf("Val(%s) - LastKey: %v", path, t[key])
-		if val, ok := t[key]; !ok {
-			return nil, fmt.Errorf("Val item not found at key %s", keyCur)
-		} else {
-			return val, nil
+		data, ok := val.(STree)
+		if !ok {
+			return nil, &PathError{Op: op, Path: path, Component: keyCur, Expected: KindSTree, Actual: kindName(val), Err: ErrTypeMismatch}
 		}
 
-	} else if data, ok := t[key].(STree); ok {
-		if idx >= 0 {
-			return nil, fmt.Errorf("Val unexpected index for STree value: %s", keyCur)
-		} else {
-			return data.Val(keys.shift().String())
+		key, idxs, err := t.parsePathComponent(keyCur)
+		if err != nil {
+			return nil, &PathError{Op: op, Path: path, Component: keyCur, Err: ErrInvalidPath}
 		}
 
-	} else if data, ok := t[key].([]interface{}); ok {
-		// TODO: break this case out to recursively handle nested slices
-		//		log.Debugf("Val(%s) - slice: %v", path, data)
-		if idx >= 0 && idx < len(data) {
-			result := data[idx]
-			if len(keys) <= 1 {
-				return result, nil
-			} else if sval, ok := result.(STree); ok {
-				return sval.Val(keys.shift().String())
-			}
+		if val, ok = data[key]; !ok {
+			return nil, &PathError{Op: op, Path: path, Component: keyCur, Err: ErrNotFound}
+		}
 
-		} else if idx < 0 {
-			if len(keys) > 1 {
-				return nil, fmt.Errorf("Val requires index to traverse slice value for key: %s", keyCur)
+		for _, idx := range idxs {
+			sVal, ok := val.([]interface{})
+			if !ok {
+				return nil, &PathError{Op: op, Path: path, Component: keyCur, Expected: KindSlice, Actual: kindName(val), Err: ErrTypeMismatch}
 			}
-			return data, nil
-
-		} else {
-			return nil, fmt.Errorf("Val slice key index out of range [0,%d]: %s", len(data)-1, keyCur)
+			if idx >= len(sVal) {
+				return nil, &PathError{Op: op, Path: path, Component: keyCur,
+					Expected: fmt.Sprintf("index in [0,%d]", len(sVal)-1), Actual: fmt.Sprintf("index %d", idx), Err: ErrIndexOutOfRange}
+			}
+			val = sVal[idx]
 		}
 	}
 
-	return nil, fmt.Errorf("Val failed to produce value for key: %s", keyCur)
+	return val, nil
+}
+
+// typeMismatch returns a *PathError reporting that the value v found at path
+// is not of the expected kind required by op.
+func typeMismatch(op, path, expected string, v interface{}) error {
+	var component string
+	if isPointer(path) {
+		if ptr, err := ParsePointer(path); err == nil && len(ptr) > 0 {
+			component = ptr[len(ptr)-1]
+		}
+	} else if keys, err := ValueOfPath(path); err == nil {
+		component = keys.last()
+	}
+	return &PathError{Op: op, Path: path, Component: component, Expected: expected, Actual: kindName(v), Err: ErrTypeMismatch}
 }
 
 func (t STree) ValMust(path string) interface{} {
@@ -203,15 +227,18 @@ func (t STree) ValMust(path string) interface{} {
 	return val
 }
 
-// SVal returns the value stored in data at the path, converting it
+// StrVal returns the value stored in data at the path, converting it
 // to a a string, and returning the zero value if the string is not
 // found.
 func (t STree) StrVal(path string) (string, error) {
-	v, err := t.Val(path)
+	v, err := t.val("StrVal", path)
+	if err != nil {
+		return "", err
+	}
 	if sval, ok := v.(string); ok {
-		return sval, err
+		return sval, nil
 	}
-	return "", fmt.Errorf("StrVal found unexpected value type %T for path '%s'", v, path)
+	return "", typeMismatch("StrVal", path, KindString, v)
 }
 
 func (t STree) StrValMust(path string) string {
@@ -223,17 +250,18 @@ func (t STree) StrValMust(path string) string {
 }
 
 // IntVal returns the value stored in data at the path, converting it
-// to an int64, and returning the zero value if the int is not found.
+// to an int64, and returning the zero value if the int is not found. Floats,
+// json.Number and big number values are converted only if they hold an integral
+// value within the range of an int64.
 func (t STree) IntVal(path string) (int64, error) {
-	v, err := t.Val(path)
-	if ival, ok := v.(int64); ok {
-		return int64(ival), err
-	} else if ival, ok := v.(int); ok {
-		return int64(ival), err
-	} else if ival, ok := v.(float64); ok {
-		return int64(ival), err
+	v, err := t.val("IntVal", path)
+	if err != nil {
+		return 0, err
+	}
+	if ival, ok := integerVal(v); ok {
+		return ival, nil
 	}
-	return 0, fmt.Errorf("IntVal found unexpected value type %T for path '%s'", v, path)
+	return 0, typeMismatch("IntVal", path, KindInt, v)
 }
 
 func (t STree) IntValMust(path string) int64 {
@@ -245,13 +273,22 @@ func (t STree) IntValMust(path string) int64 {
 }
 
 // FloatVal returns the value stored in data at the path, converting it
-// to an int64, and returning the zero value if the value cannot be converted.
+// to a float64, and returning the zero value if the value cannot be converted.
+// json.Number and big number values are rounded to the nearest float64.
 func (t STree) FloatVal(path string) (float64, error) {
-	v, err := t.Val(path)
+	v, err := t.val("FloatVal", path)
+	if err != nil {
+		return 0, err
+	}
 	if fval, ok := v.(float64); ok {
-		return fval, err
+		return fval, nil
 	}
-	return 0, fmt.Errorf("FloatVal found unexpected value type %T for path '%s'", v, path)
+	if _, isNumber := v.(json.Number); isNumber || isBigNumber(v) {
+		if fval, ok := numericVal(v); ok {
+			return fval, nil
+		}
+	}
+	return 0, typeMismatch("FloatVal", path, KindFloat, v)
 }
 
 func (t STree) FloatValMust(path string) float64 {
@@ -262,14 +299,17 @@ func (t STree) FloatValMust(path string) float64 {
 	return v
 }
 
-// BVal returns the value stored in data at the path, converting it
+// BoolVal returns the value stored in data at the path, converting it
 // to an bool, and returning the zero value if the bool is not found.
 func (t STree) BoolVal(path string) (bool, error) {
-	v, err := t.Val(path)
+	v, err := t.val("BoolVal", path)
+	if err != nil {
+		return false, err
+	}
 	if bval, ok := v.(bool); ok {
-		return bval, err
+		return bval, nil
 	}
-	return false, fmt.Errorf("BoolVal found unexpected value type %T for path '%s'", v, path)
+	return false, typeMismatch("BoolVal", path, KindBool, v)
 }
 
 func (t STree) BoolValMust(path string) bool {
@@ -283,11 +323,14 @@ func (t STree) BoolValMust(path string) bool {
 // STreeVal returns the value stored in data at the path, converting it
 // to an STree and returning nil if the operation fails.
 func (t STree) STreeVal(path string) (STree, error) {
-	v, err := t.Val(path)
+	v, err := t.val("STreeVal", path)
+	if err != nil {
+		return nil, err
+	}
 	if sval, ok := v.(STree); ok {
-		return sval, err
+		return sval, nil
 	}
-	return nil, fmt.Errorf("STreeVal found unexpected value type %T for path '%s'", v, path)
+	return nil, typeMismatch("STreeVal", path, KindSTree, v)
 }
 
 func (t STree) STreeValMust(path string) STree {
@@ -301,11 +344,14 @@ func (t STree) STreeValMust(path string) STree {
 // SliceVal returns the value stored in the STree at the path, converting
 // it to a []interface{} and returning nil if the operation fails.
 func (t STree) SliceVal(path string) ([]interface{}, error) {
-	v, err := t.Val(path)
+	v, err := t.val("SliceVal", path)
+	if err != nil {
+		return nil, err
+	}
 	if aval, ok := v.([]interface{}); ok {
-		return aval, err
+		return aval, nil
 	}
-	return nil, fmt.Errorf("SliceVal found unexpected value type %T for path '%s'", v, path)
+	return nil, typeMismatch("SliceVal", path, KindSlice, v)
 }
 
 func (t STree) SliceValMust(path string) []interface{} {
@@ -350,8 +396,7 @@ func convertVal(v interface{}) (interface{}, error) {
 
 	var result interface{}
 
-	val := reflect.ValueOf(v)
-	if isPrimitiveKind(val.Kind()) {
+	if v == nil || IsPrimitive(v) {
 		result = v
 
 	} else if vSlice, ok := v.([]interface{}); ok {
@@ -368,10 +413,24 @@ func convertVal(v interface{}) (interface{}, error) {
 	} else if vMap, ok := v.(map[string]interface{}); ok {
 		mVal, err := convertKeys(vMap)
 		if err != nil {
-			return nil, fmt.Errorf("convertVal error converting val: %v", vMap, err)
+			return nil, fmt.Errorf("convertVal error converting val %v: %v", vMap, err)
+		}
+		result = interface{}(mVal)
+
+	} else if vTree, ok := v.(STree); ok {
+		mVal := STree{}
+		for k, kv := range vTree {
+			kConv, err := convertVal(kv)
+			if err != nil {
+				return nil, err
+			}
+			mVal[k] = kConv
 		}
 		result = interface{}(mVal)
 
+	} else if vMap, ok := v.(map[interface{}]interface{}); ok {
+		return convertVal(STree(vMap))
+
 	} else {
 		return nil, fmt.Errorf("convertVal unexpected type case")
 	}
@@ -380,68 +439,81 @@ func convertVal(v interface{}) (interface{}, error) {
 }
 
 // unconvertKeys returns a nested map with the same structure as the STree,
-// but with string-typed keys, for use in json.Marshall() and the like.
+// but with string-typed keys, for use in json.Marshall() and the like. Keys other
+// than strings are converted by keyString, and an error is returned if the result
+// collides with another key.
 func (s STree) unconvertKeys() (map[string]interface{}, error) {
 
 	result := make(map[string]interface{})
+	if err := s.keyCollision(); err != nil {
+		return nil, fmt.Errorf("unconvertKeys %v", err)
+	}
 
 	for k, v := range s {
 
-		var kStr string
-		if kStrVal, ok := k.(string); !ok {
-			return nil, fmt.Errorf("unconvertKeys failed to convert key: %v", k)
-		} else {
-			kStr = kStrVal
+		kStr := keyString(k)
+		cVal, err := unconvertVal(v)
+		if err != nil {
+			return nil, fmt.Errorf("unconvertKeys error converting key %s: %v", k, err)
 		}
+		result[kStr] = cVal
+	}
 
-		val := reflect.ValueOf(v)
-		if isPrimitiveKind(val.Kind()) {
-			result[kStr] = v
-		} else if vSlice, ok := v.([]interface{}); ok {
-			result[kStr] = make([]interface{}, len(vSlice))
-			for vIdx, vSub := range vSlice {
-				if sVal, ok := vSub.(STree); ok {
-					cVal, err := sVal.unconvertKeys()
-					if err != nil {
-						return nil, fmt.Errorf("unconvertKeys error converting slice key %s index %d: %v", k, vIdx, err)
-					}
-					result[kStr].([]interface{})[vIdx] = interface{}(cVal)
-				}
-			}
+	return result, nil
+}
+
+// unconvertVal returns v with every nested STree converted by unconvertKeys.
+func unconvertVal(v interface{}) (interface{}, error) {
 
-		} else if sVal, ok := v.(STree); ok {
-			cVal, err := sVal.unconvertKeys()
+	val := reflect.ValueOf(v)
+	if isBigNumber(v) {
+		return bigNumberJson(v), nil
+
+	} else if v == nil || isPrimitiveKind(val.Kind()) || IsBytes(v) || IsTime(v) {
+		return v, nil
+
+	} else if vSlice, ok := v.([]interface{}); ok {
+		result := make([]interface{}, len(vSlice))
+		for vIdx, vSub := range vSlice {
+			cVal, err := unconvertVal(vSub)
 			if err != nil {
-				return nil, fmt.Errorf("unconvertKeys error converting key %s: %v", k, err)
+				return nil, fmt.Errorf("unconvertVal error converting slice index %d: %v", vIdx, err)
 			}
-			result[kStr] = interface{}(cVal)
-		} else {
-			return nil, fmt.Errorf("unconvertKeys unexpected type case")
+			result[vIdx] = cVal
 		}
-	}
+		return result, nil
 
-	return result, nil
+	} else if sVal, ok := v.(STree); ok {
+		return sVal.unconvertKeys()
+
+	} else {
+		return nil, fmt.Errorf("unconvertVal unexpected type case")
+	}
 }
 
-// parsePathComponent parses the input as a stree key with an optional subscript
-// index, e.g. "streeKey" or "treeList[2]". The key component and subscript index
-// is returned, with -1 denoting no subscript present.
-func (s STree) parsePathComponent(c string) (string, int, error) {
+// parsePathComponent parses the input as a stree key with optional subscript
+// indices, e.g. "streeKey", "treeList[2]", "treeMatrix[2][0]" or "{42}[1]". The key
+// and the subscript indices are returned, with an empty slice denoting no subscript
+// present. The key is a string unless written as a braced scalar, as by keyOf.
+func (s STree) parsePathComponent(c string) (interface{}, []int, error) {
 
-	path_comps := keyRegexp.FindStringSubmatch(c)
-	if path_comps == nil || len(path_comps) < 1 {
-		return "", -1, fmt.Errorf("parsePathComponent failed to parse path component %s", c)
+	keyComp, subs, ok := splitComponent(c)
+	if !ok {
+		return "", nil, fmt.Errorf("parsePathComponent failed to parse path component %s", c)
 	}
 
-	path := path_comps[1]
-	idx := -1
-	if len(path_comps[2]) > 0 {
-		i, err := strconv.Atoi(path_comps[2])
+	key, err := keyOf(keyComp)
+	if err != nil {
+		return "", nil, fmt.Errorf("parsePathComponent failed to parse key of %s: %v", c, err)
+	}
+	idxs := []int{}
+	for _, idx_comps := range subscriptRegexp.FindAllStringSubmatch(subs, -1) {
+		i, err := strconv.Atoi(idx_comps[1])
 		if err != nil || i < 0 {
-			return "", -1, fmt.Errorf("parsePathComponent failed to parse slice index %s from %s", path_comps[2], c)
+			return "", nil, fmt.Errorf("parsePathComponent failed to parse slice index %s from %s", idx_comps[1], c)
 		}
-		idx = i
+		idxs = append(idxs, i)
 	}
 
-	return path, idx, nil
+	return key, idxs, nil
 }
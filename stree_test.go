@@ -1,6 +1,7 @@
 package gostree
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -150,6 +151,40 @@ func TestSTree(t *testing.T) {
 		log.Debugf("st1j: %s", string(st1j))
 	})
 
+	Convey("Json nested slice access\n", t, func() {
+
+		data := `{"m": [[1, 2], [3, [4, {"e": "EEE"}]]], "n": [[]]}`
+		s, err := NewSTreeJson(strings.NewReader(data))
+		So(err, ShouldBeNil)
+		v01, err := s.IntVal(".m[0][1]")
+		So(err, ShouldBeNil)
+		So(v01, ShouldEqual, 2)
+		v110, err := s.IntVal(".m[1][1][0]")
+		So(err, ShouldBeNil)
+		So(v110, ShouldEqual, 4)
+		ve, err := s.StrVal(".m[1][1][1].e")
+		So(err, ShouldBeNil)
+		So(ve, ShouldEqual, "EEE")
+		sl, err := s.SliceVal(".m[1]")
+		So(err, ShouldBeNil)
+		So(len(sl), ShouldEqual, 2)
+
+		_, err = s.Val(".m[0][2]")
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+		_, err = s.Val(".m[0][0][0]")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.Val(".n[0][0]")
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+		_, err = s.Val(".m[1].e")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+
+		for _, p := range s.FieldPaths() {
+			_, err = s.Val(p.String())
+			So(err, ShouldBeNil)
+		}
+	})
+
 	var yamlData string = `
 ---
 product:
@@ -0,0 +1,557 @@
+package gostree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// YamlAliasMode selects how NewSTreeYaml treats yaml anchors, aliases and merge
+// keys, i.e. <<: *defaults.
+type YamlAliasMode int
+
+const (
+	// YamlAliasExpand expands each alias into a copy of its anchored value, with
+	// merge keys applied by yaml.v2, under which a merge overrides any keys
+	// preceding it in the mapping. This is the default.
+	YamlAliasExpand YamlAliasMode = iota
+	// YamlAliasResolve expands each alias into a copy of its anchored value, and
+	// applies merge keys as the yaml spec defines them: keys of the mapping itself
+	// always override merged keys, and earlier merged mappings override later ones.
+	YamlAliasResolve
+	// YamlAliasKeep stores a single STree or slice for each anchored mapping or
+	// sequence, shared by every alias of it. Merge keys are kept as << keys holding
+	// the merged STree, or a slice of them, and may be applied by ResolveMerges.
+	// The sharing is kept by the methods of an AliasedSTree, as returned by
+	// NewAliasedSTreeYaml, while those of an STree copy and write each shared value
+	// separately wherever it appears.
+	YamlAliasKeep
+)
+
+// YamlOption configures the reading of yaml documents by NewSTreeYaml.
+type YamlOption func(*yamlCodec)
+
+// WithYamlAliases sets the treatment of anchors, aliases and merge keys.
+func WithYamlAliases(mode YamlAliasMode) YamlOption {
+	return func(c *yamlCodec) { c.aliases = mode }
+}
+
+type yamlCodec struct {
+	aliases YamlAliasMode
+}
+
+func newYamlCodec(opts []YamlOption) *yamlCodec {
+	c := &yamlCodec{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// AliasedSTree is an STree read with YamlAliasKeep, in which every alias of an
+// anchored mapping or sequence refers to the same STree or slice. SetVal and
+// Delete keep that sharing, so that an edit through any path is seen through all
+// of them, and WriteYaml writes shared values as anchors and aliases. All other
+// methods apply to the embedded STree, and copy shared values separately.
+type AliasedSTree struct {
+	STree
+}
+
+// NewAliasedSTreeYaml reads yaml from the specified reader as NewSTreeYaml does
+// with WithYamlAliases(YamlAliasKeep), which overrides any alias mode in opts.
+func NewAliasedSTreeYaml(r io.Reader, opts ...YamlOption) (AliasedSTree, error) {
+	s, err := NewSTreeYaml(r, append(opts, WithYamlAliases(YamlAliasKeep))...)
+	if err != nil {
+		return AliasedSTree{}, err
+	}
+	return AliasedSTree{s}, nil
+}
+
+// SetVal returns a copy of the AliasedSTree with val stored at path, as by
+// STree.SetVal, in which values shared in a are shared in the same way.
+func (a AliasedSTree) SetVal(path string, val interface{}) (AliasedSTree, error) {
+	clone, err := a.STree.cloneShared()
+	if err != nil {
+		return AliasedSTree{}, fmt.Errorf("SetVal clone error: %v", err)
+	}
+	s, err := clone.setValIn(path, val)
+	if err != nil {
+		return AliasedSTree{}, err
+	}
+	return AliasedSTree{s}, nil
+}
+
+func (a AliasedSTree) SetValMust(path string, val interface{}) AliasedSTree {
+	u, err := a.SetVal(path, val)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// Delete returns a copy of the AliasedSTree with the value at path removed, as by
+// STree.Delete, in which values shared in a are shared in the same way.
+func (a AliasedSTree) Delete(path string) (AliasedSTree, error) {
+	clone, err := a.STree.cloneShared()
+	if err != nil {
+		return AliasedSTree{}, fmt.Errorf("Delete clone error: %v", err)
+	}
+	s, err := clone.deleteAllIn([]string{path})
+	if err != nil {
+		return AliasedSTree{}, err
+	}
+	return AliasedSTree{s}, nil
+}
+
+func (a AliasedSTree) DeleteMust(path string) AliasedSTree {
+	u, err := a.Delete(path)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// WriteYaml marshals the AliasedSTree as yaml. STrees and slices referenced from
+// more than one place are written once under an anchor and elsewhere as aliases
+// of it, and << keys are written as merge keys.
+func (a AliasedSTree) WriteYaml() ([]byte, error) {
+	refs := map[interface{}]int{}
+	aliased := countRefs(a.STree, refs)
+	for _, n := range refs {
+		aliased = aliased || n > 1
+	}
+	if aliased {
+		return a.STree.writeYamlAliased(refs)
+	}
+	return a.STree.WriteYaml()
+}
+
+// mergeKey is the key under which YamlAliasKeep stores merged mappings.
+const mergeKey = "<<"
+
+// unmarshal parses the yaml document in data according to the alias mode.
+func (c *yamlCodec) unmarshal(data []byte) (STree, error) {
+
+	var t STree
+	if c.aliases == YamlAliasExpand {
+		if err := yaml.Unmarshal(data, &t); err != nil {
+			return nil, fmt.Errorf("error in yaml.Unmarshal: %v", err)
+		}
+		return t, nil
+	}
+
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error in yaml3.Unmarshal: %v", err)
+	}
+	if doc.Kind != yaml3.DocumentNode || len(doc.Content) < 1 {
+		return nil, nil
+	}
+
+	d := &yamlNodeDecoder{
+		keep:    c.aliases == YamlAliasKeep,
+		anchors: map[*yaml3.Node]interface{}{},
+		active:  map[*yaml3.Node]bool{},
+	}
+	v, err := d.decode(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	t, ok := v.(STree)
+	if !ok {
+		return nil, fmt.Errorf("document root is not a mapping")
+	}
+
+	if c.aliases == YamlAliasResolve {
+		if err = resolveMerges(t, map[interface{}]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// yamlNodeDecoder builds STree values from a yaml node tree, with merge keys kept
+// as << keys. If keep is set, each anchored mapping and sequence is decoded once
+// and shared by its aliases. An alias of a node still being decoded, which would
+// make the result recursive, is an error, as is excessive alias expansion, which
+// is limited as by yaml.v3.
+type yamlNodeDecoder struct {
+	keep       bool
+	anchors    map[*yaml3.Node]interface{}
+	active     map[*yaml3.Node]bool
+	decodes    int
+	aliased    int
+	aliasDepth int
+}
+
+// yaml.v3 allows up to 99% of the values of documents of up to 400,000 values to
+// come from alias expansion, and 10% of those of 4,000,000 values or more
+const (
+	yamlAliasRangeLow  = 400000
+	yamlAliasRangeHigh = 4000000
+)
+
+// allowedYamlAliasRatio returns the fraction of the values decoded so far which
+// may come from alias expansion.
+func allowedYamlAliasRatio(decodes int) float64 {
+	switch {
+	case decodes <= yamlAliasRangeLow:
+		return 0.99
+	case decodes >= yamlAliasRangeHigh:
+		return 0.10
+	}
+	return 0.99 - 0.89*float64(decodes-yamlAliasRangeLow)/float64(yamlAliasRangeHigh-yamlAliasRangeLow)
+}
+
+func (d *yamlNodeDecoder) decode(n *yaml3.Node) (interface{}, error) {
+
+	d.decodes++
+	if d.aliasDepth > 0 {
+		d.aliased++
+	}
+	if d.aliased > 100 && d.decodes > 1000 && float64(d.aliased)/float64(d.decodes) > allowedYamlAliasRatio(d.decodes) {
+		return nil, fmt.Errorf("document contains excessive aliasing")
+	}
+
+	switch n.Kind {
+
+	case yaml3.AliasNode:
+		if d.active[n.Alias] {
+			return nil, fmt.Errorf("anchor '%s' value contains itself", n.Value)
+		}
+		if v, ok := d.anchors[n.Alias]; ok && d.keep {
+			return v, nil
+		}
+		d.aliasDepth++
+		defer func() { d.aliasDepth-- }()
+		return d.decode(n.Alias)
+
+	case yaml3.MappingNode:
+		d.active[n] = true
+		defer delete(d.active, n)
+		t := STree{}
+		if d.keep {
+			d.anchors[n] = t
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, err := yamlKeyVal(n.Content[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			t[k] = v
+		}
+		return t, nil
+
+	case yaml3.SequenceNode:
+		d.active[n] = true
+		defer delete(d.active, n)
+		s := make([]interface{}, len(n.Content))
+		if d.keep {
+			d.anchors[n] = s
+		}
+		for i, e := range n.Content {
+			v, err := d.decode(e)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		return s, nil
+
+	case yaml3.ScalarNode:
+		return yamlScalarVal(n)
+	}
+
+	return nil, fmt.Errorf("unexpected yaml node at line %d", n.Line)
+}
+
+// yamlKeyVal returns the STree key read from the key node k.
+func yamlKeyVal(k *yaml3.Node) (interface{}, error) {
+	if k.Tag == "!!merge" {
+		return mergeKey, nil
+	}
+	if k.Kind != yaml3.ScalarNode {
+		return nil, fmt.Errorf("invalid map key at line %d", k.Line)
+	}
+	return yamlScalarVal(k)
+}
+
+// yamlScalarVal returns the value of the scalar node n, typed as yaml.v2 would
+// type it so that the result agrees with the default mode.
+func yamlScalarVal(n *yaml3.Node) (interface{}, error) {
+
+	if n.Style&yaml3.TaggedStyle != 0 {
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, fmt.Errorf("error decoding scalar at line %d: %v", n.Line, err)
+		}
+		return v, nil
+	} else if n.Style != 0 {
+		return n.Value, nil
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(n.Value), &v); err != nil || (v != nil && !IsPrimitive(v)) {
+		return n.Value, nil
+	}
+	return v, nil
+}
+
+// ResolveMerges returns a copy of the STree with each << key, as kept by
+// YamlAliasKeep, replaced by the keys of the STrees it holds which the mapping
+// lacks. Earlier STrees in a slice of merged STrees take precedence.
+func (t STree) ResolveMerges() (STree, error) {
+
+	clone, err := t.clone()
+	if err != nil {
+		return nil, fmt.Errorf("ResolveMerges clone error: %v", err)
+	}
+
+	if err = resolveMerges(clone, map[interface{}]bool{}); err != nil {
+		return nil, fmt.Errorf("ResolveMerges %v", err)
+	}
+	return clone, nil
+}
+
+// resolveMerges applies the merge keys within v in place, visiting each shared
+// STree or slice once.
+func resolveMerges(v interface{}, seen map[interface{}]bool) error {
+
+	if id, ok := valueId(v); ok {
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+	}
+
+	switch tv := v.(type) {
+
+	case STree:
+		for _, kv := range tv {
+			if err := resolveMerges(kv, seen); err != nil {
+				return err
+			}
+		}
+
+		merged, ok := tv[mergeKey]
+		if !ok {
+			return nil
+		}
+		delete(tv, mergeKey)
+
+		sources := []interface{}{merged}
+		if s, isSlice := merged.([]interface{}); isSlice {
+			sources = s
+		}
+		for _, src := range sources {
+			sTree, ok := src.(STree)
+			if !ok {
+				return fmt.Errorf("map merge requires map or sequence of maps as the value")
+			}
+			for k, sv := range sTree {
+				if _, ok := tv[k]; !ok {
+					tv[k] = sv
+				}
+			}
+		}
+
+	case []interface{}:
+		for _, e := range tv {
+			if err := resolveMerges(e, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// valueId returns a value identifying the STree or non-empty slice v, equal for
+// any two references to the same underlying map or array.
+func valueId(v interface{}) (interface{}, bool) {
+	switch tv := v.(type) {
+	case STree:
+		if tv != nil {
+			return reflect.ValueOf(tv).Pointer(), true
+		}
+	case []interface{}:
+		if len(tv) > 0 {
+			return sliceId{&tv[0], len(tv)}, true
+		}
+	}
+	return nil, false
+}
+
+// countRefs counts the references to each STree and slice within v, and reports
+// whether any << key is present.
+func countRefs(v interface{}, refs map[interface{}]int) bool {
+
+	if id, ok := valueId(v); ok {
+		if refs[id]++; refs[id] > 1 {
+			return false
+		}
+	}
+
+	merge := false
+	switch tv := v.(type) {
+	case STree:
+		for k, kv := range tv {
+			merge = countRefs(kv, refs) || merge || k == mergeKey
+		}
+	case []interface{}:
+		for _, e := range tv {
+			merge = countRefs(e, refs) || merge
+		}
+	}
+	return merge
+}
+
+// yamlAnchors builds the yaml node tree of an STree, writing values referenced
+// more than once as an anchor followed by aliases.
+type yamlAnchors struct {
+	refs  map[interface{}]int
+	nodes map[interface{}]*yaml3.Node
+	names map[string]bool
+}
+
+// writeYamlAliased marshals the STree as STree.WriteYaml does, but with shared values
+// written as anchors and aliases, and << keys as merge keys. Anchors are named
+// after the key at which the value is first written.
+func (s STree) writeYamlAliased(refs map[interface{}]int) ([]byte, error) {
+
+	a := &yamlAnchors{refs: refs, nodes: map[interface{}]*yaml3.Node{}, names: map[string]bool{}}
+	root, err := a.node("root", s)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	e := yaml3.NewEncoder(&buf)
+	e.SetIndent(2)
+	if err = e.Encode(root); err != nil {
+		return nil, fmt.Errorf("WriteYaml error in Encode: %v", err)
+	}
+	if err = e.Close(); err != nil {
+		return nil, fmt.Errorf("WriteYaml error in Close: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (a *yamlAnchors) node(name string, v interface{}) (*yaml3.Node, error) {
+
+	id, hasId := valueId(v)
+	if n, ok := a.nodes[id]; hasId && ok {
+		return &yaml3.Node{Kind: yaml3.AliasNode, Alias: n, Value: n.Anchor}, nil
+	}
+
+	var n *yaml3.Node
+	switch tv := v.(type) {
+
+	case STree:
+		n = &yaml3.Node{Kind: yaml3.MappingNode}
+		a.anchor(id, hasId, name, n)
+		keys := tv.sortedKeys()
+		if _, ok := tv[mergeKey]; ok {
+			keys = append([]interface{}{mergeKey}, keys...)
+		}
+		for i, k := range keys {
+			if k == mergeKey && i > 0 {
+				continue
+			}
+			kNode, err := yamlScalarNode(k)
+			if err != nil {
+				return nil, err
+			}
+			kName := keyString(k)
+			if k == mergeKey {
+				kNode, kName = &yaml3.Node{Kind: yaml3.ScalarNode, Value: mergeKey}, name
+			}
+			vNode, err := a.node(kName, tv[k])
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, kNode, vNode)
+		}
+
+	case []interface{}:
+		n = &yaml3.Node{Kind: yaml3.SequenceNode}
+		a.anchor(id, hasId, name, n)
+		for i, e := range tv {
+			eNode, err := a.node(fmt.Sprintf("%s-%d", name, i), e)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, eNode)
+		}
+
+	default:
+		return yamlScalarNode(v)
+	}
+
+	return n, nil
+}
+
+// anchor names the node n of a value referenced more than once.
+func (a *yamlAnchors) anchor(id interface{}, hasId bool, name string, n *yaml3.Node) {
+
+	if !hasId || a.refs[id] < 2 {
+		return
+	}
+
+	name = strings.Trim(strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, name), "-")
+	if len(name) < 1 {
+		name = "anchor"
+	}
+
+	anchor := name
+	for i := 2; a.names[anchor]; i++ {
+		anchor = fmt.Sprintf("%s-%d", name, i)
+	}
+	a.names[anchor] = true
+	n.Anchor = anchor
+	a.nodes[id] = n
+}
+
+// yamlScalarNode returns a scalar node holding the primitive v, written in the
+// style yaml.v2 would use so that it reads back as the same value.
+func yamlScalarNode(v interface{}) (*yaml3.Node, error) {
+
+	s, isStr := v.(string)
+	if !isStr || v == nil || isBigNumber(v) {
+		return &yaml3.Node{Kind: yaml3.ScalarNode, Value: flowScalar(v)}, nil
+	}
+
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("WriteYaml error in yaml.Marshal: %v", err)
+	}
+	n := &yaml3.Node{Kind: yaml3.ScalarNode, Tag: "!!str", Value: s}
+	switch out[0] {
+	case '"':
+		n.Style = yaml3.DoubleQuotedStyle
+	case '\'':
+		n.Style = yaml3.SingleQuotedStyle
+	case '|', '>':
+		n.Style = yaml3.LiteralStyle
+	default:
+		n.Tag = ""
+	}
+	return n, nil
+}
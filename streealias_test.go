@@ -0,0 +1,186 @@
+package gostree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestYamlAliases(t *testing.T) {
+
+	defer log.Flush()
+
+	config := `.defaults: &defaults
+  image: golang
+  env: &env
+    CGO_ENABLED: "0"
+  tags: &tags [linux, docker]
+build:
+  image: golang:alpine
+  <<: *defaults
+  script: make
+test:
+  <<: [*defaults, {stage: test}]
+  env: *env
+  runners: *tags
+`
+
+	Convey("Test YamlAliasExpand and YamlAliasResolve\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(config))
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".build.image"), ShouldEqual, "golang")
+		So(s.StrValMust(".test.env.CGO_ENABLED"), ShouldEqual, "0")
+
+		r, err := NewSTreeYaml(strings.NewReader(config), WithYamlAliases(YamlAliasResolve))
+		So(err, ShouldBeNil)
+		So(r.StrValMust(".build.image"), ShouldEqual, "golang:alpine")
+		So(r.StrValMust(".build.script"), ShouldEqual, "make")
+		So(r.StrValMust(".test.image"), ShouldEqual, "golang")
+		So(r.StrValMust(".test.stage"), ShouldEqual, "test")
+		So(r.StrValMust(".test.runners[1]"), ShouldEqual, "docker")
+		So(r.Keys(), ShouldHaveLength, 3)
+		_, hasMerge := r.STreeValMust(".build")[mergeKey]
+		So(hasMerge, ShouldBeFalse)
+
+		r, err = r.SetVal(`.\.defaults.env.CGO_ENABLED`, "1")
+		So(err, ShouldBeNil)
+		So(r.StrValMust(".test.env.CGO_ENABLED"), ShouldEqual, "0")
+
+		out, err := r.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldNotContainSubstring, "*")
+
+		_, err = NewSTreeYaml(strings.NewReader("a: &a x\nb:\n  <<: *a\n"), WithYamlAliases(YamlAliasResolve))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test YamlAliasKeep\n", t, func() {
+		s, err := NewAliasedSTreeYaml(strings.NewReader(config))
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".build.image"), ShouldEqual, "golang:alpine")
+		So(s.StrValMust(".build.<<.image"), ShouldEqual, "golang")
+		So(s.StrValMust(".test.env.CGO_ENABLED"), ShouldEqual, "0")
+
+		u, err := s.SetVal(".test.env.CGO_ENABLED", "1")
+		So(err, ShouldBeNil)
+		So(u.StrValMust(`.\.defaults.env.CGO_ENABLED`), ShouldEqual, "1")
+		So(s.StrValMust(`.\.defaults.env.CGO_ENABLED`), ShouldEqual, "0")
+
+		u, err = u.SetVal(`.\.defaults.image`, "golang:1.22")
+		So(err, ShouldBeNil)
+		So(u.StrValMust(".build.<<.image"), ShouldEqual, "golang:1.22")
+		So(u.StrValMust(".test.<<[0].image"), ShouldEqual, "golang:1.22")
+
+		r, err := u.ResolveMerges()
+		So(err, ShouldBeNil)
+		So(r.StrValMust(".build.image"), ShouldEqual, "golang:alpine")
+		So(r.StrValMust(".test.image"), ShouldEqual, "golang:1.22")
+		So(r.StrValMust(".test.stage"), ShouldEqual, "test")
+		So(u.StrValMust(".build.<<.image"), ShouldEqual, "golang:1.22")
+
+		out, err := u.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `.defaults: &defaults
+  env: &env
+    CGO_ENABLED: "1"
+  image: golang:1.22
+  tags: &tags
+    - linux
+    - docker
+build:
+  <<: *defaults
+  image: golang:alpine
+  script: make
+test:
+  <<:
+    - *defaults
+    - stage: test
+  env: *env
+  runners: *tags
+`)
+
+		v, err := NewAliasedSTreeYaml(strings.NewReader(string(out)))
+		So(err, ShouldBeNil)
+		v, err = v.SetVal(".test.env.CGO_ENABLED", "0")
+		So(err, ShouldBeNil)
+		So(v.StrValMust(`.\.defaults.env.CGO_ENABLED`), ShouldEqual, "0")
+
+		d, err := v.Delete(`.\.defaults.env.CGO_ENABLED`)
+		So(err, ShouldBeNil)
+		So(d.STreeValMust(".test.env"), ShouldBeEmpty)
+
+		p, err := v.STree.SetVal(".test.env.CGO_ENABLED", "1")
+		So(err, ShouldBeNil)
+		So(p.StrValMust(`.\.defaults.env.CGO_ENABLED`), ShouldEqual, "0")
+	})
+
+	Convey("Test shared values of an STree are copied separately\n", t, func() {
+		m := STree{"x": 1}
+		s := STree{"a": m, "b": m}
+
+		u, err := s.SetVal(".a.x", 99)
+		So(err, ShouldBeNil)
+		So(u.IntValMust(".a.x"), ShouldEqual, 99)
+		So(u.IntValMust(".b.x"), ShouldEqual, 1)
+		So(m["x"], ShouldEqual, 1)
+
+		out, err := s.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "a:\n  x: 1\nb:\n  x: 1\n")
+
+		k, err := NewSTreeYaml(strings.NewReader(config), WithYamlAliases(YamlAliasKeep))
+		So(err, ShouldBeNil)
+		k, err = k.SetVal(`.\.defaults.image`, "golang:1.22")
+		So(err, ShouldBeNil)
+		So(k.StrValMust(".build.<<.image"), ShouldEqual, "golang")
+		out, err = k.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldNotContainSubstring, "*")
+	})
+
+	Convey("Test WriteYaml anchor names\n", t, func() {
+		shared := STree{"a": 1}
+		s := AliasedSTree{STree{"x y": shared, "z": []interface{}{shared, shared}}}
+		out, err := s.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "x y: &x-y\n  a: 1\nz:\n  - *x-y\n  - *x-y\n")
+
+		out, err = AliasedSTree{STree{"a": STree{"b": 1}}}.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "a:\n  b: 1\n")
+	})
+
+	Convey("Test recursive and excessive aliases\n", t, func() {
+		for _, doc := range []string{"a: &x [*x]\n", "a: &x {b: *x}\n", "a: &x {b: 1, <<: *x}\n"} {
+			for _, mode := range []YamlAliasMode{YamlAliasExpand, YamlAliasResolve, YamlAliasKeep} {
+				_, err := NewSTreeYaml(strings.NewReader(doc), WithYamlAliases(mode))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "anchor 'x' value contains itself")
+			}
+		}
+
+		s, err := NewSTreeYaml(strings.NewReader("a: &x [1]\nb: [*x, *x]\n"), WithYamlAliases(YamlAliasKeep))
+		So(err, ShouldBeNil)
+		So(s.IntValMust(".b[1][0]"), ShouldEqual, 1)
+
+		laughs := "a: &a [lol, lol, lol, lol, lol, lol, lol, lol, lol]\n"
+		for c := 'b'; c <= 'g'; c++ {
+			laughs += fmt.Sprintf("%c: &%c [*%c, *%c, *%c, *%c, *%c, *%c, *%c, *%c, *%c]\n", c, c, c-1, c-1, c-1, c-1, c-1, c-1, c-1, c-1, c-1)
+		}
+		start := time.Now()
+		_, err = NewSTreeYaml(strings.NewReader(laughs), WithYamlAliases(YamlAliasResolve))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "excessive aliasing")
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+
+		k, err := NewSTreeYaml(strings.NewReader(laughs), WithYamlAliases(YamlAliasKeep))
+		So(err, ShouldBeNil)
+		So(k.StrValMust(".g[8][8][8][8][8][8][8]"), ShouldEqual, "lol")
+	})
+}
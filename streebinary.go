@@ -0,0 +1,143 @@
+package gostree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// maxBinaryDepth bounds the nesting of arrays and maps read by the binary
+// decoders, so that hostile input cannot exhaust the stack.
+const maxBinaryDepth = 10000
+
+var errBinaryEOF = errors.New("unexpected end of data")
+
+// binaryReader reads the big-endian items shared by the MessagePack and CBOR
+// decoders from an in-memory document.
+type binaryReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *binaryReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errBinaryEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// bytes returns the next n bytes, checking n against the remaining data before
+// anything is allocated on the strength of a declared length.
+func (r *binaryReader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, errBinaryEOF
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// uint returns the next n byte big-endian unsigned integer.
+func (r *binaryReader) uint(n int) (uint64, error) {
+	b, err := r.bytes(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// length checks a declared item count against the remaining data, given that
+// each item takes at least one byte, and returns it as an int.
+func (r *binaryReader) length(n uint64) (int, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return 0, errBinaryEOF
+	}
+	return int(n), nil
+}
+
+// intVal returns i as an int, as integers are stored for yaml, unless it
+// overflows an int on this platform.
+func intVal(i int64) interface{} {
+	if int64(int(i)) == i {
+		return int(i)
+	}
+	return i
+}
+
+// uintVal returns u as an int if it fits, or else as a uint64.
+func uintVal(u uint64) interface{} {
+	if u <= math.MaxInt64 {
+		return intVal(int64(u))
+	}
+	return u
+}
+
+// binaryKey returns v for use as an STree key, converting binary keys to
+// strings. Composite keys are rejected, as are bignums and NaN, which as keys
+// could not be addressed by any path.
+func binaryKey(v interface{}) (interface{}, error) {
+	if b, ok := v.([]byte); ok {
+		return string(b), nil
+	}
+	if v != nil && !IsPrimitive(v) {
+		return nil, fmt.Errorf("map key of type %s is not a scalar", kindName(v))
+	}
+	if isBigNumber(v) {
+		return nil, fmt.Errorf("map key %s beyond 64 bits is not supported", bigNumberJson(v))
+	}
+	if f, ok := v.(float64); ok && math.IsNaN(f) {
+		return nil, fmt.Errorf("map key NaN is not supported")
+	}
+	return v, nil
+}
+
+// binaryNumber classifies the number v for the binary writers, returning it as
+// an int64, a uint64, a float32, a float64 or a *big.Int outside 64 bits.
+func binaryNumber(v interface{}) (interface{}, bool) {
+
+	switch tv := v.(type) {
+	case json.Number:
+		if isJsonInteger(tv.String()) {
+			if i, err := tv.Int64(); err == nil {
+				return i, true
+			}
+			if b, ok := new(big.Int).SetString(tv.String(), 10); ok {
+				return binaryNumber(b)
+			}
+		}
+		f, err := tv.Float64()
+		return f, err == nil
+	case *big.Int:
+		if tv.IsInt64() {
+			return tv.Int64(), true
+		} else if tv.IsUint64() {
+			return tv.Uint64(), true
+		}
+		return tv, true
+	case *big.Float:
+		f, _ := tv.Float64()
+		return f, true
+	case float32:
+		return tv, true
+	}
+
+	val := reflect.ValueOf(v)
+	switch k := val.Kind(); {
+	case isIntKind(k):
+		return val.Int(), true
+	case isUintKind(k):
+		return val.Uint(), true
+	case isFloatKind(k):
+		return val.Float(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,421 @@
+package gostree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// CBOR tags given special treatment, as listed in RFC 8949 section 3.4
+const (
+	cborTagDateTime  = 0
+	cborTagEpoch     = 1
+	cborTagPosBignum = 2
+	cborTagNegBignum = 3
+)
+
+const (
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+// NewSTreeCbor reads CBOR from the specified reader and returns the structure
+// as an STree. Integers are stored as int, or as uint64 or *big.Int beyond the
+// int range, including bignums, floats of every width as float64, byte strings
+// as []byte and both forms of date and time as RFC 3339 strings; other tags are
+// dropped in favor of the values they enclose. Undefined is stored as nil. Map
+// keys may be any scalar, with byte string keys stored as strings. The root
+// must be a map.
+func NewSTreeCbor(r io.Reader) (STree, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return nil, fmt.Errorf("NewSTreeCbor error reading bytes: %v", err)
+	}
+
+	d := cborDecoder{binaryReader{data: buf.Bytes()}}
+	v, err := d.decode(0)
+	if err == nil && d.pos < len(d.data) {
+		err = fmt.Errorf("invalid data after top-level value")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("NewSTreeCbor error at offset %d: %w", d.pos, err)
+	}
+
+	stree, ok := v.(STree)
+	if !ok {
+		return nil, fmt.Errorf("NewSTreeCbor found root of kind %s, expected a map", kindName(v))
+	}
+	return stree, nil
+}
+
+type cborDecoder struct {
+	binaryReader
+}
+
+// atBreak consumes the break ending an indefinite length item and returns true,
+// or returns false if the next byte is not a break.
+func (d *cborDecoder) atBreak() bool {
+	if d.pos < len(d.data) && d.data[d.pos] == cborBreak {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// head reads the initial byte of a data item and its argument, returning the
+// major type, the additional information and the argument, which is zero for
+// indefinite lengths and holds the bits of floats.
+func (d *cborDecoder) head() (major, info byte, arg uint64, err error) {
+
+	b, err := d.byte()
+	if err != nil {
+		return
+	}
+	major, info = b>>5, b&0x1f
+
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		arg, err = d.uint(1 << (info - 24))
+	case info == cborIndefinite:
+		if b == cborBreak {
+			err = fmt.Errorf("unexpected break")
+		} else if major == cborUint || major == cborNegInt || major == cborTag {
+			err = fmt.Errorf("invalid indefinite length for major type %d", major)
+		}
+	default:
+		err = fmt.Errorf("reserved additional information %d", info)
+	}
+	return
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+
+	if depth > maxBinaryDepth {
+		return nil, fmt.Errorf("nesting exceeds %d levels", maxBinaryDepth)
+	}
+
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		return uintVal(arg), nil
+	case cborNegInt:
+		if arg <= math.MaxInt64 {
+			return intVal(-1 - int64(arg)), nil
+		}
+		n := new(big.Int).SetUint64(arg)
+		return n.Neg(n).Sub(n, big.NewInt(1)), nil
+	case cborBytes, cborText:
+		s, err := d.decodeString(major, info, arg)
+		if err != nil || major == cborText {
+			return string(s), err
+		}
+		return s, nil
+	case cborArray:
+		return d.decodeArray(info, arg, depth)
+	case cborMap:
+		return d.decodeMap(info, arg, depth)
+	case cborTag:
+		return d.decodeTag(arg, depth)
+	}
+
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+	return nil, fmt.Errorf("unsupported simple value %d", arg)
+}
+
+// decodeString decodes the content of a byte or text string, joining the chunks
+// of an indefinite length string.
+func (d *cborDecoder) decodeString(major, info byte, arg uint64) ([]byte, error) {
+
+	if info != cborIndefinite {
+		s, err := d.bytes(arg)
+		return append([]byte{}, s...), err
+	}
+
+	result := []byte{}
+	for !d.atBreak() {
+		cMajor, cInfo, cArg, err := d.head()
+		if err != nil {
+			return nil, err
+		} else if cMajor != major || cInfo == cborIndefinite {
+			return nil, fmt.Errorf("invalid chunk of major type %d in indefinite length string", cMajor)
+		}
+		s, err := d.bytes(cArg)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s...)
+	}
+	return result, nil
+}
+
+func (d *cborDecoder) decodeArray(info byte, arg uint64, depth int) (interface{}, error) {
+
+	if info == cborIndefinite {
+		result := []interface{}{}
+		for !d.atBreak() {
+			e, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, e)
+		}
+		return result, nil
+	}
+
+	size, err := d.length(arg)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, size)
+	for i := range result {
+		if result[i], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (d *cborDecoder) decodeMap(info byte, arg uint64, depth int) (interface{}, error) {
+
+	size := -1
+	if info != cborIndefinite {
+		var err error
+		if size, err = d.length(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	result := STree{}
+	for i := 0; ; i++ {
+		if size < 0 && d.atBreak() || size >= 0 && i >= size {
+			break
+		}
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if k, err = binaryKey(k); err != nil {
+			return nil, err
+		}
+		if result[k], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (d *cborDecoder) decodeTag(tag uint64, depth int) (interface{}, error) {
+
+	v, err := d.decode(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case cborTagDateTime:
+		if _, ok := v.(string); !ok {
+			return nil, fmt.Errorf("found tag %d enclosing %s, expected a string", tag, kindName(v))
+		}
+	case cborTagEpoch:
+		f, ok := numericVal(v)
+		if !ok {
+			return nil, fmt.Errorf("found tag %d enclosing %s, expected a number", tag, kindName(v))
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano), nil
+	case cborTagPosBignum, cborTagNegBignum:
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("found tag %d enclosing %s, expected bytes", tag, kindName(v))
+		}
+		n := new(big.Int).SetBytes(b)
+		if tag == cborTagNegBignum {
+			n.Neg(n).Sub(n, big.NewInt(1))
+		}
+		if n.IsInt64() {
+			return intVal(n.Int64()), nil
+		} else if n.IsUint64() {
+			return n.Uint64(), nil
+		}
+		return n, nil
+	}
+	return v, nil
+}
+
+// halfFloat returns the value of the IEEE 754 half precision float h.
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// WriteCbor marshals the STree as CBOR, writing each integer in its smallest
+// encoding, integers beyond 64 bits as bignums and map keys in sorted order.
+// *big.Float values are written as float64.
+func (s STree) WriteCbor() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeCbor(buf, FieldPath{}, s); err != nil {
+		return nil, fmt.Errorf("WriteCbor %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCborHead writes the initial byte of a data item of the major type and
+// the argument n, in the smallest encoding of n.
+func writeCborHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		writeCborBits(buf, n, 1)
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		writeCborBits(buf, n, 2)
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		writeCborBits(buf, n, 4)
+	default:
+		buf.WriteByte(major | 27)
+		writeCborBits(buf, n, 8)
+	}
+}
+
+func writeCbor(buf *bytes.Buffer, path FieldPath, v interface{}) error {
+
+	switch tv := v.(type) {
+	case nil:
+		buf.WriteByte(cborSimple<<5 | 22)
+		return nil
+	case bool:
+		if tv {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+		return nil
+	case string:
+		writeCborHead(buf, cborText, uint64(len(tv)))
+		buf.WriteString(tv)
+		return nil
+	case []byte:
+		writeCborHead(buf, cborBytes, uint64(len(tv)))
+		buf.Write(tv)
+		return nil
+	case time.Time:
+		writeCborHead(buf, cborTag, cborTagDateTime)
+		return writeCbor(buf, path, tv.Format(time.RFC3339Nano))
+	case []interface{}:
+		writeCborHead(buf, cborArray, uint64(len(tv)))
+		for i, e := range tv {
+			if err := writeCbor(buf, indexPath(path, i), e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[interface{}]interface{}:
+		return writeCbor(buf, path, STree(tv))
+	case STree:
+		writeCborHead(buf, cborMap, uint64(len(tv)))
+		for _, k := range tv.sortedKeys() {
+			kPath := path.append(keyComponent(k))
+			if err := writeCbor(buf, kPath, k); err != nil {
+				return err
+			}
+			if err := writeCbor(buf, kPath, tv[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	n, ok := binaryNumber(v)
+	if !ok {
+		return fmt.Errorf("found unsupported value of type %T at %s", v, path)
+	}
+	switch tn := n.(type) {
+	case int64:
+		if tn >= 0 {
+			writeCborHead(buf, cborUint, uint64(tn))
+		} else {
+			writeCborHead(buf, cborNegInt, uint64(-1-tn))
+		}
+	case uint64:
+		writeCborHead(buf, cborUint, tn)
+	case float32:
+		buf.WriteByte(cborSimple<<5 | 26)
+		writeCborBits(buf, uint64(math.Float32bits(tn)), 4)
+	case float64:
+		buf.WriteByte(cborSimple<<5 | 27)
+		writeCborBits(buf, math.Float64bits(tn), 8)
+	case *big.Int:
+		tag, m := uint64(cborTagPosBignum), tn
+		if tn.Sign() < 0 {
+			tag, m = cborTagNegBignum, new(big.Int).Sub(new(big.Int).Neg(tn), big.NewInt(1))
+		}
+		writeCborHead(buf, cborTag, tag)
+		b := m.Bytes()
+		writeCborHead(buf, cborBytes, uint64(len(b)))
+		buf.Write(b)
+	}
+	return nil
+}
+
+// writeCborBits writes the low n bytes of u in big-endian order.
+func writeCborBits(buf *bytes.Buffer, u uint64, n int) {
+	for shift := 8 * (n - 1); shift >= 0; shift -= 8 {
+		buf.WriteByte(byte(u >> uint(shift)))
+	}
+}
@@ -0,0 +1,128 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestCbor(t *testing.T) {
+
+	defer log.Flush()
+
+	Convey("Test WriteCbor and NewSTreeCbor against json\n", t, func() {
+		for _, opts := range [][]JsonOption{nil, {WithJsonNumbers(JsonNumberExact)}} {
+			s, err := NewSTreeJson(strings.NewReader(binaryJson), opts...)
+			So(err, ShouldBeNil)
+
+			out, err := s.WriteCbor()
+			So(err, ShouldBeNil)
+			c, err := NewSTreeCbor(bytes.NewReader(out))
+			So(err, ShouldBeNil)
+
+			comp, err := s.CompareTo(c)
+			So(err, ShouldBeNil)
+			So(comp, ShouldHaveLength, len(s.FieldPaths()))
+			for _, r := range comp {
+				So(r, ShouldEqual, COMP_NO_DIFFERENCE)
+			}
+			comp, err = c.CompareTo(s)
+			So(err, ShouldBeNil)
+			for _, r := range comp {
+				So(r, ShouldEqual, COMP_NO_DIFFERENCE)
+			}
+		}
+	})
+
+	Convey("Test cbor value mapping\n", t, func() {
+		huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+		s := STree{
+			"bin":  []byte{0, 1, 2},
+			"ints": []interface{}{0, 23, 24, -24, -25, -257, math.MinInt64, uint64(math.MaxUint64)},
+			"huge": huge,
+			"f32":  float32(0.5),
+			"keys": STree{1: "one", true: "yes", 2.5: "two and a half", nil: "none"},
+		}
+		out, err := s.WriteCbor()
+		So(err, ShouldBeNil)
+		c, err := NewSTreeCbor(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(c, ShouldResemble, STree{
+			"bin":  []byte{0, 1, 2},
+			"ints": []interface{}{0, 23, 24, -24, -25, -257, math.MinInt64, uint64(math.MaxUint64)},
+			"huge": huge,
+			"f32":  0.5,
+			"keys": STree{1: "one", true: "yes", 2.5: "two and a half", nil: "none"},
+		})
+
+		out, err = STree{"a": -1}.WriteCbor()
+		So(err, ShouldBeNil)
+		So(hex.EncodeToString(out), ShouldEqual, "a1616120")
+	})
+
+	Convey("Test NewSTreeCbor input\n", t, func() {
+		// examples from RFC 8949 appendix A, each under the key "v"
+		maxUint := new(big.Int).SetUint64(math.MaxUint64)
+		cases := []struct {
+			src  string
+			want interface{}
+		}{
+			{"f93c00", 1.0},
+			{"f97bff", 65504.0},
+			{"f90001", 5.960464477539063e-08},
+			{"f9c400", -4.0},
+			{"fa47c35000", 100000.0},
+			{"1bffffffffffffffff", uint64(math.MaxUint64)},
+			{"c249010000000000000000", new(big.Int).Add(maxUint, big.NewInt(1))},
+			{"3bffffffffffffffff", new(big.Int).Neg(new(big.Int).Add(maxUint, big.NewInt(1)))},
+			{"c34101", -2},
+			{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+			{"c11a514b67b0", "2013-03-21T20:04:00Z"},
+			{"c1fb41d452d9ec200000", "2013-03-21T20:04:00.5Z"},
+			{"d74401020304", []byte{1, 2, 3, 4}},
+			{"f7", nil},
+			{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+			{"7f657374726561646d696e67ff", "streaming"},
+			{"9f018202039f0405ffff", []interface{}{1, []interface{}{2, 3}, []interface{}{4, 5}}},
+			{"bf6346756ef563416d7421ff", STree{"Fun": true, "Amt": -2}},
+			{"a201020304", STree{1: 2, 3: 4}},
+		}
+		for _, c := range cases {
+			data, _ := hex.DecodeString("a16176" + c.src)
+			s, err := NewSTreeCbor(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+			So(s["v"], ShouldResemble, c.want)
+		}
+
+		errs := []struct {
+			src, msg string
+		}{
+			{"a1616b", "NewSTreeCbor error at offset 3: unexpected end of data"},
+			{"a1616b01f6", "NewSTreeCbor error at offset 4: invalid data after top-level value"},
+			{"a1616bff", "NewSTreeCbor error at offset 4: unexpected break"},
+			{"a1616b9f01", "NewSTreeCbor error at offset 5: unexpected end of data"},
+			{"a1616b1c", "NewSTreeCbor error at offset 4: reserved additional information 28"},
+			{"a1616bf0", "NewSTreeCbor error at offset 4: unsupported simple value 16"},
+			{"a1616bc263616263", "NewSTreeCbor error at offset 8: found tag 2 enclosing string, expected bytes"},
+			{"a1810101", "NewSTreeCbor error at offset 3: map key of type slice is not a scalar"},
+			{"a1c249010000000000000000f5", "NewSTreeCbor error at offset 12: map key 18446744073709551616 beyond 64 bits is not supported"},
+			{"a1f97e00f5", "NewSTreeCbor error at offset 4: map key NaN is not supported"},
+			{"bbffffffffffffffff", "NewSTreeCbor error at offset 9: unexpected end of data"},
+			{"8101", "NewSTreeCbor found root of kind slice, expected a map"},
+		}
+		for _, e := range errs {
+			data, _ := hex.DecodeString(e.src)
+			_, err := NewSTreeCbor(bytes.NewReader(data))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, e.msg)
+		}
+	})
+}
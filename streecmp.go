@@ -2,6 +2,7 @@ package gostree
 
 import (
 	"reflect"
+	"time"
 )
 
 type FieldComparisonResult int
@@ -35,6 +36,11 @@ type ComparisonResult map[string]FieldComparisonResult
 
 var errTracker error
 
+// CompareTo compares each field of s to the same field of o. A json.Number,
+// *big.Int or *big.Float compares exactly by value to any other number, and all
+// integer types, e.g. the int of NewSTreeYaml and the int64 of JsonNumberExact,
+// compare by value to one another, while other numbers of differing types, e.g.
+// int and float64, differ in type.
 func (s STree) CompareTo(o STree) (ComparisonResult, error) {
 
 	result := map[string]FieldComparisonResult{}
@@ -48,7 +54,7 @@ func (s STree) CompareTo(o STree) (ComparisonResult, error) {
 		}
 
 		valObj, err := o.Val(fStr)
-		if valObj == nil {
+		if err != nil {
 			result[fStr] = COMP_OBJECT_LACKS
 			continue
 		}
@@ -56,9 +62,15 @@ func (s STree) CompareTo(o STree) (ComparisonResult, error) {
 		kindSubj := reflect.ValueOf(valSubj).Kind()
 		kindObj := reflect.ValueOf(valObj).Kind()
 
-		if kindSubj != kindObj {
+		if isExactNumber(valSubj) || isExactNumber(valObj) || isInteger(valSubj) && isInteger(valObj) {
+			if c, ok := compareNumbers(valSubj, valObj); ok {
+				result[fStr] = compResult(c == 0)
+			} else {
+				result[fStr] = COMP_TYPES_DIFFER
+			}
+		} else if kindSubj != kindObj {
 			result[fStr] = COMP_TYPES_DIFFER
-		} else if valObj == valSubj {
+		} else if valuesEqual(valObj, valSubj) {
 			result[fStr] = COMP_NO_DIFFERENCE
 		} else {
 			result[fStr] = COMP_VALUES_DIFFER
@@ -68,7 +80,7 @@ func (s STree) CompareTo(o STree) (ComparisonResult, error) {
 
 	for _, f := range o.FieldPaths() {
 		fStr := f.String()
-		if sVal, _ := s.Val(fStr); sVal == nil {
+		if _, err := s.Val(fStr); err != nil {
 			result[fStr] = COMP_SUBJECT_LACKS
 		}
 	}
@@ -84,3 +96,47 @@ func compResult(cond bool) (r FieldComparisonResult) {
 	}
 	return
 }
+
+// valuesEqual returns true if a and b hold the same structure and values, treating
+// all numeric types as equivalent so that e.g. yaml int 1 equals json float64 1.
+func valuesEqual(a, b interface{}) bool {
+
+	if aTree, ok := a.(STree); ok {
+		bTree, ok := b.(STree)
+		if !ok || len(aTree) != len(bTree) {
+			return false
+		}
+		for k, av := range aTree {
+			if bv, ok := bTree[k]; !ok || !valuesEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if aSlice, ok := a.([]interface{}); ok {
+		bSlice, ok := b.([]interface{})
+		if !ok || len(aSlice) != len(bSlice) {
+			return false
+		}
+		for i := range aSlice {
+			if !valuesEqual(aSlice[i], bSlice[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if aTime, ok := a.(time.Time); ok {
+		bTime, ok := b.(time.Time)
+		return ok && aTime.Equal(bTime)
+	}
+
+	if c, ok := compareNumbers(a, b); ok {
+		return c == 0
+	} else if _, ok := numericVal(a); ok {
+		return false
+	}
+
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,481 @@
+package gostree
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Decode stores the values of the STree in the struct, map or interface{} pointed
+// to by out, in the manner of yaml.Unmarshal, so that structs generated by GoStruct
+// can be populated directly from the STree they were generated from.
+//
+// Struct fields are matched to keys by their yaml tag, or failing that their json
+// tag, or failing that their name compared case insensitively. Fields tagged "-"
+// and unexported fields are ignored, and the fields of embedded structs, or of
+// fields tagged ",inline", are matched as though they belonged to the outer struct.
+// Nested structs, slices, arrays, maps and pointers are decoded recursively, with
+// pointers allocated as required, and types implementing encoding.TextUnmarshaler
+// are decoded from strings. Values of a type assignable to their destination, such
+// as the time.Time values read by NewSTreeToml, are stored as they are. Keys lacking a matching field are ignored, and fields
+// lacking a matching key are left unchanged.
+//
+// Any value which cannot be stored in its destination yields a *PathError naming
+// the FieldPath of the value, with cause ErrTypeMismatch or ErrIndexOutOfRange.
+func (t STree) Decode(out interface{}) error {
+
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("Decode requires a non-nil pointer, got %T", out)
+	}
+
+	return decodeVal(FieldPath{}, t, v.Elem())
+}
+
+// FromStruct returns an STree holding the exported fields of the struct or map v,
+// or of the struct or map v points to, keyed in the manner of Decode so that the
+// two round trip. Fields without a yaml or json tag are keyed by their lower cased
+// name, as yaml.Marshal does, and fields tagged ",omitempty" are omitted if empty.
+// Integers are stored as int and floats as float64, as they are by NewSTreeYaml,
+// and a time.Time is stored as it is, as datetimes are by NewSTreeToml.
+func FromStruct(v interface{}) (STree, error) {
+
+	val, err := encodeVal(FieldPath{}, reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := val.(STree)
+	if !ok {
+		return nil, fmt.Errorf("FromStruct requires a struct or map, got %T", v)
+	}
+	return s, nil
+}
+
+func FromStructMust(v interface{}) STree {
+	s, err := FromStruct(v)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// structField describes a struct field reachable from a struct type, possibly
+// through embedded structs.
+type structField struct {
+	name      string
+	index     []int
+	tagged    bool
+	omitEmpty bool
+}
+
+// structFields returns the fields of struct type typ which are decoded and encoded,
+// flattening embedded and inlined structs. Where several fields share a name, the
+// least deeply nested is used.
+func structFields(typ reflect.Type) []structField {
+
+	fields := []structField{}
+	byName := map[string]int{}
+
+	var collect func(typ reflect.Type, index []int)
+	collect = func(typ reflect.Type, index []int) {
+
+		for i := 0; i < typ.NumField(); i++ {
+
+			sf := typ.Field(i)
+			fIndex := append(append([]int{}, index...), i)
+
+			tag := sf.Tag.Get("yaml")
+			if len(tag) < 1 {
+				tag = sf.Tag.Get("json")
+			}
+			if tag == "-" {
+				continue
+			}
+
+			opts := strings.Split(tag, ",")
+			name, inline, omitEmpty := opts[0], false, false
+			for _, opt := range opts[1:] {
+				inline = inline || opt == "inline"
+				omitEmpty = omitEmpty || opt == "omitempty"
+			}
+
+			fType := sf.Type
+			if fType.Kind() == reflect.Ptr {
+				fType = fType.Elem()
+			}
+			if fType.Kind() == reflect.Struct && (inline || (sf.Anonymous && len(name) < 1)) {
+				if len(sf.PkgPath) < 1 || sf.Type.Kind() == reflect.Struct {
+					collect(fType, fIndex)
+				}
+				continue
+			}
+
+			if len(sf.PkgPath) > 0 {
+				continue
+			}
+
+			f := structField{name: name, index: fIndex, tagged: len(name) > 0, omitEmpty: omitEmpty}
+			if !f.tagged {
+				f.name = sf.Name
+			}
+
+			if i, ok := byName[f.name]; ok {
+				if len(fields[i].index) > len(f.index) {
+					fields[i] = f
+				}
+				continue
+			}
+			byName[f.name] = len(fields)
+			fields = append(fields, f)
+		}
+	}
+
+	collect(typ, []int{})
+	return fields
+}
+
+// fieldByIndex returns the field of struct v with the specified index. Nil embedded
+// struct pointers along the way are allocated if alloc is true, and otherwise cause
+// false to be returned.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// decodeMismatch returns the error for a value in which cannot be decoded into a
+// value of type typ.
+func decodeMismatch(path FieldPath, typ reflect.Type, in interface{}) error {
+	return &PathError{
+		Op:        "Decode",
+		Path:      path.String(),
+		Component: path.last(),
+		Expected:  typ.String(),
+		Actual:    kindName(in),
+		Err:       ErrTypeMismatch,
+	}
+}
+
+func decodeVal(path FieldPath, in interface{}, out reflect.Value) error {
+
+	if s, ok := in.(string); ok && out.CanAddr() {
+		if u, ok := out.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(s)); err != nil {
+				return &PathError{Op: "Decode", Path: path.String(), Component: path.last(),
+					Err: fmt.Errorf("%w: %v", ErrTypeMismatch, err)}
+			}
+			return nil
+		}
+	}
+
+	if in == nil {
+		out.Set(reflect.Zero(out.Type()))
+		return nil
+	}
+
+	// values such as a time.Time are stored as they are, while STrees and slices
+	// are decoded below so that the result shares no slices with the STree
+	if inVal := reflect.ValueOf(in); inVal.Type().AssignableTo(out.Type()) && !IsMap(in) && !IsSlice(in) {
+		out.Set(inVal)
+		return nil
+	}
+
+	switch k := out.Kind(); {
+
+	case k == reflect.Ptr:
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		return decodeVal(path, in, out.Elem())
+
+	case k == reflect.Interface:
+		inVal := reflect.ValueOf(in)
+		if !inVal.Type().AssignableTo(out.Type()) {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		out.Set(inVal)
+
+	case k == reflect.Struct:
+		s, ok := in.(STree)
+		if !ok {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		return decodeStruct(path, s, out)
+
+	case k == reflect.Map:
+		s, ok := in.(STree)
+		if !ok {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		if out.IsNil() {
+			out.Set(reflect.MakeMap(out.Type()))
+		}
+		for _, key := range s.sortedKeys() {
+			kPath := path.append(fmt.Sprintf("%v", key))
+			kVal := reflect.New(out.Type().Key()).Elem()
+			if err := decodeVal(kPath, key, kVal); err != nil {
+				return err
+			}
+			eVal := reflect.New(out.Type().Elem()).Elem()
+			if err := decodeVal(kPath, s[key], eVal); err != nil {
+				return err
+			}
+			out.SetMapIndex(kVal, eVal)
+		}
+
+	case k == reflect.Slice:
+		a, ok := in.([]interface{})
+		if !ok {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		sVal := reflect.MakeSlice(out.Type(), len(a), len(a))
+		for i, e := range a {
+			if err := decodeVal(indexPath(path, i), e, sVal.Index(i)); err != nil {
+				return err
+			}
+		}
+		out.Set(sVal)
+
+	case k == reflect.Array:
+		a, ok := in.([]interface{})
+		if !ok {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		if len(a) > out.Len() {
+			return &PathError{Op: "Decode", Path: path.String(), Component: path.last(),
+				Expected: fmt.Sprintf("at most %d elements", out.Len()), Actual: fmt.Sprintf("%d", len(a)),
+				Err: ErrIndexOutOfRange}
+		}
+		for i := 0; i < out.Len(); i++ {
+			var e interface{}
+			if i < len(a) {
+				e = a[i]
+			}
+			if err := decodeVal(indexPath(path, i), e, out.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case isBoolKind(k):
+		b, ok := in.(bool)
+		if !ok {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		out.SetBool(b)
+
+	case isStringKind(k):
+		s, ok := in.(string)
+		if !ok {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		out.SetString(s)
+
+	case isIntKind(k):
+		n, ok := integerVal(in)
+		if !ok || out.OverflowInt(n) {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		out.SetInt(n)
+
+	case isUintKind(k):
+		inVal := reflect.ValueOf(in)
+		if isUintKind(inVal.Kind()) {
+			if out.OverflowUint(inVal.Uint()) {
+				return decodeMismatch(path, out.Type(), in)
+			}
+			out.SetUint(inVal.Uint())
+			break
+		}
+		n, ok := integerVal(in)
+		if !ok || n < 0 || out.OverflowUint(uint64(n)) {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		out.SetUint(uint64(n))
+
+	case k == reflect.Float32 || k == reflect.Float64:
+		f, ok := numericVal(in)
+		if !ok || out.OverflowFloat(f) {
+			return decodeMismatch(path, out.Type(), in)
+		}
+		out.SetFloat(f)
+
+	default:
+		return decodeMismatch(path, out.Type(), in)
+	}
+
+	return nil
+}
+
+func decodeStruct(path FieldPath, s STree, out reflect.Value) error {
+
+	for _, f := range structFields(out.Type()) {
+
+		key := f.name
+		v, ok := s[key]
+		if !ok && !f.tagged {
+			for _, k := range s.sortedKeys() {
+				if kStr, isStr := k.(string); isStr && strings.EqualFold(kStr, f.name) {
+					key, v, ok = kStr, s[k], true
+					break
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		fVal, _ := fieldByIndex(out, f.index, true)
+		if err := decodeVal(path.append(key), v, fVal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeVal(path FieldPath, v reflect.Value) (interface{}, error) {
+
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	switch t := v.Interface().(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t != nil {
+			return *t, nil
+		}
+	}
+
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		text, err := m.MarshalText()
+		if err != nil {
+			return nil, &PathError{Op: "FromStruct", Path: path.String(), Component: path.last(),
+				Err: fmt.Errorf("%w: %v", ErrTypeMismatch, err)}
+		}
+		return string(text), nil
+	}
+
+	switch k := v.Kind(); {
+
+	case k == reflect.Ptr || k == reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return encodeVal(path, v.Elem())
+
+	case k == reflect.Struct:
+		result := STree{}
+		for _, f := range structFields(v.Type()) {
+			fVal, ok := fieldByIndex(v, f.index, false)
+			if !ok || (f.omitEmpty && isEmptyValue(fVal)) {
+				continue
+			}
+			name := f.name
+			if !f.tagged {
+				name = strings.ToLower(name)
+			}
+			e, err := encodeVal(path.append(name), fVal)
+			if err != nil {
+				return nil, err
+			}
+			result[name] = e
+		}
+		return result, nil
+
+	case k == reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		result := STree{}
+		for _, key := range v.MapKeys() {
+			kPath := path.append(fmt.Sprintf("%v", key.Interface()))
+			kConv, err := encodeVal(kPath, key)
+			if err != nil {
+				return nil, err
+			}
+			if !IsPrimitive(kConv) {
+				return nil, &PathError{Op: "FromStruct", Path: kPath.String(), Component: kPath.last(),
+					Expected: "primitive key", Actual: key.Type().String(), Err: ErrTypeMismatch}
+			}
+			e, err := encodeVal(kPath, v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			result[kConv] = e
+		}
+		return result, nil
+
+	case k == reflect.Slice || k == reflect.Array:
+		if k == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		result := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := encodeVal(indexPath(path, i), v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = e
+		}
+		return result, nil
+
+	case isBoolKind(k):
+		return v.Bool(), nil
+
+	case isStringKind(k):
+		return v.String(), nil
+
+	case isIntKind(k):
+		return int(v.Int()), nil
+
+	case isUintKind(k):
+		if v.Uint() > math.MaxInt64 {
+			return v.Uint(), nil
+		}
+		return int(v.Uint()), nil
+
+	case k == reflect.Float32 || k == reflect.Float64:
+		return v.Float(), nil
+
+	default:
+		return nil, &PathError{Op: "FromStruct", Path: path.String(), Component: path.last(),
+			Expected: "STree, slice or primitive", Actual: v.Type().String(), Err: ErrTypeMismatch}
+	}
+}
+
+// isEmptyValue reports whether v is the zero value of its kind, in the sense of the
+// omitempty tag option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
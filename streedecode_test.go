@@ -0,0 +1,244 @@
+package gostree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+type decodeBase struct {
+	ID      int    `json:"id"`
+	Created string `yaml:"created,omitempty"`
+}
+
+type DecodeMeta struct {
+	Labels map[string]string `yaml:"labels"`
+}
+
+type decodeTarget struct {
+	decodeBase
+	*DecodeMeta `yaml:",inline"`
+	Name        string          `yaml:"name"`
+	Ports       []uint16        `json:"ports"`
+	Limits      map[string]*int `yaml:"limits"`
+	Owner       *decodeOwner    `yaml:"owner"`
+	Matrix      [][]float64     `yaml:"matrix"`
+	Pair        [2]string       `yaml:"pair"`
+	When        time.Time       `yaml:"when"`
+	Extra       interface{}     `yaml:"extra"`
+	Ignored     string          `yaml:"-"`
+	Untagged    bool
+	Nested      map[string][]bool `yaml:"nested,omitempty"`
+	hidden      string
+}
+
+type decodeOwner struct {
+	Email string `yaml:"email"`
+}
+
+func TestSTreeDecode(t *testing.T) {
+
+	defer log.Flush()
+
+	yaml := `
+---
+id: 7
+name: web
+ports: [80, 443]
+labels:
+  tier: frontend
+limits:
+  cpu: 2
+  mem: null
+owner:
+  email: ops@example.com
+matrix: [[1, 2.5], [3]]
+pair: [a, b]
+when: 2020-01-02T03:04:05Z
+extra: {key1: [1, two]}
+Ignored: nope
+untagged: true
+unknown: 1
+`
+
+	Convey("Test Decode\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(yaml))
+		So(err, ShouldBeNil)
+
+		var d decodeTarget
+		So(s.Decode(&d), ShouldBeNil)
+		So(d.ID, ShouldEqual, 7)
+		So(d.Name, ShouldEqual, "web")
+		So(d.Ports, ShouldResemble, []uint16{80, 443})
+		So(d.DecodeMeta, ShouldNotBeNil)
+		So(d.Labels, ShouldResemble, map[string]string{"tier": "frontend"})
+		So(*d.Limits["cpu"], ShouldEqual, 2)
+		So(d.Limits["mem"], ShouldBeNil)
+		So(d.Owner.Email, ShouldEqual, "ops@example.com")
+		So(d.Matrix, ShouldResemble, [][]float64{{1, 2.5}, {3}})
+		So(d.Pair, ShouldResemble, [2]string{"a", "b"})
+		So(d.When.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), ShouldBeTrue)
+		So(d.Extra, ShouldResemble, STree{"key1": []interface{}{1, "two"}})
+		So(d.Ignored, ShouldBeEmpty)
+		So(d.Untagged, ShouldBeTrue)
+
+		var m map[string]interface{}
+		So(s.Decode(&m), ShouldBeNil)
+		So(m["name"], ShouldEqual, "web")
+	})
+
+	Convey("Test Decode struct generated by GoStruct\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(`
+---
+intList: [1, 2, 3]
+topLevel:
+  subStruct:
+    subList: [6, 5, 4]
+    subSubStruct: {subSubKey1: subSubVal1}
+    subKey1: subVal1
+    subKey2: 543
+intField: 432
+floatField: 8765.43
+strField: Super Hoop
+product:
+- {sku: BL394D, quantity: 4, description: Basketball, price: 450.00}
+strList: [abc, def]
+comments: none
+boolField: true
+`))
+		So(err, ShouldBeNil)
+
+		var p TestStructProto
+		So(s.Decode(&p), ShouldBeNil)
+		So(p.TopLevel.SubStruct.SubSubStruct.SubSubKey1, ShouldEqual, "subSubVal1")
+		So(p.Product[0].Price, ShouldEqual, 450)
+
+		r, err := FromStruct(&p)
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, s)
+	})
+
+	Convey("Test Decode errors\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(yaml))
+		So(err, ShouldBeNil)
+
+		for path, val := range map[string]interface{}{
+			".name":         1,
+			".ports[1]":     -1,
+			".ports[0]":     70000,
+			".matrix[1][0]": "three",
+			".owner.email":  []interface{}{},
+			".limits.cpu":   2.5,
+			".owner":        "someone",
+			".when":         "yesterday",
+			".labels.tier":  true,
+			".nested.a[0]":  "yes",
+			".untagged":     "true",
+		} {
+			b, err := s.SetVal(path, val)
+			So(err, ShouldBeNil)
+
+			var d decodeTarget
+			err = b.Decode(&d)
+			So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+			var pErr *PathError
+			So(errors.As(err, &pErr), ShouldBeTrue)
+			So(pErr.Op, ShouldEqual, "Decode")
+			So(pErr.Path, ShouldEqual, path)
+		}
+
+		b, err := s.SetVal(".pair", []interface{}{"a", "b", "c"})
+		So(err, ShouldBeNil)
+		var d decodeTarget
+		err = b.Decode(&d)
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+
+		b, err = s.SetVal(".name", 1)
+		So(err, ShouldBeNil)
+		So(b.Decode(&d).Error(), ShouldEqual, "Decode .name: type mismatch at component name (expected string, got int)")
+
+		So(s.Decode(d), ShouldNotBeNil)
+		So(s.Decode(nil), ShouldNotBeNil)
+	})
+
+	Convey("Test FromStruct\n", t, func() {
+		limit := 4
+		d := decodeTarget{
+			decodeBase: decodeBase{ID: 3},
+			Name:       "db",
+			Ports:      []uint16{5432},
+			Limits:     map[string]*int{"cpu": &limit, "mem": nil},
+			Pair:       [2]string{"x", "y"},
+			When:       time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Extra:      []string{"e"},
+			Ignored:    "ignored",
+			hidden:     "hidden",
+		}
+
+		s, err := FromStruct(d)
+		So(err, ShouldBeNil)
+		So(s, ShouldResemble, STree{
+			"id":       3,
+			"name":     "db",
+			"ports":    []interface{}{5432},
+			"limits":   STree{"cpu": 4, "mem": nil},
+			"owner":    nil,
+			"matrix":   nil,
+			"pair":     []interface{}{"x", "y"},
+			"when":     d.When,
+			"extra":    []interface{}{"e"},
+			"untagged": false,
+		})
+
+		var r decodeTarget
+		So(s.Decode(&r), ShouldBeNil)
+		So(r.When.Equal(d.When), ShouldBeTrue)
+		r.When, d.When = time.Time{}, time.Time{}
+		r.Extra, d.Extra = nil, nil
+		d.Ignored, d.hidden = "", ""
+		So(r, ShouldResemble, d)
+
+		_, err = FromStruct(struct{ C chan int }{})
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "FromStruct .c")
+		_, err = FromStruct("string")
+		So(err, ShouldNotBeNil)
+		So(func() { FromStructMust(1) }, ShouldPanic)
+	})
+
+	Convey("Test Decode and FromStruct round trip toml datetimes\n", t, func() {
+		type release struct {
+			Name     string     `toml:"name"`
+			Released time.Time  `yaml:"released"`
+			Patched  *time.Time `yaml:"patched"`
+			Dates    []time.Time
+		}
+
+		s, err := NewSTreeToml(strings.NewReader(`name = "gostree"
+released = 1979-05-27T00:32:00-07:00
+patched = 1980-01-02T03:04:05Z
+dates = [1979-05-27, 2024-02-29]
+`))
+		So(err, ShouldBeNil)
+
+		var r release
+		So(s.Decode(&r), ShouldBeNil)
+		So(r.Released.Format(time.RFC3339), ShouldEqual, "1979-05-27T00:32:00-07:00")
+		So(r.Patched.Equal(time.Date(1980, 1, 2, 3, 4, 5, 0, time.UTC)), ShouldBeTrue)
+		So(r.Dates[1], ShouldResemble, time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local))
+
+		f, err := FromStruct(r)
+		So(err, ShouldBeNil)
+		So(f, ShouldResemble, s)
+
+		out, err := f.WriteToml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldContainSubstring, "released = 1979-05-27T00:32:00-07:00\n")
+	})
+}
@@ -0,0 +1,156 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Document holds a json or yaml document whose root may be of any type, i.e. an
+// STree, a slice or a primitive, such as the top level array returned by many
+// APIs. Paths within a Document are those of STrees, with the elements of a slice
+// root addressed as .[0], .[1] and so on, and the root itself as a lone . path.
+type Document struct {
+	root interface{}
+}
+
+// NewDocument returns a Document holding root, which may be any value built of
+// maps, slices and primitives.
+func NewDocument(root interface{}) (Document, error) {
+	v, err := convertVal(root)
+	if err != nil {
+		return Document{}, fmt.Errorf("NewDocument error in convertVal: %v", err)
+	}
+	return Document{v}, nil
+}
+
+// NewDocumentJson reads a json document of any root type from the specified
+// reader, storing numbers as configured by opts.
+func NewDocumentJson(r io.Reader, opts ...JsonOption) (Document, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return Document{}, fmt.Errorf("NewDocumentJson error reading bytes: %v", err)
+	}
+
+	v, err := newJsonCodec(opts).unmarshalValue(buf.Bytes())
+	if err != nil {
+		return Document{}, fmt.Errorf("NewDocumentJson %w", err)
+	}
+	return Document{v}, nil
+}
+
+// NewDocumentYaml reads a yaml document of any root type from the specified reader.
+func NewDocumentYaml(r io.Reader) (Document, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return Document{}, fmt.Errorf("NewDocumentYaml error reading bytes: %v", err)
+	}
+
+	var uv interface{}
+	err = yaml.Unmarshal(buf.Bytes(), &uv)
+	if err != nil {
+		return Document{}, fmt.Errorf("NewDocumentYaml error in yaml.Unmarshal: %v", err)
+	}
+	v, err := convertVal(uv)
+	if err != nil {
+		return Document{}, fmt.Errorf("NewDocumentYaml error in convertVal: %v", err)
+	}
+	return Document{v}, nil
+}
+
+// Root returns the root value of the Document.
+func (d Document) Root() interface{} {
+	return d.root
+}
+
+// Tree returns the root of the Document if it is an STree, and otherwise an STree
+// holding the root under the empty key. In either case the paths of the Document
+// resolve against the result, so that all STree methods taking paths apply, e.g.
+// d.Tree().StrVal(".[0].name").
+func (d Document) Tree() STree {
+	if t, ok := d.root.(STree); ok {
+		return t
+	}
+	return STree{"": d.root}
+}
+
+// Val returns the value stored in the Document at the path.
+func (d Document) Val(path string) (interface{}, error) {
+	if path == "." {
+		return d.root, nil
+	}
+	return d.Tree().val("Val", path)
+}
+
+func (d Document) ValMust(path string) interface{} {
+	v, err := d.Val(path)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// SetVal returns a copy of the Document with val stored at path, as by STree.SetVal.
+// The path . replaces the root.
+func (d Document) SetVal(path string, val interface{}) (Document, error) {
+
+	if path == "." {
+		return NewDocument(val)
+	}
+
+	t, err := d.Tree().SetVal(path, val)
+	if err != nil {
+		return Document{}, err
+	}
+	if _, ok := d.root.(STree); ok {
+		return Document{t}, nil
+	}
+	return Document{t[""]}, nil
+}
+
+// FieldPaths returns the paths to each leaf of the Document. A primitive root has
+// the single path . and an empty slice root has none.
+func (d Document) FieldPaths() []FieldPath {
+	return d.Tree().FieldPaths()
+}
+
+// Visit traverses the Document as STree.Visit does, reporting the root under the
+// key . if it is not an STree.
+func (d Document) Visit(v Visitor) error {
+	if t, ok := d.root.(STree); ok {
+		return t.Visit(v)
+	}
+	vis := &visitation{v, nil, nil}
+	return vis.visitVal(FieldPath{""}, d.root)
+}
+
+// Query returns every value of the Document matching expr, as by STree.Query.
+func (d Document) Query(expr string) ([]Match, error) {
+	if t, ok := d.root.(STree); ok {
+		return t.Query(expr)
+	}
+	return queryFrom(Match{Path: FieldPath{""}, Val: d.root}, expr)
+}
+
+func (d Document) WriteJson(indent bool) ([]byte, error) {
+
+	v, err := unconvertVal(d.root)
+	if err != nil {
+		return nil, fmt.Errorf("WriteJson error in unconvertVal: %v", err)
+	}
+	if indent {
+		return json.MarshalIndent(v, ``, `  `)
+	}
+	return json.Marshal(v)
+}
+
+func (d Document) WriteYaml() ([]byte, error) {
+	return yaml.Marshal(d.root)
+}
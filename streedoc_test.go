@@ -0,0 +1,151 @@
+package gostree
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestDocument(t *testing.T) {
+
+	defer log.Flush()
+
+	users := `[
+		{"name": "alice", "roles": ["admin", "dev"]},
+		{"name": "bob", "roles": []}
+	]`
+
+	Convey("Test Document with a slice root\n", t, func() {
+		d, err := NewDocumentJson(strings.NewReader(users))
+		So(err, ShouldBeNil)
+		So(d.Root(), ShouldHaveLength, 2)
+
+		So(d.ValMust(".[0].name"), ShouldEqual, "alice")
+		So(d.ValMust(".[0].roles[1]"), ShouldEqual, "dev")
+		So(d.Tree().StrValMust(".[1].name"), ShouldEqual, "bob")
+		So(d.ValMust("."), ShouldResemble, d.Root())
+
+		_, err = d.Val(".[2]")
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+		_, err = d.Val(".name")
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+
+		paths := []string{}
+		for _, p := range d.FieldPaths() {
+			paths = append(paths, p.String())
+		}
+		So(paths, ShouldContain, ".[0].roles[1]")
+		So(paths, ShouldContain, ".[1].name")
+
+		visited := []string{}
+		err = d.Visit(NewVisitorBuilder().
+			WithPrimitiveVisitor(func(key string, val interface{}) error {
+				visited = append(visited, key)
+				return nil
+			}).
+			WithSliceBeginVisitor(func(key string, val []interface{}) error {
+				visited = append(visited, key+"[")
+				return nil
+			}).
+			Visitor())
+		So(err, ShouldBeNil)
+		So(visited[0], ShouldEqual, ".[")
+		So(visited, ShouldContain, ".[0].name")
+		So(visited, ShouldContain, ".[0].roles[0]")
+
+		m, err := d.Query(".[*].name")
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 2)
+		So(m[1].Path.String(), ShouldEqual, ".[1].name")
+		So(m[1].Val, ShouldEqual, "bob")
+
+		m, err = d.Query(`.[?(@.roles[0] == "admin")].name`)
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 1)
+		So(m[0].Path.String(), ShouldEqual, ".[0].name")
+
+		m, err = d.Query("..roles[0]")
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 1)
+		So(m[0].Path.String(), ShouldEqual, ".[0].roles[0]")
+
+		m, err = d.Query(".")
+		So(err, ShouldBeNil)
+		So(m[0].Path.String(), ShouldEqual, ".")
+
+		d2, err := d.SetVal(".[1].name", "carol")
+		So(err, ShouldBeNil)
+		So(d2.ValMust(".[1].name"), ShouldEqual, "carol")
+		So(d.ValMust(".[1].name"), ShouldEqual, "bob")
+
+		out, err := d.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `[{"name":"alice","roles":["admin","dev"]},{"name":"bob","roles":[]}]`)
+
+		y, err := d.WriteYaml()
+		So(err, ShouldBeNil)
+		fromYaml, err := NewDocumentYaml(strings.NewReader(string(y)))
+		So(err, ShouldBeNil)
+		So(fromYaml, ShouldResemble, d)
+	})
+
+	Convey("Test Document with primitive and STree roots\n", t, func() {
+		d, err := NewDocumentJson(strings.NewReader(`"hello"`))
+		So(err, ShouldBeNil)
+		So(d.ValMust("."), ShouldEqual, "hello")
+		So(d.FieldPaths(), ShouldResemble, []FieldPath{{""}})
+		So(d.FieldPaths()[0].String(), ShouldEqual, ".")
+
+		visited := map[string]interface{}{}
+		err = d.Visit(NewVisitorBuilder().
+			WithPrimitiveVisitor(func(key string, val interface{}) error {
+				visited[key] = val
+				return nil
+			}).
+			Visitor())
+		So(err, ShouldBeNil)
+		So(visited, ShouldResemble, map[string]interface{}{".": "hello"})
+
+		d, err = NewDocumentJson(strings.NewReader(`9007199254740993`), WithJsonNumbers(JsonNumberRaw))
+		So(err, ShouldBeNil)
+		So(d.Root(), ShouldEqual, json.Number("9007199254740993"))
+		out, err := d.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `9007199254740993`)
+
+		d, err = NewDocumentJson(strings.NewReader(`null`))
+		So(err, ShouldBeNil)
+		So(d.Root(), ShouldBeNil)
+
+		d, err = NewDocumentYaml(strings.NewReader("- 1\n- key: val\n"))
+		So(err, ShouldBeNil)
+		So(d.ValMust(".[1].key"), ShouldEqual, "val")
+		_, ok := d.ValMust(".[1]").(STree)
+		So(ok, ShouldBeTrue)
+
+		d, err = NewDocumentYaml(strings.NewReader("key1: [1, 2]\n"))
+		So(err, ShouldBeNil)
+		So(d.Tree(), ShouldResemble, STree{"key1": []interface{}{1, 2}})
+		So(d.ValMust(".key1[1]"), ShouldEqual, 2)
+		m, err := d.Query(".key1[0]")
+		So(err, ShouldBeNil)
+		So(m[0].Path.String(), ShouldEqual, ".key1[0]")
+
+		d, err = d.SetVal(".", []interface{}{"replaced"})
+		So(err, ShouldBeNil)
+		So(d.ValMust(".[0]"), ShouldEqual, "replaced")
+
+		_, err = NewDocumentJson(strings.NewReader(`[1, 2`))
+		So(err, ShouldNotBeNil)
+		_, err = NewDocumentYaml(strings.NewReader("- [\n"))
+		So(err, ShouldNotBeNil)
+		_, err = NewDocument(struct{}{})
+		So(err, ShouldNotBeNil)
+	})
+}
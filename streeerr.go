@@ -0,0 +1,109 @@
+package gostree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+)
+
+var (
+	// ErrNotFound indicates that a path component names a key which is not present.
+	ErrNotFound = errors.New("not found")
+
+	// ErrTypeMismatch indicates that the value found along a path is not of the kind
+	// required to traverse it or to convert it to the requested type.
+	ErrTypeMismatch = errors.New("type mismatch")
+
+	// ErrIndexOutOfRange indicates that a path component subscript lies outside the
+	// bounds of the slice it indexes.
+	ErrIndexOutOfRange = errors.New("index out of range")
+
+	// ErrInvalidPath indicates that a path or one of its components cannot be parsed.
+	ErrInvalidPath = errors.New("invalid path")
+
+	// ErrPatchTestFailed indicates that a JSON Patch test operation found a value
+	// different from the one expected.
+	ErrPatchTestFailed = errors.New("patch test failed")
+)
+
+// PathError records a failure to resolve a path within an STree. Err is one of
+// ErrNotFound, ErrTypeMismatch, ErrIndexOutOfRange or ErrInvalidPath, so callers
+// can distinguish the cases using errors.Is.
+type PathError struct {
+	Op        string // the operation that failed, e.g. "Val" or "StrVal"
+	Path      string // the full path being resolved
+	Component string // the path component at which resolution failed
+	Expected  string // the kind required at Component, or the valid index range
+	Actual    string // the kind found at Component, or the offending index
+	Err       error
+}
+
+func (e *PathError) Error() string {
+	msg := fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+	if len(e.Component) > 0 {
+		msg += fmt.Sprintf(" at component %s", e.Component)
+	}
+	if len(e.Expected) > 0 || len(e.Actual) > 0 {
+		msg += fmt.Sprintf(" (expected %s, got %s)", e.Expected, e.Actual)
+	}
+	return msg
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// Kind names used in the Expected and Actual fields of PathError
+const (
+	KindNil    = "nil"
+	KindSTree  = "STree"
+	KindSlice  = "slice"
+	KindString = "string"
+	KindInt    = "int"
+	KindFloat  = "float"
+	KindBool   = "bool"
+	KindBytes  = "bytes"
+	KindTime   = "time"
+)
+
+// kindName returns the name of the kind of v as reported by PathError.
+func kindName(v interface{}) string {
+	if v == nil {
+		return KindNil
+	}
+	switch tv := v.(type) {
+	case json.Number:
+		if isJsonInteger(tv.String()) {
+			return KindInt
+		}
+		return KindFloat
+	case *big.Int:
+		return KindInt
+	case *big.Float:
+		return KindFloat
+	case []byte:
+		return KindBytes
+	case time.Time:
+		return KindTime
+	}
+	k := reflect.ValueOf(v).Kind()
+	switch {
+	case k == reflect.Map:
+		return KindSTree
+	case k == reflect.Slice:
+		return KindSlice
+	case isStringKind(k):
+		return KindString
+	case isIntKind(k), isUintKind(k):
+		return KindInt
+	case isFloatKind(k):
+		return KindFloat
+	case isBoolKind(k):
+		return KindBool
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,111 @@
+package gostree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeErr(t *testing.T) {
+
+	json := `{"key1": "val1", "key2": 1234, "key3": {"key4": true, "key5": [1, [2, 3]]}}`
+
+	Convey("Val not found\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		_, err = s.Val(".key3.key9")
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+
+		var pErr *PathError
+		So(errors.As(err, &pErr), ShouldBeTrue)
+		So(pErr.Op, ShouldEqual, "Val")
+		So(pErr.Path, ShouldEqual, ".key3.key9")
+		So(pErr.Component, ShouldEqual, "key9")
+		So(err.Error(), ShouldEqual, "Val .key3.key9: not found at component key9")
+	})
+
+	Convey("Val type mismatch\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		_, err = s.Val(".key1.key9")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		var pErr *PathError
+		So(errors.As(err, &pErr), ShouldBeTrue)
+		So(pErr.Component, ShouldEqual, "key9")
+		So(pErr.Expected, ShouldEqual, KindSTree)
+		So(pErr.Actual, ShouldEqual, KindString)
+
+		_, err = s.Val(".key3[0]")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		So(errors.As(err, &pErr), ShouldBeTrue)
+		So(pErr.Expected, ShouldEqual, KindSlice)
+		So(pErr.Actual, ShouldEqual, KindSTree)
+
+		_, err = s.Val(".key3.key5.key9")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		So(errors.As(err, &pErr), ShouldBeTrue)
+		So(pErr.Actual, ShouldEqual, KindSlice)
+	})
+
+	Convey("Val index out of range\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		_, err = s.Val(".key3.key5[1][2]")
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+		var pErr *PathError
+		So(errors.As(err, &pErr), ShouldBeTrue)
+		So(pErr.Component, ShouldEqual, "key5[1][2]")
+		So(pErr.Expected, ShouldEqual, "index in [0,1]")
+		So(pErr.Actual, ShouldEqual, "index 2")
+	})
+
+	Convey("Val invalid path\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		_, err = s.Val("key1")
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		_, err = s.Val("")
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		_, err = s.Val(".key3.key5[x]")
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+	})
+
+	Convey("typed accessors\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		_, err = s.StrVal(".key9")
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		So(err.Error(), ShouldStartWith, "StrVal .key9")
+
+		_, err = s.StrVal(".key2")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		var pErr *PathError
+		So(errors.As(err, &pErr), ShouldBeTrue)
+		So(pErr.Op, ShouldEqual, "StrVal")
+		So(pErr.Component, ShouldEqual, "key2")
+		So(pErr.Expected, ShouldEqual, KindString)
+		So(pErr.Actual, ShouldEqual, KindFloat)
+
+		_, err = s.IntVal(".key1")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.FloatVal(".key3.key4")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.BoolVal(".key3.key5[1]")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.STreeVal(".key3.key5")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.SliceVal(".key3")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.SliceVal(".key3.key5[2]")
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+	})
+}
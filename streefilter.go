@@ -0,0 +1,420 @@
+package gostree
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// filterSelector selects the elements of a slice for which expr holds, as written
+// in a Query expression using the syntax [?(expr)].
+type filterSelector struct {
+	expr filterExpr
+}
+
+func (s filterSelector) selectFrom(m Match, result []Match) []Match {
+
+	a, ok := m.Val.([]interface{})
+	if !ok || len(m.Path) < 1 {
+		return result
+	}
+
+	for i, e := range a {
+		em := Match{Path: indexPath(m.Path, i), Val: e}
+		if s.expr.eval(em) {
+			result = append(result, em)
+		}
+	}
+	return result
+}
+
+// filterExpr is a boolean expression evaluated against a single slice element.
+type filterExpr interface {
+	eval(m Match) bool
+}
+
+type orExpr struct {
+	l, r filterExpr
+}
+
+func (e orExpr) eval(m Match) bool {
+	return e.l.eval(m) || e.r.eval(m)
+}
+
+type andExpr struct {
+	l, r filterExpr
+}
+
+func (e andExpr) eval(m Match) bool {
+	return e.l.eval(m) && e.r.eval(m)
+}
+
+type notExpr struct {
+	e filterExpr
+}
+
+func (e notExpr) eval(m Match) bool {
+	return !e.e.eval(m)
+}
+
+// existsExpr holds if its operand yields any value, e.g. [?(@.name)].
+type existsExpr struct {
+	o filterOperand
+}
+
+func (e existsExpr) eval(m Match) bool {
+	return len(e.o.values(m)) > 0
+}
+
+// compareExpr holds if any value of l compares to any value of r according to op.
+// For the =~ operator, r is unused and the values of l are matched against re.
+type compareExpr struct {
+	op   string
+	l, r filterOperand
+	re   *regexp.Regexp
+}
+
+func (e compareExpr) eval(m Match) bool {
+
+	for _, lv := range e.l.values(m) {
+
+		if e.op == "=~" {
+			if s, ok := lv.(string); ok && e.re.MatchString(s) {
+				return true
+			}
+			continue
+		}
+
+		for _, rv := range e.r.values(m) {
+			if compareVals(e.op, lv, rv) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareVals compares l to r according to op. Ordering comparisons hold only
+// between two numbers or two strings.
+func compareVals(op string, l, r interface{}) bool {
+
+	switch op {
+	case "==":
+		return valuesEqual(l, r)
+	case "!=":
+		return !valuesEqual(l, r)
+	}
+
+	var c int
+	if _, ok := numericVal(l); ok {
+		if c, ok = compareNumbers(l, r); !ok {
+			return false
+		}
+	} else if lStr, ok := l.(string); ok {
+		rStr, ok := r.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(lStr, rStr)
+	} else {
+		return false
+	}
+
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// filterOperand yields the values to be compared for a single slice element.
+type filterOperand interface {
+	values(m Match) []interface{}
+}
+
+// pathOperand yields the values found by applying sels to the element, written
+// as @ followed by a relative path, e.g. @.user.name.
+type pathOperand struct {
+	sels []querySelector
+}
+
+func (o pathOperand) values(m Match) []interface{} {
+
+	matches := []Match{m}
+	for _, sel := range o.sels {
+		next := []Match{}
+		for _, sm := range matches {
+			next = sel.selectFrom(sm, next)
+		}
+		matches = next
+	}
+
+	result := []interface{}{}
+	for _, sm := range matches {
+		result = append(result, sm.Val)
+	}
+	return result
+}
+
+type literalOperand struct {
+	val interface{}
+}
+
+func (o literalOperand) values(m Match) []interface{} {
+	return []interface{}{o.val}
+}
+
+// filterOps lists the comparison operators, longest first so that e.g. <= is
+// preferred to <.
+var filterOps = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+// parseFilter parses a filter subscript of the form ?(expr), positioned at the '?'.
+func (p *queryParser) parseFilter() (querySelector, error) {
+
+	p.pos++ // consume '?'
+	if p.peek() != '(' {
+		return nil, p.errorf("expected '(' after '?'")
+	}
+	p.pos++
+
+	p.depth++
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.depth--
+
+	p.skipSpace()
+	if p.peek() != ')' {
+		return nil, p.errorf("expected ')' or operator")
+	}
+	p.pos++
+	return filterSelector{expr}, nil
+}
+
+func (p *queryParser) parseOr() (filterExpr, error) {
+
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.skipSpace(); strings.HasPrefix(p.expr[p.pos:], "||"); p.skipSpace() {
+		p.pos += 2
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orExpr{l, r}
+	}
+	return l, nil
+}
+
+func (p *queryParser) parseAnd() (filterExpr, error) {
+
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.skipSpace(); strings.HasPrefix(p.expr[p.pos:], "&&"); p.skipSpace() {
+		p.pos += 2
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = andExpr{l, r}
+	}
+	return l, nil
+}
+
+func (p *queryParser) parseUnary() (filterExpr, error) {
+
+	p.skipSpace()
+	switch p.peek() {
+
+	case '!':
+		p.pos++
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+
+	case '(':
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.errorf("expected ')' or operator")
+		}
+		p.pos++
+		return e, nil
+
+	default:
+		return p.parseComparison()
+	}
+}
+
+func (p *queryParser) parseComparison() (filterExpr, error) {
+
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	var op string
+	for _, o := range filterOps {
+		if strings.HasPrefix(p.expr[p.pos:], o) {
+			op = o
+			break
+		}
+	}
+	if len(op) < 1 {
+		return existsExpr{l}, nil
+	}
+	p.pos += len(op)
+
+	if op == "=~" {
+		re, err := p.parseRegexp()
+		if err != nil {
+			return nil, err
+		}
+		return compareExpr{op: op, l: l, re: re}, nil
+	}
+
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareExpr{op: op, l: l, r: r}, nil
+}
+
+// parseOperand parses either @ followed by a relative path, or a literal string,
+// number, true, false or null.
+func (p *queryParser) parseOperand() (filterOperand, error) {
+
+	p.skipSpace()
+	c := p.peek()
+	switch {
+
+	case c == '@':
+		p.pos++
+		sels := []querySelector{}
+		for p.peek() == '.' || p.peek() == '[' {
+			sel, err := p.parseSelector()
+			if err != nil {
+				return nil, err
+			}
+			sels = append(sels, sel)
+		}
+		return pathOperand{sels}, nil
+
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literalOperand{s}, nil
+
+	case c == '-' || (c >= '0' && c <= '9'):
+		begin := p.pos
+		for !p.done() && strings.IndexByte("+-.eE0123456789", p.peek()) >= 0 {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(p.expr[begin:p.pos], 64)
+		if err != nil {
+			num := p.expr[begin:p.pos]
+			p.pos = begin
+			return nil, p.errorf("invalid number %q", num)
+		}
+		return literalOperand{f}, nil
+	}
+
+	for _, kw := range []struct {
+		word string
+		val  interface{}
+	}{{"true", true}, {"false", false}, {"null", nil}} {
+		if strings.HasPrefix(p.expr[p.pos:], kw.word) {
+			p.pos += len(kw.word)
+			return literalOperand{kw.val}, nil
+		}
+	}
+
+	return nil, p.errorf("expected '@', string, number, true, false or null")
+}
+
+// parseString parses a single or double quoted string with backslash escapes.
+func (p *queryParser) parseString() (string, error) {
+
+	begin := p.pos
+	quote := p.peek()
+	p.pos++
+
+	var buf bytes.Buffer
+	for !p.done() && p.peek() != quote {
+		if p.peek() == '\\' && p.pos+1 < len(p.expr) {
+			p.pos++
+		}
+		buf.WriteByte(p.peek())
+		p.pos++
+	}
+
+	if p.done() {
+		p.pos = begin
+		return "", p.errorf("unterminated string")
+	}
+	p.pos++
+	return buf.String(), nil
+}
+
+// parseRegexp parses a regular expression delimited by '/', with \/ denoting a
+// literal '/'.
+func (p *queryParser) parseRegexp() (*regexp.Regexp, error) {
+
+	p.skipSpace()
+	if p.peek() != '/' {
+		return nil, p.errorf("expected regular expression after =~")
+	}
+	begin := p.pos
+	p.pos++
+
+	var buf bytes.Buffer
+	for !p.done() && p.peek() != '/' {
+		if strings.HasPrefix(p.expr[p.pos:], `\/`) {
+			p.pos++
+		}
+		buf.WriteByte(p.peek())
+		p.pos++
+	}
+
+	if p.done() {
+		p.pos = begin
+		return nil, p.errorf("unterminated regular expression")
+	}
+	p.pos++
+
+	re, err := regexp.Compile(buf.String())
+	if err != nil {
+		p.pos = begin
+		return nil, p.errorf("invalid regular expression: %v", err)
+	}
+	return re, nil
+}
+
+func (p *queryParser) skipSpace() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
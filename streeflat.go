@@ -0,0 +1,643 @@
+package gostree
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FlatOption configures the mapping between the keys of flat formats, i.e. properties,
+// .env and INI files, and the paths of an STree. Since flat keys have no escapes,
+// a key component containing the separator cannot be written, and an error is
+// returned instead.
+type FlatOption func(*flatCodec)
+
+// WithKeySeparator sets the string separating the components of a flat key, e.g.
+// "." maps a.b.c to .a.b.c. An empty separator disables nesting, so that every key
+// maps to a top level value.
+func WithKeySeparator(sep string) FlatOption {
+	return func(c *flatCodec) { c.sep = sep }
+}
+
+// WithSliceIndices sets whether, when reading, an STree whose keys are all decimal
+// indices is converted to a slice, e.g. so that list.0=x and list.1=y map to a slice
+// at .list. Missing indices hold nil. When writing, slice elements are always keyed
+// by their index.
+func WithSliceIndices(enabled bool) FlatOption {
+	return func(c *flatCodec) { c.sliceIndices = enabled }
+}
+
+// WithKeyMapper sets functions applied to each whole flat key after reading, before
+// it is split into components, and before writing, after it is joined, e.g. to map
+// the upper case keys of .env files to lower case STree keys and back.
+func WithKeyMapper(decode, encode func(string) string) FlatOption {
+	return func(c *flatCodec) { c.decodeKey, c.encodeKey = decode, encode }
+}
+
+type flatCodec struct {
+	sep          string
+	sliceIndices bool
+	decodeKey    func(string) string
+	encodeKey    func(string) string
+}
+
+func identityKey(k string) string {
+	return k
+}
+
+func newFlatCodec(sep string, decodeKey, encodeKey func(string) string, opts []FlatOption) *flatCodec {
+	c := &flatCodec{sep: sep, sliceIndices: true, decodeKey: decodeKey, encodeKey: encodeKey}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewSTreeProperties reads a java properties file from the specified reader and
+// returns its entries nested as an STree, with all values as strings. Keys are split
+// on "." by default, so that a.b.c=value maps to .a.b.c.
+func NewSTreeProperties(r io.Reader, opts ...FlatOption) (STree, error) {
+
+	c := newFlatCodec(".", identityKey, identityKey, opts)
+	result := STree{}
+
+	lineNum, start := 0, 0
+	var logical bytes.Buffer
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+
+		lineNum++
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if logical.Len() < 1 {
+			if len(line) < 1 || line[0] == '#' || line[0] == '!' {
+				continue
+			}
+			start = lineNum
+		}
+
+		trailing := len(line) - len(strings.TrimRight(line, `\`))
+		if trailing%2 == 1 {
+			logical.WriteString(line[:len(line)-1])
+			continue
+		}
+		logical.WriteString(line)
+
+		if err := c.insertProperty(result, logical.String(), start); err != nil {
+			return nil, err
+		}
+		logical.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("NewSTreeProperties error reading bytes: %v", err)
+	}
+	if logical.Len() > 0 {
+		if err := c.insertProperty(result, logical.String(), start); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.nestSlices(result).(STree), nil
+}
+
+func (c *flatCodec) insertProperty(t STree, line string, lineNum int) error {
+
+	end := 0
+	for end < len(line) && strings.IndexByte("=: \t\f", line[end]) < 0 {
+		if line[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if len(rest) > 0 && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	key, err := unescapeProperty(line[:end])
+	if err != nil {
+		return fmt.Errorf("NewSTreeProperties line %d: %v", lineNum, err)
+	}
+	val, err := unescapeProperty(rest)
+	if err != nil {
+		return fmt.Errorf("NewSTreeProperties line %d: %v", lineNum, err)
+	}
+
+	return c.insert("NewSTreeProperties", t, c.split(key), val, lineNum)
+}
+
+// unescapeProperty returns s with java properties escape sequences replaced.
+func unescapeProperty(s string) (string, error) {
+
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+
+		if s[i] != '\\' || i+1 >= len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 't':
+			buf.WriteByte('\t')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid unicode escape \\%s", s[i:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape \\%s", s[i:i+5])
+			}
+			buf.WriteRune(rune(r))
+			i += 4
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String(), nil
+}
+
+// WriteProperties flattens the STree to a java properties file, with one line per
+// leaf value in sorted key order.
+func (s STree) WriteProperties(opts ...FlatOption) ([]byte, error) {
+
+	c := newFlatCodec(".", identityKey, identityKey, opts)
+	entries, err := c.flatten("WriteProperties", s)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(escapeProperty(e.key, true))
+		buf.WriteByte('=')
+		buf.WriteString(escapeProperty(e.val, false))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// escapeProperty returns s escaped for use as a java properties key or value.
+func escapeProperty(s string, isKey bool) string {
+
+	var buf bytes.Buffer
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r == ' ' && (isKey || i == 0):
+			buf.WriteString(`\ `)
+		case (r == '=' || r == ':') && isKey:
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case (r == '#' || r == '!') && i == 0:
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// NewSTreeEnv reads a .env file of KEY=value lines from the specified reader and
+// returns its entries nested as an STree, with all values as strings. By default
+// keys are lower cased and split on "__", so that APP__DB_HOST=x maps to .app.db_host.
+// Lines may be prefixed with export, and values may be single quoted, taken
+// literally, or double quoted, with \n, \t, \", \\ and \$ escapes. Unquoted values
+// end at a " #" comment.
+func NewSTreeEnv(r io.Reader, opts ...FlatOption) (STree, error) {
+
+	c := newFlatCodec("__", strings.ToLower, strings.ToUpper, opts)
+	result := STree{}
+
+	lineNum := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") {
+			line = strings.TrimSpace(line[len("export "):])
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("NewSTreeEnv line %d: expected KEY=value", lineNum)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if len(key) < 1 || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("NewSTreeEnv line %d: invalid key %q", lineNum, key)
+		}
+
+		val, err := parseEnvVal(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("NewSTreeEnv line %d: %v", lineNum, err)
+		}
+
+		if err = c.insert("NewSTreeEnv", result, c.split(key), val, lineNum); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("NewSTreeEnv error reading bytes: %v", err)
+	}
+
+	return c.nestSlices(result).(STree), nil
+}
+
+func parseEnvVal(v string) (string, error) {
+
+	switch {
+	case strings.HasPrefix(v, "'"):
+		end := strings.IndexByte(v[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+		return v[1 : end+1], nil
+
+	case strings.HasPrefix(v, `"`):
+		var buf bytes.Buffer
+		for i := 1; i < len(v); i++ {
+			switch {
+			case v[i] == '"':
+				return buf.String(), nil
+			case v[i] == '\\' && i+1 < len(v):
+				i++
+				switch v[i] {
+				case 'n':
+					buf.WriteByte('\n')
+				case 't':
+					buf.WriteByte('\t')
+				case 'r':
+					buf.WriteByte('\r')
+				default:
+					buf.WriteByte(v[i])
+				}
+			default:
+				buf.WriteByte(v[i])
+			}
+		}
+		return "", fmt.Errorf("unterminated double quoted value")
+
+	default:
+		if i := strings.Index(v, " #"); i >= 0 {
+			v = strings.TrimSpace(v[:i])
+		}
+		return v, nil
+	}
+}
+
+// WriteEnv flattens the STree to a .env file, with one KEY=value line per leaf value
+// in sorted key order. Values containing whitespace, quotes or other characters
+// special to the shell are double quoted.
+func (s STree) WriteEnv(opts ...FlatOption) ([]byte, error) {
+
+	c := newFlatCodec("__", strings.ToLower, strings.ToUpper, opts)
+	entries, err := c.flatten("WriteEnv", s)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		if len(e.key) < 1 || strings.ContainsAny(e.key, "= \t\n#") {
+			return nil, fmt.Errorf("WriteEnv key %q cannot be represented", e.key)
+		}
+		buf.WriteString(e.key)
+		buf.WriteByte('=')
+		if strings.ContainsAny(e.val, " \t\n\r#'\"\\$`") {
+			r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`", "\n", `\n`, "\t", `\t`, "\r", `\r`)
+			buf.WriteString(`"` + r.Replace(e.val) + `"`)
+		} else {
+			buf.WriteString(e.val)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// NewSTreeIni reads an INI file from the specified reader and returns its entries
+// nested as an STree, with all values as strings. Keys preceding the first section
+// are stored at the top level, and the keys of each [section] are stored in an STree
+// under the section name. Both section names and keys are split on "." by default.
+// Lines beginning with ; or # are comments, and values wrapped in double quotes are
+// unwrapped.
+func NewSTreeIni(r io.Reader, opts ...FlatOption) (STree, error) {
+
+	c := newFlatCodec(".", identityKey, identityKey, opts)
+	result := STree{}
+
+	var section []string
+	lineNum := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("NewSTreeIni line %d: expected ']'", lineNum)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if len(name) < 1 {
+				return nil, fmt.Errorf("NewSTreeIni line %d: empty section name", lineNum)
+			}
+			section = c.split(name)
+			if err := c.insertSection(result, section, lineNum); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		eq := strings.IndexAny(line, "=:")
+		if eq < 1 {
+			return nil, fmt.Errorf("NewSTreeIni line %d: expected key = value", lineNum)
+		}
+		key := strings.TrimSpace(line[:eq])
+		val := strings.TrimSpace(line[eq+1:])
+		if len(val) > 1 && val[0] == '"' && val[len(val)-1] == '"' {
+			val = val[1 : len(val)-1]
+		}
+
+		comps := append(append([]string{}, section...), c.split(key)...)
+		if err := c.insert("NewSTreeIni", result, comps, val, lineNum); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("NewSTreeIni error reading bytes: %v", err)
+	}
+
+	return c.nestSlices(result).(STree), nil
+}
+
+// insertSection ensures that an STree exists at comps, so that empty sections are
+// preserved.
+func (c *flatCodec) insertSection(t STree, comps []string, lineNum int) error {
+	for _, comp := range comps {
+		next, ok := t[comp]
+		if !ok {
+			next = STree{}
+			t[comp] = next
+		}
+		if t, ok = next.(STree); !ok {
+			return fmt.Errorf("NewSTreeIni line %d: section %q conflicts with an earlier key",
+				lineNum, strings.Join(comps, c.sep))
+		}
+	}
+	return nil
+}
+
+// WriteIni flattens the STree to an INI file. Top level values which are not STrees
+// are written first, followed by a [section] for each top level STree holding its
+// flattened values, in sorted key order.
+func (s STree) WriteIni(opts ...FlatOption) ([]byte, error) {
+
+	c := newFlatCodec(".", identityKey, identityKey, opts)
+	entries, err := c.flatten("WriteIni", s)
+	if err != nil {
+		return nil, err
+	}
+
+	var global, sectioned []flatEntry
+	for _, e := range entries {
+		if _, ok := s[e.top].(STree); ok && len(e.comps) > 1 {
+			sectioned = append(sectioned, e)
+		} else {
+			global = append(global, e)
+		}
+	}
+
+	var buf bytes.Buffer
+	write := func(key, val string) error {
+		if len(key) < 1 || strings.ContainsAny(key, "=:[]\n") || strings.ContainsAny(key[:1], ";#") {
+			return fmt.Errorf("WriteIni key %q cannot be represented", key)
+		}
+		if strings.ContainsAny(val, "\n\r") {
+			return fmt.Errorf("WriteIni value of key %q cannot contain a line break", key)
+		}
+		if val != strings.TrimSpace(val) || (len(val) > 1 && val[0] == '"' && val[len(val)-1] == '"') {
+			val = `"` + val + `"`
+		}
+		buf.WriteString(fmt.Sprintf("%s = %s\n", key, val))
+		return nil
+	}
+
+	for _, e := range global {
+		if err := write(e.key, e.val); err != nil {
+			return nil, err
+		}
+	}
+
+	section := ""
+	for _, e := range sectioned {
+		if e.comps[0] != section {
+			section = e.comps[0]
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(fmt.Sprintf("[%s]\n", c.encodeKey(section)))
+		}
+		if err := write(c.encodeKey(strings.Join(e.comps[1:], c.sep)), e.val); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// split returns the components of the flat key.
+func (c *flatCodec) split(key string) []string {
+	key = c.decodeKey(key)
+	if len(c.sep) < 1 {
+		return []string{key}
+	}
+	return strings.Split(key, c.sep)
+}
+
+// insert stores val in t at the path given by comps, creating intermediate STrees
+// as required. A later value for the same key replaces an earlier one.
+func (c *flatCodec) insert(op string, t STree, comps []string, val string, lineNum int) error {
+
+	for i, comp := range comps {
+
+		if i == len(comps)-1 {
+			if _, ok := t[comp].(STree); ok {
+				break
+			}
+			t[comp] = val
+			return nil
+		}
+
+		next, ok := t[comp]
+		if !ok {
+			next = STree{}
+			t[comp] = next
+		}
+		if t, ok = next.(STree); !ok {
+			break
+		}
+	}
+
+	return fmt.Errorf("%s line %d: key %q conflicts with an earlier key", op, lineNum, strings.Join(comps, c.sep))
+}
+
+// nestSlices returns v with every nested STree whose keys are all decimal indices
+// converted to a slice, if enabled.
+func (c *flatCodec) nestSlices(v interface{}) interface{} {
+
+	t, ok := v.(STree)
+	if !ok {
+		return v
+	}
+
+	for k, kv := range t {
+		t[k] = c.nestSlices(kv)
+	}
+
+	if !c.sliceIndices || len(t) < 1 {
+		return t
+	}
+
+	max := -1
+	for k := range t {
+		i, ok := flatIndex(k.(string))
+		if !ok {
+			return t
+		}
+		if i > max {
+			max = i
+		}
+	}
+
+	result := make([]interface{}, max+1)
+	for k, kv := range t {
+		i, _ := flatIndex(k.(string))
+		result[i] = kv
+	}
+	return result
+}
+
+// flatIndex returns the value of s if it is a decimal index without leading zeros.
+func flatIndex(s string) (int, bool) {
+	if len(s) < 1 || (len(s) > 1 && s[0] == '0') {
+		return 0, false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	i, err := strconv.Atoi(s)
+	return i, err == nil
+}
+
+// flatEntry is a single leaf value of an STree in flattened form, along with the
+// top level key under which it lies.
+type flatEntry struct {
+	top   interface{}
+	comps []string
+	key   string
+	val   string
+}
+
+// flatten returns an entry for each of the FieldPaths of s, sorted by key, with
+// slice indices numerically ordered.
+func (c *flatCodec) flatten(op string, s STree) ([]flatEntry, error) {
+
+	entries := []flatEntry{}
+	for _, f := range s.FieldPaths() {
+
+		var top interface{}
+		comps := []string{}
+		for i, pc := range f {
+			key, idxs, err := s.parsePathComponent(pc)
+			if err != nil {
+				return nil, fmt.Errorf("%s error in parsePathComponent: %v", op, err)
+			}
+			if i == 0 {
+				top = key
+			}
+			kStr := keyString(key)
+			if len(c.sep) > 0 && strings.Contains(kStr, c.sep) {
+				return nil, fmt.Errorf("%s key %q of path %s contains the separator %q", op, kStr, f, c.sep)
+			}
+			comps = append(comps, kStr)
+			for _, i := range idxs {
+				comps = append(comps, strconv.Itoa(i))
+			}
+		}
+		if len(c.sep) < 1 && len(comps) > 1 {
+			return nil, fmt.Errorf("%s path %s cannot be represented without a separator", op, f)
+		}
+
+		v, err := s.Val(f.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s error in Val: %w", op, err)
+		}
+		var val string
+		if v != nil {
+			val = fmt.Sprintf("%v", v)
+		}
+		if !utf8.ValidString(val) {
+			return nil, fmt.Errorf("%s value of path %s is not valid UTF-8", op, f)
+		}
+
+		entries = append(entries, flatEntry{top: top, comps: comps, key: c.encodeKey(strings.Join(comps, c.sep)), val: val})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return compareFlatComps(entries[i].comps, entries[j].comps) < 0
+	})
+	return entries, nil
+}
+
+// compareFlatComps orders key components lexically, except that indices are
+// ordered numerically.
+func compareFlatComps(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ai, aOk := flatIndex(a[i])
+		bi, bOk := flatIndex(b[i])
+		if aOk && bOk && ai != bi {
+			if ai < bi {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,231 @@
+package gostree
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeFlat(t *testing.T) {
+
+	defer log.Flush()
+
+	Convey("Test NewSTreeProperties\n", t, func() {
+		s, err := NewSTreeProperties(strings.NewReader(`
+# comment
+! also a comment
+db.host = localhost
+db.port:5432
+db.replicas.0 = r1.example.com
+db.replicas.1 = r2.example.com
+servers.0.name=web
+servers.1.name=api
+message = hello \
+          world
+path\ with\ spaces=c:\\temp
+unicode=caf\u00e9
+empty
+db.host = override
+`))
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".db.host"), ShouldEqual, "override")
+		So(s.StrValMust(".db.port"), ShouldEqual, "5432")
+		So(s.SliceValMust(".db.replicas"), ShouldResemble, []interface{}{"r1.example.com", "r2.example.com"})
+		So(s.StrValMust(".servers[1].name"), ShouldEqual, "api")
+		So(s.StrValMust(".message"), ShouldEqual, "hello world")
+		So(s.StrValMust(".path with spaces"), ShouldEqual, `c:\temp`)
+		So(s.StrValMust(".unicode"), ShouldEqual, "café")
+		So(s.StrValMust(".empty"), ShouldEqual, "")
+
+		s, err = NewSTreeProperties(strings.NewReader("list.0=a\nlist.2=c\nmap.01=x\n"))
+		So(err, ShouldBeNil)
+		So(s.SliceValMust(".list"), ShouldResemble, []interface{}{"a", nil, "c"})
+		So(s.StrValMust(".map.01"), ShouldEqual, "x")
+
+		s, err = NewSTreeProperties(strings.NewReader("list.0=a\n"), WithSliceIndices(false))
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".list.0"), ShouldEqual, "a")
+
+		s, err = NewSTreeProperties(strings.NewReader("a.b/c/d=1\n"), WithKeySeparator("/"))
+		So(err, ShouldBeNil)
+		So(s.StrValMust(`.a\.b.c.d`), ShouldEqual, "1")
+
+		s, err = NewSTreeProperties(strings.NewReader("a.b=1\n"), WithKeySeparator(""))
+		So(err, ShouldBeNil)
+		So(s, ShouldResemble, STree{"a.b": "1"})
+
+		_, err = NewSTreeProperties(strings.NewReader("a=1\na.b=2\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "line 2")
+		_, err = NewSTreeProperties(strings.NewReader("a.b=1\na=2\n"))
+		So(err, ShouldNotBeNil)
+		_, err = NewSTreeProperties(strings.NewReader("a=\\u00zz\n"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test WriteProperties\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(`
+---
+db:
+  host: localhost
+  port: 5432
+  replicas: [r1, r2, r3, r4, r5, r6, r7, r8, r9, r10, r11]
+flags: {debug: true, ratio: 0.5, none: null}
+matrix: [[1, 2], [3]]
+"key with = and :": " leading space"
+`))
+		So(err, ShouldBeNil)
+
+		out, err := s.WriteProperties()
+		So(err, ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		So(lines[0], ShouldEqual, "db.host=localhost")
+		So(lines[1], ShouldEqual, "db.port=5432")
+		So(lines[2], ShouldEqual, "db.replicas.0=r1")
+		So(lines[12], ShouldEqual, "db.replicas.10=r11")
+		So(string(out), ShouldContainSubstring, "flags.none=\n")
+		So(string(out), ShouldContainSubstring, "matrix.0.1=2\n")
+		So(string(out), ShouldContainSubstring, `key\ with\ \=\ and\ \:=\ leading space`)
+
+		r, err := NewSTreeProperties(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(r.StrValMust(".db.replicas[10]"), ShouldEqual, "r11")
+		So(r.StrValMust(".matrix[0][1]"), ShouldEqual, "2")
+		So(r.StrValMust(".key with = and :"), ShouldEqual, " leading space")
+		So(r.StrValMust(".flags.none"), ShouldEqual, "")
+
+		_, err = STree{"a.b": 1}.WriteProperties()
+		So(err, ShouldNotBeNil)
+		out, err = STree{"a.b": 1}.WriteProperties(WithKeySeparator("/"))
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "a.b=1\n")
+		_, err = STree{"a": STree{"b": 1}}.WriteProperties(WithKeySeparator(""))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test NewSTreeEnv and WriteEnv\n", t, func() {
+		s, err := NewSTreeEnv(strings.NewReader(`
+# database settings
+APP__DB_HOST=localhost
+export APP__DB_PORT = 5432
+APP__GREETING="hello \"world\"\n"
+APP__LITERAL='no $expansion \n'
+APP__HOSTS__0=a # first host
+APP__HOSTS__1=b
+EMPTY=
+`))
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".app.db_host"), ShouldEqual, "localhost")
+		So(s.StrValMust(".app.db_port"), ShouldEqual, "5432")
+		So(s.StrValMust(".app.greeting"), ShouldEqual, "hello \"world\"\n")
+		So(s.StrValMust(".app.literal"), ShouldEqual, `no $expansion \n`)
+		So(s.SliceValMust(".app.hosts"), ShouldResemble, []interface{}{"a", "b"})
+		So(s.StrValMust(".empty"), ShouldEqual, "")
+
+		out, err := s.WriteEnv()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldStartWith, "APP__DB_HOST=localhost\nAPP__DB_PORT=5432\n")
+		So(string(out), ShouldContainSubstring, `APP__GREETING="hello \"world\"\n"`)
+		So(string(out), ShouldContainSubstring, `APP__LITERAL="no \$expansion \\n"`)
+
+		r, err := NewSTreeEnv(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, s)
+
+		s, err = NewSTreeEnv(strings.NewReader("App_Db_Host=x\n"), WithKeySeparator("_"), WithKeyMapper(identityKey, identityKey))
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".App.Db.Host"), ShouldEqual, "x")
+
+		_, err = NewSTreeEnv(strings.NewReader("NOVALUE\n"))
+		So(err, ShouldNotBeNil)
+		_, err = NewSTreeEnv(strings.NewReader("A=\"unterminated\n"))
+		So(err, ShouldNotBeNil)
+		_, err = STree{"a b": 1}.WriteEnv()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test NewSTreeIni and WriteIni\n", t, func() {
+		s, err := NewSTreeIni(strings.NewReader(`
+; global settings
+name = demo
+
+[database]
+host = localhost
+port: 5432
+replicas.0 = r1
+replicas.1 = r2
+
+[server.http]
+banner = "  padded  "
+# comment
+
+[empty]
+`))
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".name"), ShouldEqual, "demo")
+		So(s.StrValMust(".database.port"), ShouldEqual, "5432")
+		So(s.SliceValMust(".database.replicas"), ShouldResemble, []interface{}{"r1", "r2"})
+		So(s.StrValMust(".server.http.banner"), ShouldEqual, "  padded  ")
+		So(s.STreeValMust(".empty"), ShouldBeEmpty)
+
+		out, err := s.WriteIni()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `name = demo
+
+[database]
+host = localhost
+port = 5432
+replicas.0 = r1
+replicas.1 = r2
+
+[server]
+http.banner = "  padded  "
+`)
+
+		r, err := NewSTreeIni(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		s, err = s.Delete(".empty")
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, s)
+
+		_, err = NewSTreeIni(strings.NewReader("[unclosed\n"))
+		So(err, ShouldNotBeNil)
+		_, err = NewSTreeIni(strings.NewReader("a = 1\n[a]\n"))
+		So(err, ShouldNotBeNil)
+		_, err = NewSTreeIni(strings.NewReader("[a]\nnovalue\n"))
+		So(err, ShouldNotBeNil)
+		_, err = STree{"a": "multi\nline"}.WriteIni()
+		So(err, ShouldNotBeNil)
+
+		out, err = STree{1: STree{"b": "x"}, "c": "y"}.WriteIni()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "c = y\n\n[1]\nb = x\n")
+	})
+
+	Convey("Test flat format conversion\n", t, func() {
+		s, err := NewSTreeProperties(strings.NewReader("a.b.0=x\na.b.1=y\na.c=z\n"))
+		So(err, ShouldBeNil)
+
+		out, err := s.WriteEnv()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "A__B__0=x\nA__B__1=y\nA__C=z\n")
+		e, err := NewSTreeEnv(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(e, ShouldResemble, s)
+
+		out, err = e.WriteIni()
+		So(err, ShouldBeNil)
+		i, err := NewSTreeIni(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(i, ShouldResemble, s)
+
+		j, err := i.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(j), ShouldEqual, `{"a":{"b":["x","y"],"c":"z"}}`)
+	})
+}
@@ -0,0 +1,479 @@
+package gostree
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WithJson5 sets whether json is read leniently, accepting the hand-written style
+// of JSONC and JSON5 configuration files: // and /* */ comments, trailing commas,
+// single-quoted strings, unquoted identifier keys, hexadecimal numbers, and numbers
+// with a leading + or a leading or trailing decimal point. Infinity and NaN are
+// rejected, having no STree representation in json. Syntax errors are reported as
+// a *SyntaxError.
+func WithJson5(lenient bool) JsonOption {
+	return func(c *jsonCodec) { c.json5 = lenient }
+}
+
+// SyntaxError reports a malformed document along with the position at which the
+// problem was found. Line and Column count from 1, with columns in characters.
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// json5Reader rewrites a lenient json document as strict json, recording the
+// offset within src of each value written to out, indexed by its offset in out.
+type json5Reader struct {
+	src    []byte
+	pos    int
+	out    bytes.Buffer
+	starts map[int]int
+}
+
+// json5ToJson returns the strict json equivalent of the lenient json in data.
+func json5ToJson(data []byte) ([]byte, error) {
+	r, err := transcodeJson5(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.out.Bytes(), nil
+}
+
+// transcodeJson5 returns a json5Reader having rewritten all of data.
+func transcodeJson5(data []byte) (*json5Reader, error) {
+
+	r := &json5Reader{src: bytes.TrimPrefix(data, []byte("\ufeff")), starts: map[int]int{}}
+	if err := r.skip(); err != nil {
+		return nil, err
+	}
+	if err := r.value(); err != nil {
+		return nil, err
+	}
+	if err := r.skip(); err != nil {
+		return nil, err
+	}
+	if r.pos < len(r.src) {
+		return nil, r.errorf("invalid data after top-level value")
+	}
+	return r, nil
+}
+
+// errorf returns a *SyntaxError at the current position.
+func (r *json5Reader) errorf(format string, args ...interface{}) error {
+	return r.errorAt(r.pos, format, args...)
+}
+
+func (r *json5Reader) errorAt(pos int, format string, args ...interface{}) error {
+	lineStart := bytes.LastIndexByte(r.src[:pos], '\n') + 1
+	return &SyntaxError{
+		Line:   bytes.Count(r.src[:pos], []byte("\n")) + 1,
+		Column: utf8.RuneCount(r.src[lineStart:pos]) + 1,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// skip advances past whitespace and comments.
+func (r *json5Reader) skip() error {
+	for r.pos < len(r.src) {
+		c, size := utf8.DecodeRune(r.src[r.pos:])
+		switch {
+		case unicode.IsSpace(c) || c == '\ufeff':
+			r.pos += size
+		case bytes.HasPrefix(r.src[r.pos:], []byte("//")):
+			if i := bytes.IndexByte(r.src[r.pos:], '\n'); i >= 0 {
+				r.pos += i + 1
+			} else {
+				r.pos = len(r.src)
+			}
+		case bytes.HasPrefix(r.src[r.pos:], []byte("/*")):
+			i := bytes.Index(r.src[r.pos+2:], []byte("*/"))
+			if i < 0 {
+				return r.errorf("unterminated comment")
+			}
+			r.pos += i + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *json5Reader) value() error {
+
+	if r.pos >= len(r.src) {
+		return r.errorf("unexpected end of input")
+	}
+	r.starts[r.out.Len()] = r.pos
+
+	c := r.src[r.pos]
+	switch {
+	case c == '{':
+		return r.object()
+	case c == '[':
+		return r.array()
+	case c == '"' || c == '\'':
+		s, err := r.str()
+		if err != nil {
+			return err
+		}
+		r.out.WriteString(jsonQuote(s))
+		return nil
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return r.number()
+	}
+
+	start := r.pos
+	switch id := r.identifier(); id {
+	case "true", "false", "null":
+		r.out.WriteString(id)
+		return nil
+	case "Infinity", "NaN":
+		return r.errorAt(start, "%s is not supported", id)
+	}
+	return r.errorAt(start, "unexpected character %q", firstRune(r.src[start:]))
+}
+
+func firstRune(b []byte) rune {
+	c, _ := utf8.DecodeRune(b)
+	return c
+}
+
+func (r *json5Reader) object() error {
+
+	r.pos++
+	r.out.WriteByte('{')
+	for first := true; ; first = false {
+		if err := r.skip(); err != nil {
+			return err
+		}
+		if r.pos < len(r.src) && r.src[r.pos] == '}' {
+			r.pos++
+			r.out.WriteByte('}')
+			return nil
+		}
+		if !first {
+			r.out.WriteByte(',')
+		}
+
+		if err := r.key(); err != nil {
+			return err
+		}
+		if err := r.skip(); err != nil {
+			return err
+		}
+		if r.pos >= len(r.src) || r.src[r.pos] != ':' {
+			return r.errorf("expected : after object key")
+		}
+		r.pos++
+		r.out.WriteByte(':')
+
+		if err := r.skip(); err != nil {
+			return err
+		}
+		if err := r.value(); err != nil {
+			return err
+		}
+		if err := r.separator('}'); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *json5Reader) array() error {
+
+	r.pos++
+	r.out.WriteByte('[')
+	for first := true; ; first = false {
+		if err := r.skip(); err != nil {
+			return err
+		}
+		if r.pos < len(r.src) && r.src[r.pos] == ']' {
+			r.pos++
+			r.out.WriteByte(']')
+			return nil
+		}
+		if !first {
+			r.out.WriteByte(',')
+		}
+
+		if err := r.value(); err != nil {
+			return err
+		}
+		if err := r.separator(']'); err != nil {
+			return err
+		}
+	}
+}
+
+// separator advances past the comma following an object member or array element,
+// or stops at the closing delimiter.
+func (r *json5Reader) separator(closing byte) error {
+	if err := r.skip(); err != nil {
+		return err
+	}
+	if r.pos < len(r.src) && r.src[r.pos] == ',' {
+		r.pos++
+		return nil
+	}
+	if r.pos < len(r.src) && r.src[r.pos] == closing {
+		return nil
+	}
+	if r.pos >= len(r.src) {
+		return r.errorf("unexpected end of input")
+	}
+	return r.errorf("expected , or %c", closing)
+}
+
+func (r *json5Reader) key() error {
+
+	if r.pos >= len(r.src) {
+		return r.errorf("unexpected end of input")
+	}
+	if c := r.src[r.pos]; c == '"' || c == '\'' {
+		s, err := r.str()
+		if err != nil {
+			return err
+		}
+		r.out.WriteString(jsonQuote(s))
+		return nil
+	}
+
+	start := r.pos
+	id := r.identifier()
+	if len(id) < 1 {
+		return r.errorAt(start, "unexpected character %q in object key", firstRune(r.src[start:]))
+	}
+	r.out.WriteString(jsonQuote(id))
+	return nil
+}
+
+// identifier reads a name made of letters, digits, _ and $, not beginning with a
+// digit, returning "" if none is present.
+func (r *json5Reader) identifier() string {
+	start := r.pos
+	for r.pos < len(r.src) {
+		c, size := utf8.DecodeRune(r.src[r.pos:])
+		if !(c == '_' || c == '$' || unicode.IsLetter(c) || (r.pos > start && unicode.IsDigit(c))) {
+			break
+		}
+		r.pos += size
+	}
+	return string(r.src[start:r.pos])
+}
+
+// str reads a string delimited by double or single quotes, returning its value.
+func (r *json5Reader) str() (string, error) {
+
+	quote := r.src[r.pos]
+	start := r.pos
+	r.pos++
+
+	var buf strings.Builder
+	for {
+		if r.pos >= len(r.src) {
+			return "", r.errorAt(start, "unterminated string")
+		}
+		c, size := utf8.DecodeRune(r.src[r.pos:])
+		switch {
+		case c == rune(quote):
+			r.pos++
+			return buf.String(), nil
+		case c == '\n' || c == '\r':
+			return "", r.errorf("unescaped line break in string")
+		case c == '\\':
+			if err := r.escape(&buf); err != nil {
+				return "", err
+			}
+		default:
+			buf.WriteRune(c)
+			r.pos += size
+		}
+	}
+}
+
+// escape reads the escape sequence at the current position into buf.
+func (r *json5Reader) escape(buf *strings.Builder) error {
+
+	start := r.pos
+	r.pos++
+	if r.pos >= len(r.src) {
+		return r.errorAt(start, "unterminated string")
+	}
+
+	c, size := utf8.DecodeRune(r.src[r.pos:])
+	r.pos += size
+	switch c {
+	case 'b':
+		buf.WriteByte('\b')
+	case 'f':
+		buf.WriteByte('\f')
+	case 'n':
+		buf.WriteByte('\n')
+	case 'r':
+		buf.WriteByte('\r')
+	case 't':
+		buf.WriteByte('\t')
+	case 'v':
+		buf.WriteByte('\v')
+	case '0':
+		buf.WriteByte(0)
+	case '\r':
+		// a line continuation, possibly \r\n
+		if r.pos < len(r.src) && r.src[r.pos] == '\n' {
+			r.pos++
+		}
+	case '\n', '\u2028', '\u2029':
+		// a line continuation
+	case 'x', 'u':
+		n := 2
+		if c == 'u' {
+			n = 4
+		}
+		code, ok := r.hex(n)
+		if !ok {
+			return r.errorAt(start, "invalid escape sequence")
+		}
+		if utf16Surrogate(code) && bytes.HasPrefix(r.src[r.pos:], []byte(`\u`)) {
+			save := r.pos
+			r.pos += 2
+			if low, ok := r.hex(4); ok && low >= 0xdc00 && low <= 0xdfff {
+				code = 0x10000 + (code-0xd800)<<10 + (low - 0xdc00)
+			} else {
+				r.pos = save
+			}
+		}
+		buf.WriteRune(rune(code))
+	default:
+		if c >= '1' && c <= '9' {
+			return r.errorAt(start, "invalid escape sequence")
+		}
+		buf.WriteRune(c)
+	}
+	return nil
+}
+
+func utf16Surrogate(code int) bool {
+	return code >= 0xd800 && code <= 0xdbff
+}
+
+// hex reads n hexadecimal digits, returning their value.
+func (r *json5Reader) hex(n int) (int, bool) {
+	if r.pos+n > len(r.src) {
+		return 0, false
+	}
+	code := 0
+	for _, c := range r.src[r.pos : r.pos+n] {
+		d := strings.IndexByte("0123456789abcdef", byte(unicode.ToLower(rune(c))))
+		if d < 0 {
+			return 0, false
+		}
+		code = code*16 + d
+	}
+	r.pos += n
+	return code, true
+}
+
+// number reads a decimal or hexadecimal number, writing it as a json number.
+func (r *json5Reader) number() error {
+
+	start := r.pos
+	neg := false
+	if c := r.src[r.pos]; c == '-' || c == '+' {
+		neg = c == '-'
+		r.pos++
+	}
+
+	var digits strings.Builder
+	if neg {
+		digits.WriteByte('-')
+	}
+
+	if bytes.HasPrefix(r.src[r.pos:], []byte("0x")) || bytes.HasPrefix(r.src[r.pos:], []byte("0X")) {
+		r.pos += 2
+		hexStart := r.pos
+		for r.pos < len(r.src) && strings.IndexByte("0123456789abcdefABCDEF", r.src[r.pos]) >= 0 {
+			r.pos++
+		}
+		n, ok := new(big.Int).SetString(string(r.src[hexStart:r.pos]), 16)
+		if !ok {
+			return r.errorAt(start, "invalid hexadecimal number")
+		}
+		if neg {
+			n.Neg(n)
+		}
+		r.out.WriteString(n.String())
+		return r.numberEnd(start)
+	}
+
+	intPart := r.digits()
+	fracPart := ""
+	if r.pos < len(r.src) && r.src[r.pos] == '.' {
+		r.pos++
+		fracPart = r.digits()
+	}
+	if len(intPart) < 1 && len(fracPart) < 1 {
+		if r.pos-start == 1 && (r.src[start] == '+' || r.src[start] == '-') {
+			if id := r.identifier(); id == "Infinity" || id == "NaN" {
+				return r.errorAt(start, "%s is not supported", id)
+			}
+		}
+		return r.errorAt(start, "invalid number")
+	}
+	if len(intPart) > 1 && intPart[0] == '0' {
+		return r.errorAt(start, "invalid number with leading zero")
+	}
+
+	if len(intPart) < 1 {
+		intPart = "0"
+	}
+	digits.WriteString(intPart)
+	if len(fracPart) > 0 {
+		digits.WriteString("." + fracPart)
+	}
+
+	if r.pos < len(r.src) && (r.src[r.pos] == 'e' || r.src[r.pos] == 'E') {
+		r.pos++
+		digits.WriteByte('e')
+		if r.pos < len(r.src) && (r.src[r.pos] == '-' || r.src[r.pos] == '+') {
+			digits.WriteByte(r.src[r.pos])
+			r.pos++
+		}
+		exp := r.digits()
+		if len(exp) < 1 {
+			return r.errorAt(start, "invalid number exponent")
+		}
+		digits.WriteString(exp)
+	}
+
+	r.out.WriteString(digits.String())
+	return r.numberEnd(start)
+}
+
+func (r *json5Reader) digits() string {
+	start := r.pos
+	for r.pos < len(r.src) && r.src[r.pos] >= '0' && r.src[r.pos] <= '9' {
+		r.pos++
+	}
+	return string(r.src[start:r.pos])
+}
+
+// numberEnd checks that the number beginning at start is not run together with a
+// following name or number.
+func (r *json5Reader) numberEnd(start int) error {
+	if r.pos < len(r.src) {
+		if c := firstRune(r.src[r.pos:]); c == '_' || c == '$' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+			return r.errorAt(start, "invalid number")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package gostree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestJson5(t *testing.T) {
+
+	defer log.Flush()
+
+	settings := `// editor settings
+{
+	/* appearance */
+	"editor.fontSize": 14,
+	theme: 'dark',
+	$schema: 'http://example.com/s.json', // a url, not a comment
+	mask: 0xFF,
+	ratio: .5,
+	scale: +2.,
+	"files.exclude": {
+		'**/.git': true,
+		"**/node_modules": true,
+	},
+	rulers: [80, 120,],
+	quote: 'it\'s "fine"',
+	long: 'line one \
+line two',
+	ünïcode: 'é\x41',
+}
+`
+
+	Convey("Test NewSTreeJson with WithJson5\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(settings), WithJson5(true))
+		So(err, ShouldBeNil)
+		So(s.FloatValMust(`.editor\.fontSize`), ShouldEqual, 14)
+		So(s.StrValMust(".theme"), ShouldEqual, "dark")
+		So(s.StrValMust(".$schema"), ShouldEqual, "http://example.com/s.json")
+		So(s.IntValMust(".mask"), ShouldEqual, 255)
+		So(s.FloatValMust(".ratio"), ShouldEqual, 0.5)
+		So(s.FloatValMust(".scale"), ShouldEqual, 2)
+		So(s.BoolValMust(`.files\.exclude.**/\.git`), ShouldBeTrue)
+		So(s.SliceValMust(".rulers"), ShouldHaveLength, 2)
+		So(s.StrValMust(".quote"), ShouldEqual, `it's "fine"`)
+		So(s.StrValMust(".long"), ShouldEqual, "line one line two")
+		So(s.StrValMust(".ünïcode"), ShouldEqual, "éA")
+
+		_, err = NewSTreeJson(strings.NewReader(settings))
+		So(err, ShouldNotBeNil)
+
+		r, err := NewSTreeJson(strings.NewReader(`{big: 0x1FFFFFFFFFFFFF1, neg: -0x10}`),
+			WithJson5(true), WithJsonNumbers(JsonNumberExact))
+		So(err, ShouldBeNil)
+		So(r.IntValMust(".big"), ShouldEqual, int64(0x1FFFFFFFFFFFFF1))
+		So(r.IntValMust(".neg"), ShouldEqual, -16)
+	})
+
+	Convey("Test WithJson5 with other readers\n", t, func() {
+		d, err := NewDocumentJson(strings.NewReader("[1, 2, /* three */ 3,]"), WithJson5(true))
+		So(err, ShouldBeNil)
+		So(d.ValMust(".[2]"), ShouldEqual, 3)
+
+		o, err := NewOrderedSTreeJson(strings.NewReader("{z: 1, a: 2,}"), WithJson5(true))
+		So(err, ShouldBeNil)
+		keys, err := o.OrderedKeys(".")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"z", "a"})
+
+		dec := NewJsonLinesDecoder(strings.NewReader("{a: 1}\n{b: 'two',}\n"), WithJson5(true))
+		s, err := dec.Next()
+		So(err, ShouldBeNil)
+		So(s.FloatValMust(".a"), ShouldEqual, 1)
+		s, err = dec.Next()
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".b"), ShouldEqual, "two")
+	})
+
+	Convey("Test WithJson5 syntax errors\n", t, func() {
+		var sErr *SyntaxError
+		cases := []struct {
+			src          string
+			line, column int
+		}{
+			{"{\n  a: 1,\n  b: @\n}", 3, 6},
+			{"{\n  a: 'open\n}", 2, 11},
+			{"{a: 1 b: 2}", 1, 7},
+			{"{a: 1} /* unterminated", 1, 8},
+			{"{a: Infinity}", 1, 5},
+			{"{a: 012}", 1, 5},
+			{"{ünï: 1, 'x': }", 1, 15},
+			{"{a: 1", 1, 6},
+			{"{a: 1} 2", 1, 8},
+		}
+		for _, c := range cases {
+			_, err := NewSTreeJson(strings.NewReader(c.src), WithJson5(true))
+			So(err, ShouldNotBeNil)
+			So(errors.As(err, &sErr), ShouldBeTrue)
+			So([]int{sErr.Line, sErr.Column}, ShouldResemble, []int{c.line, c.column})
+		}
+		So(sErr.Error(), ShouldEqual, "syntax error at line 1, column 8: invalid data after top-level value")
+	})
+}
@@ -0,0 +1,86 @@
+package gostree
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// JsonLinesDecoder reads newline-delimited json, also known as JSON Lines or
+// NDJSON, returning one STree per line. The stream is read a line at a time, so
+// arbitrarily long streams can be processed without holding them in memory.
+type JsonLinesDecoder struct {
+	c    *jsonCodec
+	r    *bufio.Reader
+	line int // the number of lines read so far
+	done bool
+}
+
+// NewJsonLinesDecoder returns a JsonLinesDecoder reading from the specified reader,
+// storing numbers as configured by opts.
+func NewJsonLinesDecoder(r io.Reader, opts ...JsonOption) *JsonLinesDecoder {
+	return &JsonLinesDecoder{c: newJsonCodec(opts), r: bufio.NewReader(r)}
+}
+
+// Next returns the STree held by the next line of the stream, or io.EOF once the
+// stream is exhausted. Blank lines are skipped. Errors name the offending line.
+func (d *JsonLinesDecoder) Next() (STree, error) {
+
+	for !d.done {
+		line, err := d.r.ReadBytes('\n')
+		if err == io.EOF {
+			d.done = true
+		} else if err != nil {
+			return nil, fmt.Errorf("JsonLinesDecoder error reading line %d: %v", d.line+1, err)
+		}
+		if len(line) < 1 {
+			continue
+		}
+		d.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) < 1 {
+			continue
+		}
+
+		s, err := d.c.unmarshal(line)
+		if err != nil {
+			return nil, fmt.Errorf("JsonLinesDecoder %w at line %d", err, d.line)
+		}
+		return s, nil
+	}
+
+	return nil, io.EOF
+}
+
+// Line returns the number of the line holding the STree most recently returned
+// by Next.
+func (d *JsonLinesDecoder) Line() int {
+	return d.line
+}
+
+// JsonLinesEncoder writes STrees as newline-delimited json, one compact json
+// object per line.
+type JsonLinesEncoder struct {
+	w io.Writer
+}
+
+// NewJsonLinesEncoder returns a JsonLinesEncoder writing to the specified writer.
+func NewJsonLinesEncoder(w io.Writer) *JsonLinesEncoder {
+	return &JsonLinesEncoder{w: w}
+}
+
+// Encode writes the STree to the stream as a single line.
+func (e *JsonLinesEncoder) Encode(s STree) error {
+
+	out, err := s.WriteJson(false)
+	if err != nil {
+		return fmt.Errorf("JsonLinesEncoder error in WriteJson: %v", err)
+	}
+	_, err = e.w.Write(append(out, '\n'))
+	if err != nil {
+		return fmt.Errorf("JsonLinesEncoder error writing bytes: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package gostree
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeJsonLines(t *testing.T) {
+
+	defer log.Flush()
+
+	events := `{"id": 1, "type": "login", "user": {"name": "ann"}}
+{"id": 2, "type": "view", "pages": ["/", "/about"]}
+
+{"id": 3, "type": "logout", "user": {"name": "ann"}}
+`
+
+	Convey("Test JsonLinesDecoder\n", t, func() {
+		d := NewJsonLinesDecoder(strings.NewReader(events))
+		trees := []STree{}
+		lines := []int{}
+		for {
+			s, err := d.Next()
+			if err == io.EOF {
+				break
+			}
+			So(err, ShouldBeNil)
+			trees = append(trees, s)
+			lines = append(lines, d.Line())
+		}
+		So(trees, ShouldHaveLength, 3)
+		So(lines, ShouldResemble, []int{1, 2, 4})
+		So(trees[1].StrValMust(".pages[1]"), ShouldEqual, "/about")
+
+		comp, err := trees[0].STreeValMust(".user").CompareTo(trees[2].STreeValMust(".user"))
+		So(err, ShouldBeNil)
+		So(comp[".name"], ShouldEqual, COMP_NO_DIFFERENCE)
+
+		_, err = d.Next()
+		So(err, ShouldEqual, io.EOF)
+
+		d = NewJsonLinesDecoder(strings.NewReader("{\"a\": 1}\r\n{\"b\": 2}"))
+		s, err := d.Next()
+		So(err, ShouldBeNil)
+		So(s.FloatValMust(".a"), ShouldEqual, 1)
+		s, err = d.Next()
+		So(err, ShouldBeNil)
+		So(s.FloatValMust(".b"), ShouldEqual, 2)
+
+		d = NewJsonLinesDecoder(strings.NewReader("{\"a\": 1}\n\n{\"b\": \n"))
+		_, err = d.Next()
+		So(err, ShouldBeNil)
+		_, err = d.Next()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "line 3")
+
+		d = NewJsonLinesDecoder(strings.NewReader("[1, 2]\n"))
+		_, err = d.Next()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "line 1")
+	})
+
+	Convey("Test JsonLinesEncoder\n", t, func() {
+		var buf bytes.Buffer
+		e := NewJsonLinesEncoder(&buf)
+		So(e.Encode(STree{"id": 1, "tags": []interface{}{"a", "b"}}), ShouldBeNil)
+		So(e.Encode(STree{"id": 2, "user": STree{"name": "bob"}}), ShouldBeNil)
+		So(buf.String(), ShouldEqual, "{\"id\":1,\"tags\":[\"a\",\"b\"]}\n{\"id\":2,\"user\":{\"name\":\"bob\"}}\n")
+
+		d := NewJsonLinesDecoder(&buf)
+		s, err := d.Next()
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".tags[0]"), ShouldEqual, "a")
+		s, err = d.Next()
+		So(err, ShouldBeNil)
+		So(s.StrValMust(".user.name"), ShouldEqual, "bob")
+
+		buf.Reset()
+		So(e.Encode(STree{1: "one"}), ShouldBeNil)
+		So(buf.String(), ShouldEqual, "{\"1\":\"one\"}\n")
+		So(e.Encode(STree{1: "one", "1": "two"}), ShouldNotBeNil)
+	})
+}
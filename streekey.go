@@ -0,0 +1,153 @@
+package gostree
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Keys of an STree read from yaml need not be strings; yaml allows integer, float,
+// boolean and null keys, e.g. ports: {80: http}. Within a path such a key is written
+// as its yaml scalar enclosed in braces, e.g. .ports.{80}, .{true} or .{null}. A
+// string key which is itself enclosed in braces is written as a quoted scalar, e.g.
+// .{"{name}"}, as is a string key beginning with a brace or containing a bracket,
+// e.g. .{"a[0]"}, so that every key has exactly one path component. Formats having
+// only string keys, such as json, write non-string keys as their yaml scalars.
+
+// isBraced returns true if s is enclosed in braces.
+func isBraced(s string) bool {
+	return len(s) > 1 && s[0] == '{' && s[len(s)-1] == '}'
+}
+
+// bracedEnd returns the index just past the brace closing the braced key at the
+// start of c, skipping braces and brackets within quoted strings, or -1 if it is
+// not closed.
+func bracedEnd(c string) int {
+	depth := 0
+	for i := 0; i < len(c); i++ {
+		switch c[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		case '"', '\'':
+			q := c[i]
+			for i++; i < len(c) && c[i] != q; i++ {
+				if c[i] == '\\' && q == '"' {
+					i++
+				}
+			}
+			if i >= len(c) {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+// unescapeBraced returns the braced key c with each escaped dot, as written by
+// FieldPath.String, unescaped, leaving any other escape sequence as it is.
+func unescapeBraced(c string) string {
+	var b strings.Builder
+	for i := 0; i < len(c); i++ {
+		if c[i] == '\\' && i+1 < len(c) {
+			if i++; c[i] != '.' {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteByte(c[i])
+	}
+	return b.String()
+}
+
+// splitComponent splits the path component c into its key, braced or not, and
+// the subscripts following it, e.g. {"a[0]"} and [1][2] for {"a[0]"}[1][2].
+func splitComponent(c string) (key, subscripts string, ok bool) {
+	end := strings.IndexAny(c, "[]")
+	if strings.HasPrefix(c, "{") {
+		if end = bracedEnd(c); end < 0 {
+			return "", "", false
+		}
+	} else if end < 0 {
+		end = len(c)
+	}
+	return c[:end], c[end:], subscriptsRegexp.MatchString(c[end:])
+}
+
+// keyOf returns the STree key denoted by the key part of a path component, which is
+// the scalar within braces, e.g. the int 42 for {42}, or otherwise c itself.
+func keyOf(c string) (interface{}, error) {
+
+	if !isBraced(c) {
+		return c, nil
+	}
+
+	scalar := strings.TrimSpace(c[1 : len(c)-1])
+	if len(scalar) < 1 {
+		return nil, fmt.Errorf("keyOf found no scalar within %s", c)
+	}
+	var k interface{}
+	if err := yaml.Unmarshal([]byte(scalar), &k); err != nil {
+		return nil, fmt.Errorf("keyOf error in yaml.Unmarshal of %s: %v", c, err)
+	}
+	if k != nil && !IsPrimitive(k) {
+		return nil, fmt.Errorf("keyOf found non-scalar key %s", c)
+	}
+	return k, nil
+}
+
+// keyComponent returns the path component denoting the STree key k.
+func keyComponent(k interface{}) string {
+	if s, ok := k.(string); ok {
+		if strings.HasPrefix(s, "{") || strings.ContainsAny(s, "[]") {
+			return "{" + strconv.Quote(s) + "}"
+		}
+		return s
+	}
+	return "{" + keyString(k) + "}"
+}
+
+// keyString returns k as written to formats having only string keys, i.e. k itself
+// if it is a string and its yaml scalar otherwise.
+func keyString(k interface{}) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	out, err := yaml.Marshal(k)
+	if err != nil {
+		return fmt.Sprintf("%v", k)
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// keyCollision returns an error if two keys of t are written as the same string by
+// keyString.
+func (t STree) keyCollision() error {
+	written := map[string]interface{}{}
+	for _, k := range t.sortedKeys() {
+		kStr := keyString(k)
+		if other, ok := written[kStr]; ok {
+			return fmt.Errorf("found keys %s and %s both written as %q", keyComponent(other), keyComponent(k), kStr)
+		}
+		written[kStr] = k
+	}
+	return nil
+}
+
+// pointerKey returns the key of t denoted by the JSON Pointer token tok, i.e. tok
+// itself or, failing that, the non-string key written as tok by keyString.
+func pointerKey(t STree, tok string) interface{} {
+	if _, ok := t[tok]; ok {
+		return tok
+	}
+	for _, k := range t.sortedKeys() {
+		if _, isStr := k.(string); !isStr && keyString(k) == tok {
+			return k
+		}
+	}
+	return tok
+}
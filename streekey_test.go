@@ -0,0 +1,173 @@
+package gostree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeKeys(t *testing.T) {
+
+	defer log.Flush()
+
+	y := `
+ports:
+  80: http
+  443: [https, h2]
+flags:
+  true: enabled
+  ~: none
+ratios: {0.5: half}
+"{braced}": quoted
+"80": eighty
+`
+
+	Convey("Test non-string key paths\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(y))
+		So(err, ShouldBeNil)
+
+		So(s.StrValMust(".ports.{80}"), ShouldEqual, "http")
+		So(s.StrValMust(".ports.{443}[1]"), ShouldEqual, "h2")
+		So(s.StrValMust(".flags.{true}"), ShouldEqual, "enabled")
+		So(s.StrValMust(".flags.{null}"), ShouldEqual, "none")
+		So(s.StrValMust(".ratios.{0.5}"), ShouldEqual, "half")
+		So(s.StrValMust(`.ratios.{0\.5}`), ShouldEqual, "half")
+		So(s.StrValMust(`.{"{braced}"}`), ShouldEqual, "quoted")
+		So(s.StrValMust(".80"), ShouldEqual, "eighty")
+		So(s.StrValMust("/ports/80"), ShouldEqual, "http")
+
+		_, err = s.Val(".ports.80")
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		_, err = s.Val(".ports.{[1]}")
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		_, err = s.Val(".ports.{ }")
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+
+		paths := []string{}
+		for _, p := range s.FieldPaths() {
+			paths = append(paths, p.String())
+		}
+		So(paths, ShouldContain, ".ports.{80}")
+		So(paths, ShouldContain, ".ports.{443}[0]")
+		So(paths, ShouldContain, ".flags.{true}")
+		So(paths, ShouldContain, ".flags.{null}")
+		So(paths, ShouldContain, `.ratios.{0\.5}`)
+		So(paths, ShouldContain, `.{"{braced}"}`)
+		for _, p := range paths {
+			_, err := s.Val(p)
+			So(err, ShouldBeNil)
+		}
+
+		keys, err := s.STreeValMust(".ports").KeyStrings()
+		So(err, ShouldBeNil)
+		So(keys, ShouldContain, "{80}")
+
+		visited := []string{}
+		err = s.Visit(NewVisitorBuilder().
+			WithPrimitiveVisitor(func(key string, val interface{}) error {
+				visited = append(visited, key)
+				return nil
+			}).
+			Visitor())
+		So(err, ShouldBeNil)
+		So(visited, ShouldContain, ".ports.{443}[1]")
+
+		m, err := s.Query(".ports.*")
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 2)
+		So(m[0].Path.String(), ShouldEqual, ".ports.{443}")
+		m, err = s.Query("..{80}")
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 1)
+		So(m[0].Val, ShouldEqual, "http")
+		_, err = s.Query(".ports.{80")
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+	})
+
+	Convey("Test keys holding braces, brackets, quotes and dots\n", t, func() {
+		s := STree{
+			"b}c[0]": 2,
+			"{x":     STree{`say "hi"[1]`: []interface{}{STree{"a.b}": 3}}},
+			"]{":     STree{"{": "open", "}": "close", `\`: "backslash"},
+			"'q'[":   4,
+			"z":      1,
+		}
+
+		paths := s.FieldPaths()
+		So(paths, ShouldHaveLength, 7)
+		for _, f := range paths {
+			v, err := s.Val(f.String())
+			So(err, ShouldBeNil)
+			So(v, ShouldNotBeNil)
+			r, err := ValueOfPath(f.String())
+			So(err, ShouldBeNil)
+			So(r, ShouldResemble, f)
+			m, err := s.Query(f.String())
+			So(err, ShouldBeNil)
+			So(m, ShouldHaveLength, 1)
+			So(m[0].Val, ShouldEqual, v)
+		}
+
+		So(s.IntValMust(`.{"b}c[0]"}`), ShouldEqual, 2)
+		So(s.IntValMust(`.{"{x"}.{"say \"hi\"[1]"}[0].a\.b}`), ShouldEqual, 3)
+		So(s.StrValMust(`.{"]{"}.{"{"}`), ShouldEqual, "open")
+		_, err := s.Val(`.{"b}c[0]"`)
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+
+		c, err := s.SetVal(`.{"b}c[0]"}`, 5)
+		So(err, ShouldBeNil)
+		So(c["b}c[0]"], ShouldEqual, 5)
+	})
+
+	Convey("Test non-string keys through modification\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(y))
+		So(err, ShouldBeNil)
+
+		c, err := s.SetVal(".ports.{8080}", "alt")
+		So(err, ShouldBeNil)
+		So(c.STreeValMust(".ports")[8080], ShouldEqual, "alt")
+		So(c.STreeValMust(".ports")[80], ShouldEqual, "http")
+		_, ok := s.STreeValMust(".ports")[8080]
+		So(ok, ShouldBeFalse)
+
+		c, err = s.SetVal(".new.{false}.list[1]", 2)
+		So(err, ShouldBeNil)
+		So(c.IntValMust(".new.{false}.list[1]"), ShouldEqual, 2)
+
+		c, err = s.Delete(".ports.{80}")
+		So(err, ShouldBeNil)
+		So(c.STreeValMust(".ports"), ShouldHaveLength, 1)
+
+		p := DiffMust(s, c)
+		So(p, ShouldHaveLength, 1)
+		So(p[0].Path, ShouldEqual, "/ports/80")
+		r, err := s.ApplyPatch(p)
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, c)
+	})
+
+	Convey("Test writing non-string keys\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader("ports: {80: http, 443: https}\nflags: {true: yes please, ~: none, 0.5: half}\n"))
+		So(err, ShouldBeNil)
+
+		out, err := s.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `{"flags":{"0.5":"half","null":"none","true":"yes please"},"ports":{"443":"https","80":"http"}}`)
+
+		y, err := s.WriteYaml()
+		So(err, ShouldBeNil)
+		r, err := NewSTreeYaml(strings.NewReader(string(y)))
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, s)
+
+		_, err = STree{80: "http", "80": "eighty"}.WriteJson(false)
+		So(err, ShouldNotBeNil)
+		_, err = STree{"a": STree{true: 1, "true": 2}}.WriteJson(false)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,237 @@
+package gostree
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// SliceStrategy determines how Merge combines two slices found at the same path.
+type SliceStrategy int
+
+const (
+	MERGE_SLICE_REPLACE  SliceStrategy = iota // the slice of the other STree replaces the subject slice
+	MERGE_SLICE_APPEND                 = iota // the elements of the other slice are appended to the subject slice
+	MERGE_SLICE_BY_INDEX               = iota // elements at the same index are merged, extra elements are appended
+	MERGE_SLICE_BY_KEY                 = iota // STree elements sharing the value of a key field are merged, others are appended
+)
+
+// ConflictPolicy determines how Merge resolves a path at which both STrees hold
+// values that cannot be merged recursively.
+type ConflictPolicy int
+
+const (
+	MERGE_RIGHT_WINS             ConflictPolicy = iota // the value of the other STree is taken
+	MERGE_LEFT_WINS                             = iota // the value of the subject STree is kept
+	MERGE_ERROR_ON_TYPE_CONFLICT                = iota // the value of the other STree is taken unless its kind differs
+)
+
+// MergeOption configures the behavior of Merge.
+type MergeOption func(*merger)
+
+// WithSliceStrategy sets the strategy used to combine slices, MERGE_SLICE_REPLACE
+// by default.
+func WithSliceStrategy(s SliceStrategy) MergeOption {
+	return func(m *merger) { m.sliceStrategy = s }
+}
+
+// WithSliceMergeKey sets the strategy used to combine slices to MERGE_SLICE_BY_KEY,
+// matching STree elements by the value stored under key, e.g. "name".
+func WithSliceMergeKey(key string) MergeOption {
+	return func(m *merger) {
+		m.sliceStrategy = MERGE_SLICE_BY_KEY
+		m.sliceKey = key
+	}
+}
+
+// WithConflictPolicy sets the policy used to resolve conflicting values,
+// MERGE_RIGHT_WINS by default.
+func WithConflictPolicy(p ConflictPolicy) MergeOption {
+	return func(m *merger) { m.conflictPolicy = p }
+}
+
+// Merge returns a copy of the subject STree with o recursively merged into it.
+// Nested STrees are merged key by key, slices are combined according to the
+// configured SliceStrategy and all other conflicts are resolved according to the
+// configured ConflictPolicy. The paths at which a value of the subject was
+// replaced by a different value from o are returned in deterministic order.
+func (t STree) Merge(o STree, opts ...MergeOption) (STree, []FieldPath, error) {
+
+	m := &merger{}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.sliceStrategy == MERGE_SLICE_BY_KEY && len(m.sliceKey) < 1 {
+		return nil, nil, fmt.Errorf("Merge requires a key for MERGE_SLICE_BY_KEY, see WithSliceMergeKey")
+	}
+
+	clone, err := t.clone()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Merge clone error: %v", err)
+	}
+	oClone, err := o.clone()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Merge clone error: %v", err)
+	}
+
+	if err = m.mergeSTree(FieldPath{}, clone, oClone); err != nil {
+		return nil, nil, err
+	}
+
+	return clone, m.overridden, nil
+}
+
+func (t STree) MergeMust(o STree, opts ...MergeOption) STree {
+	u, _, err := t.Merge(o, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+type merger struct {
+	sliceStrategy  SliceStrategy
+	sliceKey       string
+	conflictPolicy ConflictPolicy
+	overridden     []FieldPath
+}
+
+// mergeSTree merges each entry of r into l in place.
+func (m *merger) mergeSTree(path FieldPath, l, r STree) error {
+
+	for _, k := range r.sortedKeys() {
+
+		rVal := r[k]
+		lVal, ok := l[k]
+		if !ok {
+			l[k] = rVal
+			continue
+		}
+
+		val, err := m.mergeVal(path.append(keyComponent(k)), lVal, rVal)
+		if err != nil {
+			return err
+		}
+		l[k] = val
+	}
+
+	return nil
+}
+
+// mergeVal returns the result of merging r into l, both found at path.
+func (m *merger) mergeVal(path FieldPath, l, r interface{}) (interface{}, error) {
+
+	if lTree, ok := l.(STree); ok {
+		if rTree, ok := r.(STree); ok {
+			return lTree, m.mergeSTree(path, lTree, rTree)
+		}
+	}
+
+	if lSlice, ok := l.([]interface{}); ok {
+		if rSlice, ok := r.([]interface{}); ok {
+			return m.mergeSlice(path, lSlice, rSlice)
+		}
+	}
+
+	return m.resolve(path, l, r)
+}
+
+func (m *merger) mergeSlice(path FieldPath, l, r []interface{}) (interface{}, error) {
+
+	switch m.sliceStrategy {
+
+	case MERGE_SLICE_APPEND:
+		return append(l, r...), nil
+
+	case MERGE_SLICE_BY_INDEX:
+		for i, rVal := range r {
+			if i >= len(l) {
+				l = append(l, rVal)
+				continue
+			}
+			val, err := m.mergeVal(indexPath(path, i), l[i], rVal)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = val
+		}
+		return l, nil
+
+	case MERGE_SLICE_BY_KEY:
+		for _, rVal := range r {
+			i := m.keyIndex(l, rVal)
+			if i < 0 {
+				l = append(l, rVal)
+				continue
+			}
+			val, err := m.mergeVal(indexPath(path, i), l[i], rVal)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = val
+		}
+		return l, nil
+
+	default:
+		return m.resolve(path, l, r)
+	}
+}
+
+// keyIndex returns the index of the STree element of l whose value at the merge
+// key matches that of val, or -1 if there is none.
+func (m *merger) keyIndex(l []interface{}, val interface{}) int {
+
+	vTree, ok := val.(STree)
+	if !ok {
+		return -1
+	}
+	vKey, ok := vTree[m.sliceKey]
+	if !ok {
+		return -1
+	}
+
+	for i, lVal := range l {
+		if lTree, ok := lVal.(STree); ok {
+			if lKey, ok := lTree[m.sliceKey]; ok && reflect.DeepEqual(lKey, vKey) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// resolve applies the conflict policy to the values l and r found at path.
+func (m *merger) resolve(path FieldPath, l, r interface{}) (interface{}, error) {
+
+	switch m.conflictPolicy {
+	case MERGE_LEFT_WINS:
+		return l, nil
+	case MERGE_ERROR_ON_TYPE_CONFLICT:
+		if kindsConflict(l, r) {
+			return nil, &PathError{Op: "Merge", Path: path.String(), Component: path.last(),
+				Expected: kindName(l), Actual: kindName(r), Err: ErrTypeMismatch}
+		}
+	}
+
+	if !reflect.DeepEqual(l, r) {
+		m.overridden = append(m.overridden, path)
+	}
+	return r, nil
+}
+
+// kindsConflict returns true if neither l nor r is nil and their kinds differ,
+// treating all numeric kinds as equivalent.
+func kindsConflict(l, r interface{}) bool {
+	if l == nil || r == nil {
+		return false
+	}
+	lKind, rKind := kindName(l), kindName(r)
+	if (lKind == KindInt || lKind == KindFloat) && (rKind == KindInt || rKind == KindFloat) {
+		return false
+	}
+	return lKind != rKind
+}
+
+// indexPath returns path with the subscript i appended to its last component.
+func indexPath(path FieldPath, i int) FieldPath {
+	return path[:len(path)-1].append(fmt.Sprintf("%s[%d]", path.last(), i))
+}
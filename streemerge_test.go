@@ -0,0 +1,159 @@
+package gostree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeMerge(t *testing.T) {
+
+	defer log.Flush()
+
+	base := `
+---
+name: base
+server:
+  host: localhost
+  port: 8080
+  tls:
+    enabled: false
+services:
+- name: web
+  image: web:1.0
+  replicas: 1
+- name: db
+  image: db:1.0
+tags: [a, b]
+`
+
+	override := `
+---
+server:
+  port: 9090
+  tls:
+    enabled: true
+    cert: /etc/cert.pem
+services:
+- name: db
+  image: db:2.0
+- name: cache
+  image: cache:1.0
+tags: [c]
+env: prod
+`
+
+	newTrees := func() (STree, STree) {
+		s, err := NewSTreeYaml(strings.NewReader(base))
+		So(err, ShouldBeNil)
+		o, err := NewSTreeYaml(strings.NewReader(override))
+		So(err, ShouldBeNil)
+		return s, o
+	}
+
+	Convey("Test Merge defaults\n", t, func() {
+		s, o := newTrees()
+
+		m, overridden, err := s.Merge(o)
+		So(err, ShouldBeNil)
+		So(m.StrValMust(".name"), ShouldEqual, "base")
+		So(m.StrValMust(".env"), ShouldEqual, "prod")
+		So(m.StrValMust(".server.host"), ShouldEqual, "localhost")
+		So(m.IntValMust(".server.port"), ShouldEqual, 9090)
+		So(m.BoolValMust(".server.tls.enabled"), ShouldBeTrue)
+		So(m.StrValMust(".server.tls.cert"), ShouldEqual, "/etc/cert.pem")
+		So(m.SliceValMust(".tags"), ShouldResemble, []interface{}{"c"})
+		So(len(m.SliceValMust(".services")), ShouldEqual, 2)
+		So(m.StrValMust(".services[0].name"), ShouldEqual, "db")
+
+		So(overridden, ShouldResemble, []FieldPath{
+			{"server", "port"},
+			{"server", "tls", "enabled"},
+			{"services"},
+			{"tags"},
+		})
+
+		So(s.IntValMust(".server.port"), ShouldEqual, 8080)
+		So(len(s.SliceValMust(".services")), ShouldEqual, 2)
+	})
+
+	Convey("Test Merge slice append\n", t, func() {
+		s, o := newTrees()
+
+		m, _, err := s.Merge(o, WithSliceStrategy(MERGE_SLICE_APPEND))
+		So(err, ShouldBeNil)
+		So(m.SliceValMust(".tags"), ShouldResemble, []interface{}{"a", "b", "c"})
+		So(len(m.SliceValMust(".services")), ShouldEqual, 4)
+	})
+
+	Convey("Test Merge slice by index\n", t, func() {
+		s, o := newTrees()
+
+		m, overridden, err := s.Merge(o, WithSliceStrategy(MERGE_SLICE_BY_INDEX))
+		So(err, ShouldBeNil)
+		So(m.SliceValMust(".tags"), ShouldResemble, []interface{}{"c", "b"})
+		So(m.StrValMust(".services[0].name"), ShouldEqual, "db")
+		So(m.StrValMust(".services[0].image"), ShouldEqual, "db:2.0")
+		So(m.IntValMust(".services[0].replicas"), ShouldEqual, 1)
+		So(m.StrValMust(".services[1].name"), ShouldEqual, "cache")
+		So(overridden, ShouldContain, ValueOfPathMust(".services[0].name"))
+		So(overridden, ShouldContain, ValueOfPathMust(".tags[0]"))
+	})
+
+	Convey("Test Merge slice by key\n", t, func() {
+		s, o := newTrees()
+
+		m, overridden, err := s.Merge(o, WithSliceMergeKey("name"))
+		So(err, ShouldBeNil)
+		So(len(m.SliceValMust(".services")), ShouldEqual, 3)
+		So(m.StrValMust(".services[0].image"), ShouldEqual, "web:1.0")
+		So(m.StrValMust(".services[1].image"), ShouldEqual, "db:2.0")
+		So(m.StrValMust(".services[2].name"), ShouldEqual, "cache")
+		So(m.SliceValMust(".tags"), ShouldResemble, []interface{}{"a", "b", "c"})
+		So(overridden, ShouldContain, ValueOfPathMust(".services[1].image"))
+	})
+
+	Convey("Test Merge slice by key requires key\n", t, func() {
+		s, o := newTrees()
+		_, _, err := s.Merge(o, WithSliceStrategy(MERGE_SLICE_BY_KEY))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test Merge left wins\n", t, func() {
+		s, o := newTrees()
+
+		m, overridden, err := s.Merge(o, WithConflictPolicy(MERGE_LEFT_WINS))
+		So(err, ShouldBeNil)
+		So(m.IntValMust(".server.port"), ShouldEqual, 8080)
+		So(m.StrValMust(".server.tls.cert"), ShouldEqual, "/etc/cert.pem")
+		So(m.StrValMust(".env"), ShouldEqual, "prod")
+		So(m.SliceValMust(".tags"), ShouldResemble, []interface{}{"a", "b"})
+		So(overridden, ShouldBeEmpty)
+	})
+
+	Convey("Test Merge error on type conflict\n", t, func() {
+		s, o := newTrees()
+
+		_, _, err := s.Merge(o, WithConflictPolicy(MERGE_ERROR_ON_TYPE_CONFLICT))
+		So(err, ShouldBeNil)
+
+		o = o.SetValMust(".server.tls", "off")
+		_, _, err = s.Merge(o, WithConflictPolicy(MERGE_ERROR_ON_TYPE_CONFLICT))
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		var pErr *PathError
+		So(errors.As(err, &pErr), ShouldBeTrue)
+		So(pErr.Path, ShouldEqual, ".server.tls")
+		So(pErr.Expected, ShouldEqual, KindSTree)
+		So(pErr.Actual, ShouldEqual, KindString)
+
+		m, overridden, err := s.Merge(o)
+		So(err, ShouldBeNil)
+		So(m.StrValMust(".server.tls"), ShouldEqual, "off")
+		So(overridden, ShouldContain, ValueOfPathMust(".server.tls"))
+	})
+}
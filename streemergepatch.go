@@ -0,0 +1,106 @@
+package gostree
+
+import (
+	"fmt"
+)
+
+// ApplyMergePatch returns a copy of the STree with the RFC 7386 JSON Merge Patch
+// patch applied. Each key of patch with a nil value deletes the corresponding key,
+// each STree value is merged recursively into the corresponding STree, and every
+// other value, including slices, replaces the corresponding value wholesale.
+func (t STree) ApplyMergePatch(patch STree) (STree, error) {
+
+	clone, err := t.clone()
+	if err != nil {
+		return nil, fmt.Errorf("ApplyMergePatch clone error: %v", err)
+	}
+	pClone, err := patch.clone()
+	if err != nil {
+		return nil, fmt.Errorf("ApplyMergePatch clone error: %v", err)
+	}
+
+	return clone.mergePatch(pClone), nil
+}
+
+func (t STree) ApplyMergePatchMust(patch STree) STree {
+	u, err := t.ApplyMergePatch(patch)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// mergePatch applies patch to t in place and returns t.
+func (t STree) mergePatch(patch STree) STree {
+
+	for k, pVal := range patch {
+
+		if pVal == nil {
+			delete(t, k)
+			continue
+		}
+
+		pTree, ok := pVal.(STree)
+		if !ok {
+			t[k] = pVal
+			continue
+		}
+
+		tTree, ok := t[k].(STree)
+		if !ok {
+			tTree = NewSTree()
+		}
+		t[k] = tTree.mergePatch(pTree)
+	}
+
+	return t
+}
+
+// CreateMergePatch returns the RFC 7386 JSON Merge Patch which transforms from into
+// to. Because a merge patch cannot address slice elements or express a nil value,
+// changed slices are replaced wholesale and values which are nil in to are deleted.
+func CreateMergePatch(from, to STree) (STree, error) {
+
+	fClone, err := from.clone()
+	if err != nil {
+		return nil, fmt.Errorf("CreateMergePatch clone error: %v", err)
+	}
+	tClone, err := to.clone()
+	if err != nil {
+		return nil, fmt.Errorf("CreateMergePatch clone error: %v", err)
+	}
+
+	return createMergePatch(fClone, tClone), nil
+}
+
+func createMergePatch(from, to STree) STree {
+
+	patch := NewSTree()
+
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			patch[k] = nil
+		}
+	}
+
+	for k, tVal := range to {
+
+		fVal, ok := from[k]
+		if !ok {
+			patch[k] = tVal
+			continue
+		}
+
+		fTree, fOk := fVal.(STree)
+		tTree, tOk := tVal.(STree)
+		if fOk && tOk {
+			if sub := createMergePatch(fTree, tTree); len(sub) > 0 {
+				patch[k] = sub
+			}
+		} else if !valuesEqual(fVal, tVal) {
+			patch[k] = tVal
+		}
+	}
+
+	return patch
+}
@@ -0,0 +1,125 @@
+package gostree
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeMergePatch(t *testing.T) {
+
+	defer log.Flush()
+
+	json := `
+	{
+		"title": "Goodbye!",
+		"author": {"givenName": "John", "familyName": "Doe"},
+		"tags": ["example", "sample"],
+		"content": "This will be unchanged"
+	}`
+
+	Convey("Test ApplyMergePatch\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+		patch, err := NewSTreeJson(strings.NewReader(`
+		{
+			"title": "Hello!",
+			"phoneNumber": "+01-123-456-7890",
+			"author": {"familyName": null},
+			"tags": ["example"]
+		}`))
+		So(err, ShouldBeNil)
+
+		p, err := s.ApplyMergePatch(patch)
+		So(err, ShouldBeNil)
+		So(p.StrValMust(".title"), ShouldEqual, "Hello!")
+		So(p.StrValMust(".phoneNumber"), ShouldEqual, "+01-123-456-7890")
+		So(p.STreeValMust(".author"), ShouldResemble, STree{"givenName": "John"})
+		So(p.SliceValMust(".tags"), ShouldResemble, []interface{}{"example"})
+		So(p.StrValMust(".content"), ShouldEqual, "This will be unchanged")
+
+		So(s.StrValMust(".author.familyName"), ShouldEqual, "Doe")
+	})
+
+	Convey("Test ApplyMergePatch nested nulls\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(`{"a": {"b": {"c": 1, "d": 2}}, "e": "f"}`))
+		So(err, ShouldBeNil)
+		patch, err := NewSTreeJson(strings.NewReader(`{"a": {"b": {"c": null, "x": {"y": null, "z": 3}}}, "e": {"g": null}, "h": null}`))
+		So(err, ShouldBeNil)
+
+		p, err := s.ApplyMergePatch(patch)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, STree{
+			"a": STree{"b": STree{"d": 2.0, "x": STree{"z": 3.0}}},
+			"e": STree{},
+		})
+	})
+
+	Convey("Test ApplyMergePatch slices replaced wholesale\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(`{"a": [{"b": 1, "c": 2}, 3]}`))
+		So(err, ShouldBeNil)
+		patch, err := NewSTreeJson(strings.NewReader(`{"a": [{"b": 4}]}`))
+		So(err, ShouldBeNil)
+
+		p, err := s.ApplyMergePatch(patch)
+		So(err, ShouldBeNil)
+		So(p.SliceValMust(".a"), ShouldResemble, []interface{}{STree{"b": 4.0}})
+	})
+
+	Convey("Test CreateMergePatch\n", t, func() {
+		from, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+		to, err := NewSTreeJson(strings.NewReader(`
+		{
+			"title": "Hello!",
+			"author": {"givenName": "John", "middleName": "Q"},
+			"tags": ["example", "sample", "other"],
+			"content": "This will be unchanged"
+		}`))
+		So(err, ShouldBeNil)
+
+		patch, err := CreateMergePatch(from, to)
+		So(err, ShouldBeNil)
+		So(patch, ShouldResemble, STree{
+			"title":  "Hello!",
+			"author": STree{"familyName": nil, "middleName": "Q"},
+			"tags":   []interface{}{"example", "sample", "other"},
+		})
+
+		p, err := from.ApplyMergePatch(patch)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, to)
+
+		patch, err = CreateMergePatch(to, to)
+		So(err, ShouldBeNil)
+		So(patch, ShouldBeEmpty)
+	})
+
+	Convey("Test CreateMergePatch nested nulls and type changes\n", t, func() {
+		from, err := NewSTreeJson(strings.NewReader(`{"a": {"b": {"c": 1}}, "d": {"e": 2}, "f": [1]}`))
+		So(err, ShouldBeNil)
+		to, err := NewSTreeJson(strings.NewReader(`{"a": {"b": {}}, "d": "e", "f": {"g": 1}}`))
+		So(err, ShouldBeNil)
+
+		patch, err := CreateMergePatch(from, to)
+		So(err, ShouldBeNil)
+		So(patch, ShouldResemble, STree{
+			"a": STree{"b": STree{"c": nil}},
+			"d": "e",
+			"f": STree{"g": 1.0},
+		})
+
+		out, err := patch.WriteJson(false)
+		So(err, ShouldBeNil)
+		rt, err := NewSTreeJson(strings.NewReader(string(out)))
+		So(err, ShouldBeNil)
+
+		p, err := from.ApplyMergePatch(rt)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, to)
+	})
+}
@@ -1,51 +1,114 @@
 package gostree
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
+	"math/big"
+	"reflect"
 
 	log "github.com/cihub/seelog"
 )
 
-// clone returns a deep copy of the subject STree
+// clone returns a deep copy of the subject STree, independent of it in every part.
+// An STree or slice appearing at several places within the subject is copied
+// separately at each.
 func (t STree) clone() (STree, error) {
+	return copyVal(t, nil).(STree), nil
+}
 
-	gob.Register(map[interface{}]interface{}{})
-	gob.Register(STree(map[interface{}]interface{}{}))
-	gob.Register([]interface{}{})
+// cloneShared returns a deep copy of the subject STree, as clone does, except that
+// an STree or slice appearing at several places within the subject, as read from a
+// yaml alias by YamlAliasKeep, is copied once, so that the copies are shared in the
+// same way.
+func (t STree) cloneShared() (STree, error) {
+	return copyVal(t, map[interface{}]interface{}{}).(STree), nil
+}
 
-	var mod bytes.Buffer
-	enc := gob.NewEncoder(&mod)
-	dec := gob.NewDecoder(&mod)
+// sliceId identifies the backing array of a slice, for detecting shared slices.
+type sliceId struct {
+	first *interface{}
+	len   int
+}
 
-	err := enc.Encode(t)
-	if err != nil {
-		return nil, fmt.Errorf("clone Encode error: %v", err)
-	}
+// copyVal returns a deep copy of v. If seen is not nil, copied STrees and slices
+// are recorded in it, and each is copied only once.
+func copyVal(v interface{}, seen map[interface{}]interface{}) interface{} {
 
-	var clone STree
-	err = dec.Decode(&clone)
-	if err != nil {
-		return nil, fmt.Errorf("clone Decode error: %v", err)
+	switch tv := v.(type) {
+
+	case STree:
+		if tv == nil {
+			return tv
+		}
+		id := reflect.ValueOf(tv).Pointer()
+		if c, ok := seen[id]; ok {
+			return c
+		}
+		c := make(STree, len(tv))
+		if seen != nil {
+			seen[id] = c
+		}
+		for k, kv := range tv {
+			c[k] = copyVal(kv, seen)
+		}
+		return c
+
+	case map[interface{}]interface{}:
+		return map[interface{}]interface{}(copyVal(STree(tv), seen).(STree))
+
+	case []interface{}:
+		if len(tv) < 1 {
+			return tv
+		}
+		id := sliceId{&tv[0], len(tv)}
+		if c, ok := seen[id]; ok {
+			return c
+		}
+		c := make([]interface{}, len(tv))
+		if seen != nil {
+			seen[id] = c
+		}
+		for i, e := range tv {
+			c[i] = copyVal(e, seen)
+		}
+		return c
+
+	case *big.Int:
+		return new(big.Int).Set(tv)
+
+	case *big.Float:
+		return new(big.Float).Copy(tv)
+
+	case []byte:
+		c := make([]byte, len(tv))
+		copy(c, tv)
+		return c
 	}
 
-	return clone, nil
+	return v
 }
 
+// SetVal returns a copy of the STree with val stored at path, which may be written
+// in either jq-style or JSON Pointer syntax. For jq-style paths, any missing STrees
+// and slices along the path are created.
 func (t STree) SetVal(path string, val interface{}) (STree, error) {
 
 	clone, err := t.clone()
 	if err != nil {
 		return nil, fmt.Errorf("SetVal clone error: %v", err)
 	}
+	return clone.setValIn(path, val)
+}
+
+// setValIn stores val at path within t, itself a copy of the STree modified, and
+// returns the result.
+func (t STree) setValIn(path string, val interface{}) (STree, error) {
 
-	p, err := ValueOfPath(path)
+	p, err := t.fieldPathOf("SetVal", path)
 	if err != nil {
-		return nil, fmt.Errorf("SetVal ValueOfPath error: %v", err)
+		return nil, fmt.Errorf("SetVal ValueOfPath error: %w", err)
 	}
 
-	return clone.setPathVal(p, val)
+	return t.setPathVal(p, val)
 }
 
 func (t STree) SetValMust(path string, val interface{}) STree {
@@ -62,7 +125,7 @@ func (t STree) setPathVal(path FieldPath, val interface{}) (STree, error) {
 		return t, fmt.Errorf("setPathVal called with no path")
 	}
 
-	pathKey, pathIdx, err := t.parsePathComponent(path[0])
+	pathKey, pathIdxs, err := t.parsePathComponent(path[0])
 	if err != nil {
 		return t, fmt.Errorf("setPathVal parsePathComponent error: %v", err)
 	}
@@ -79,29 +142,20 @@ func (t STree) setPathVal(path FieldPath, val interface{}) (STree, error) {
 
 	log.Tracef("setPathVal(%v) on %v", path[1:], tVal)
 
-	if len(path) == 1 && pathIdx < 0 {
+	if len(path) == 1 && len(pathIdxs) < 1 {
 		t[pathKey] = val
 		return t, nil
 	}
 
-	if IsMap(tVal) {
+	if IsMap(tVal) && len(pathIdxs) < 1 {
 		t[pathKey], err = tVal.(STree).setPathVal(path[1:], val)
 		return t, err
 
 	} else if IsSlice(tVal) {
-		sVal := tVal.([]interface{})
-		if pathIdx < 0 || pathIdx >= len(sVal) {
-			return t, fmt.Errorf("setPathVal invalid slice index %d for path %s", pathIdx, path[0])
-		}
-		if IsMap(sVal[pathIdx]) {
-			_, err = sVal[pathIdx].(STree).setPathVal(path[1:], val)
-			return t, err
-		} else if len(path) == 1 {
-			sVal[pathIdx] = val
-			return t, nil
-		} else {
-			return t, fmt.Errorf("setPathVal unable to traverse below slice path component: %s", path[0])
+		if len(pathIdxs) < 1 {
+			return t, fmt.Errorf("setPathVal path is missing an index into slice at path component: %s", path[0])
 		}
+		return t, setSliceVal(tVal.([]interface{}), pathIdxs, path, val)
 
 	} else {
 		return t, fmt.Errorf("setPathVal unable to traverse below path component: %s", path[0])
@@ -109,34 +163,232 @@ func (t STree) setPathVal(path FieldPath, val interface{}) (STree, error) {
 
 }
 
+// setSliceVal descends into the nested slices of sVal following idxs and either
+// replaces the element at the final index with val, or sets val beneath it if
+// the path has components remaining.
+func setSliceVal(sVal []interface{}, idxs []int, path FieldPath, val interface{}) error {
+
+	pathIdx := idxs[0]
+	if pathIdx >= len(sVal) {
+		return fmt.Errorf("setPathVal invalid slice index %d for path %s", pathIdx, path[0])
+	}
+
+	if len(idxs) > 1 {
+		if sSub, ok := sVal[pathIdx].([]interface{}); ok {
+			return setSliceVal(sSub, idxs[1:], path, val)
+		}
+		return fmt.Errorf("setPathVal unable to index non-slice value for path component: %s", path[0])
+	}
+
+	if len(path) == 1 {
+		sVal[pathIdx] = val
+		return nil
+	} else if IsMap(sVal[pathIdx]) {
+		_, err := sVal[pathIdx].(STree).setPathVal(path[1:], val)
+		return err
+	} else {
+		return fmt.Errorf("setPathVal unable to traverse below slice path component: %s", path[0])
+	}
+}
+
 func (t STree) addPathVal(path FieldPath, val interface{}) (STree, error) {
 
 	if path == nil || len(path) < 1 {
 		return t, fmt.Errorf("addPathVal called with no path")
 	}
 
-	pathKey, pathIdx, err := t.parsePathComponent(path[0])
+	pathKey, pathIdxs, err := t.parsePathComponent(path[0])
 	if err != nil {
 		return t, fmt.Errorf("addPathVal parsePathComponent error: %v", err)
 	}
 
 	if len(path) == 1 {
-		if pathIdx < 0 {
-			t[pathKey] = val
-		} else {
-			t[pathKey] = make([]interface{}, pathIdx+1)
-			t[pathKey].([]interface{})[pathIdx] = val
-		}
+		t[pathKey] = newSliceVal(pathIdxs, val)
 		return t, nil
 	} else {
 		var tSub STree = map[interface{}]interface{}{}
-		if pathIdx < 0 {
-			t[pathKey] = tSub
-		} else {
-			t[pathKey] = make([]interface{}, pathIdx+1)
-			t[pathKey].([]interface{})[pathIdx] = tSub
-		}
+		t[pathKey] = newSliceVal(pathIdxs, tSub)
 		_, err = tSub.addPathVal(path[1:], val)
 		return t, err
 	}
 }
+
+// newSliceVal returns val nested within newly created slices such that it is
+// found at the position specified by idxs, or val itself if idxs is empty.
+func newSliceVal(idxs []int, val interface{}) interface{} {
+	if len(idxs) < 1 {
+		return val
+	}
+	sVal := make([]interface{}, idxs[0]+1)
+	sVal[idxs[0]] = newSliceVal(idxs[1:], val)
+	return sVal
+}
+
+// Delete returns a copy of the STree with the value at path removed. A path ending
+// in a subscript removes the element from its slice, shifting subsequent elements
+// down. A *PathError is returned if the path does not exist.
+func (t STree) Delete(path string) (STree, error) {
+	return t.DeleteAll(path)
+}
+
+func (t STree) DeleteMust(path string) STree {
+	u, err := t.Delete(path)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// DeleteAll returns a copy of the STree with the value at each of the specified
+// paths removed, in order. A *PathError is returned if any path does not exist.
+func (t STree) DeleteAll(paths ...string) (STree, error) {
+
+	clone, err := t.clone()
+	if err != nil {
+		return nil, fmt.Errorf("Delete clone error: %v", err)
+	}
+	return clone.deleteAllIn(paths)
+}
+
+// deleteAllIn removes the value at each of paths from t, itself a copy of the
+// STree modified, and returns the result.
+func (t STree) deleteAllIn(paths []string) (STree, error) {
+
+	for _, path := range paths {
+		p, err := t.fieldPathOf("Delete", path)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 1 {
+			return nil, &PathError{Op: "Delete", Path: path, Err: ErrInvalidPath}
+		}
+		if err = t.deletePathVal(path, p); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// deletePathVal removes the value at path from t in place. The full path string
+// is used for error reporting only.
+func (t STree) deletePathVal(full string, path FieldPath) error {
+
+	pathKey, pathIdxs, err := t.parsePathComponent(path[0])
+	if err != nil {
+		return &PathError{Op: "Delete", Path: full, Component: path[0], Err: ErrInvalidPath}
+	}
+
+	tVal, ok := t[pathKey]
+	if !ok {
+		return &PathError{Op: "Delete", Path: full, Component: path[0], Err: ErrNotFound}
+	}
+
+	if len(pathIdxs) > 0 {
+		t[pathKey], err = deleteSliceVal(full, tVal, pathIdxs, path)
+		return err
+	} else if len(path) == 1 {
+		delete(t, pathKey)
+		return nil
+	} else if tSub, ok := tVal.(STree); ok {
+		return tSub.deletePathVal(full, path[1:])
+	} else {
+		return &PathError{Op: "Delete", Path: full, Component: path[1], Expected: KindSTree, Actual: kindName(tVal), Err: ErrTypeMismatch}
+	}
+}
+
+// deleteSliceVal descends into the nested slices of val following idxs and either
+// removes the element at the final index, or deletes beneath it if the path has
+// components remaining. The resulting slice is returned.
+func deleteSliceVal(full string, val interface{}, idxs []int, path FieldPath) ([]interface{}, error) {
+
+	sVal, ok := val.([]interface{})
+	if !ok {
+		return nil, &PathError{Op: "Delete", Path: full, Component: path[0], Expected: KindSlice, Actual: kindName(val), Err: ErrTypeMismatch}
+	}
+
+	pathIdx := idxs[0]
+	if pathIdx >= len(sVal) {
+		return nil, &PathError{Op: "Delete", Path: full, Component: path[0],
+			Expected: fmt.Sprintf("index in [0,%d]", len(sVal)-1), Actual: fmt.Sprintf("index %d", pathIdx), Err: ErrIndexOutOfRange}
+	}
+
+	var err error
+	if len(idxs) > 1 {
+		sVal[pathIdx], err = deleteSliceVal(full, sVal[pathIdx], idxs[1:], path)
+		return sVal, err
+	} else if len(path) == 1 {
+		result := make([]interface{}, 0, len(sVal)-1)
+		result = append(result, sVal[:pathIdx]...)
+		return append(result, sVal[pathIdx+1:]...), nil
+	} else if tSub, ok := sVal[pathIdx].(STree); ok {
+		return sVal, tSub.deletePathVal(full, path[1:])
+	} else {
+		return nil, &PathError{Op: "Delete", Path: full, Component: path[1], Expected: KindSTree, Actual: kindName(sVal[pathIdx]), Err: ErrTypeMismatch}
+	}
+}
+
+// PrunePredicate reports whether the value found at path should be removed by Prune.
+type PrunePredicate func(path FieldPath, val interface{}) bool
+
+var PruneNils PrunePredicate = func(path FieldPath, val interface{}) bool { return val == nil }
+
+var PruneEmptySTrees PrunePredicate = func(path FieldPath, val interface{}) bool {
+	sVal, ok := val.(STree)
+	return ok && len(sVal) < 1
+}
+
+var PruneEmptySlices PrunePredicate = func(path FieldPath, val interface{}) bool {
+	sVal, ok := val.([]interface{})
+	return ok && len(sVal) < 1
+}
+
+// PruneEmpty matches nil values as well as empty STrees and slices.
+var PruneEmpty PrunePredicate = func(path FieldPath, val interface{}) bool {
+	return PruneNils(path, val) || PruneEmptySTrees(path, val) || PruneEmptySlices(path, val)
+}
+
+// Prune returns a copy of the STree with every value matching pred removed. The tree
+// is pruned bottom-up, so an STree or slice emptied by pruning its contents is itself
+// tested against pred. Slice elements are passed to pred with their original index.
+func (t STree) Prune(pred PrunePredicate) (STree, error) {
+
+	clone, err := t.clone()
+	if err != nil {
+		return nil, fmt.Errorf("Prune clone error: %v", err)
+	}
+
+	clone.prune(FieldPath{}, pred)
+	return clone, nil
+}
+
+func (t STree) prune(path FieldPath, pred PrunePredicate) {
+	for _, k := range t.Keys() {
+		kPath := path.append(keyComponent(k))
+		if val := pruneVal(kPath, t[k], pred); pred(kPath, val) {
+			delete(t, k)
+		} else {
+			t[k] = val
+		}
+	}
+}
+
+func pruneVal(path FieldPath, val interface{}, pred PrunePredicate) interface{} {
+
+	if tVal, ok := val.(STree); ok {
+		tVal.prune(path, pred)
+		return tVal
+
+	} else if sVal, ok := val.([]interface{}); ok {
+		result := []interface{}{}
+		for i, v := range sVal {
+			iPath := indexPath(path, i)
+			if v = pruneVal(iPath, v, pred); !pred(iPath, v) {
+				result = append(result, v)
+			}
+		}
+		return result
+	}
+
+	return val
+}
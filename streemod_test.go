@@ -1,6 +1,7 @@
 package gostree
 
 import (
+	"errors"
 	"testing"
 
 	log "github.com/cihub/seelog"
@@ -83,6 +84,35 @@ func TestSTreeMod(t *testing.T) {
 		So(s6.StrValMust(".key3.key6"), ShouldEqual, "val6new")
 	})
 
+	Convey("Test SetVal nested slice\n", t, func() {
+
+		s, err := NewSTreeJson(strings.NewReader(`{"key1": [[1, 2], [3, [4, {"key2": "val2"}]]]}`))
+		So(err, ShouldBeNil)
+
+		s1, err := s.SetVal(".key1[0][1]", 22)
+		So(err, ShouldBeNil)
+		So(s1.IntValMust(".key1[0][1]"), ShouldEqual, 22)
+		So(s.IntValMust(".key1[0][1]"), ShouldEqual, 2)
+
+		s2, err := s.SetVal(".key1[1][1][1].key2", "val2new")
+		So(err, ShouldBeNil)
+		So(s2.StrValMust(".key1[1][1][1].key2"), ShouldEqual, "val2new")
+
+		_, err = s.SetVal(".key1[0][2]", 8)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "invalid slice index 2")
+
+		_, err = s.SetVal(".key1[0][0][0]", 8)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "unable to index non-slice value")
+
+		s3, err := NewSTree().SetVal(".key1[1][2].key2", "val2")
+		So(err, ShouldBeNil)
+		So(s3.StrValMust(".key1[1][2].key2"), ShouldEqual, "val2")
+		So(len(s3.SliceValMust(".key1")), ShouldEqual, 2)
+		So(len(s3.SliceValMust(".key1[1]")), ShouldEqual, 3)
+	})
+
 	Convey("Test SetVal no path error\n", t, func() {
 		s, err := NewSTreeJson(strings.NewReader(`{}`))
 		So(err, ShouldBeNil)
@@ -107,6 +137,14 @@ func TestSTreeMod(t *testing.T) {
 		So(err.Error(), ShouldContainSubstring, "invalid slice index 2")
 	})
 
+	Convey("Test SetVal missing slice index\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(`{"key3": {"key6": ["sliceVal6"]}}`))
+		So(err, ShouldBeNil)
+		_, err = s.SetVal(".key3.key6.key99", 8)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "missing an index into slice at path component: key6")
+	})
+
 	Convey("Test SetVal slice traverse error\n", t, func() {
 		s, err := NewSTreeJson(strings.NewReader(`{"key3": {"key6": ["sliceVal6"]}}`))
 		So(err, ShouldBeNil)
@@ -156,4 +194,101 @@ func TestSTreeMod(t *testing.T) {
 		badKey := "badKey"
 		So(func() { s.SetValMust(badKey, 12.34) }, ShouldPanic)
 	})
+
+	Convey("Test Delete\n", t, func() {
+
+		json := `
+		{
+			"key1": "val1",
+			"key2": {"password": "secret", "user": "admin"},
+			"key3": [
+				{"key4": "val4", "password": "secret"},
+				"sliceVal3",
+				[1, 2, 3]
+			]
+		}`
+
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		d1, err := s.Delete(".key1")
+		So(err, ShouldBeNil)
+		_, err = d1.Val(".key1")
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		So(s.StrValMust(".key1"), ShouldEqual, "val1")
+
+		d2, err := s.Delete(".key3[1]")
+		So(err, ShouldBeNil)
+		So(len(d2.SliceValMust(".key3")), ShouldEqual, 2)
+		So(d2.IntValMust(".key3[1][2]"), ShouldEqual, 3)
+		So(len(s.SliceValMust(".key3")), ShouldEqual, 3)
+
+		d3, err := s.Delete(".key3[2][0]")
+		So(err, ShouldBeNil)
+		So(d3.SliceValMust(".key3[2]"), ShouldResemble, []interface{}{2.0, 3.0})
+
+		d4, err := s.DeleteAll(".key2.password", ".key3[0].password")
+		So(err, ShouldBeNil)
+		So(d4.STreeValMust(".key2"), ShouldResemble, STree{"user": "admin"})
+		So(d4.STreeValMust(".key3[0]"), ShouldResemble, STree{"key4": "val4"})
+
+		So(s.DeleteMust(".key2").Keys(), ShouldNotContain, "key2")
+	})
+
+	Convey("Test Delete errors\n", t, func() {
+
+		s, err := NewSTreeJson(strings.NewReader(`{"key1": "val1", "key2": [1, 2]}`))
+		So(err, ShouldBeNil)
+
+		_, err = s.Delete(".key9")
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		_, err = s.Delete(".key2[2]")
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+		_, err = s.Delete(".key1.key9")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.Delete(".key1[0]")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.Delete("key1")
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		_, err = s.DeleteAll(".key1", ".key1")
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		So(func() { s.DeleteMust(".key9") }, ShouldPanic)
+	})
+
+	Convey("Test Prune\n", t, func() {
+
+		yaml := `
+---
+key1: val1
+key2:
+key3:
+  key4: {}
+  key5: []
+key6:
+- key7:
+- [[]]
+- val8
+`
+
+		s, err := NewSTreeYaml(strings.NewReader(yaml))
+		So(err, ShouldBeNil)
+
+		p1, err := s.Prune(PruneNils)
+		So(err, ShouldBeNil)
+		So(p1.Keys(), ShouldNotContain, "key2")
+		So(p1.STreeValMust(".key6[0]"), ShouldResemble, STree{})
+
+		p2, err := s.Prune(PruneEmpty)
+		So(err, ShouldBeNil)
+		So(p2, ShouldResemble, STree{"key1": "val1", "key6": []interface{}{"val8"}})
+
+		p3, err := s.Prune(func(path FieldPath, val interface{}) bool {
+			return path.String() == ".key3.key4" || path.String() == ".key6[1]"
+		})
+		So(err, ShouldBeNil)
+		So(p3.STreeValMust(".key3"), ShouldResemble, STree{"key5": []interface{}{}})
+		So(len(p3.SliceValMust(".key6")), ShouldEqual, 2)
+
+		So(len(s.SliceValMust(".key6")), ShouldEqual, 3)
+	})
 }
@@ -0,0 +1,352 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+// msgpackTimestamp is the MessagePack extension type of timestamps.
+const msgpackTimestamp = -1
+
+// NewSTreeMsgpack reads MessagePack from the specified reader and returns the
+// structure as an STree. Integers are stored as int, or as uint64 above the int
+// range, floats as float64, binary data as []byte and timestamps as RFC 3339
+// strings; other extension types are an error. Map keys may be any scalar, with
+// binary keys stored as strings. The root must be a map.
+func NewSTreeMsgpack(r io.Reader) (STree, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return nil, fmt.Errorf("NewSTreeMsgpack error reading bytes: %v", err)
+	}
+
+	d := msgpackDecoder{binaryReader{data: buf.Bytes()}}
+	v, err := d.decode(0)
+	if err == nil && d.pos < len(d.data) {
+		err = fmt.Errorf("invalid data after top-level value")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("NewSTreeMsgpack error at offset %d: %w", d.pos, err)
+	}
+
+	stree, ok := v.(STree)
+	if !ok {
+		return nil, fmt.Errorf("NewSTreeMsgpack found root of kind %s, expected a map", kindName(v))
+	}
+	return stree, nil
+}
+
+type msgpackDecoder struct {
+	binaryReader
+}
+
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+
+	if depth > maxBinaryDepth {
+		return nil, fmt.Errorf("nesting exceeds %d levels", maxBinaryDepth)
+	}
+
+	b, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int(b), nil
+	case b <= 0x8f:
+		return d.decodeMap(uint64(b&0x0f), depth)
+	case b <= 0x9f:
+		return d.decodeArray(uint64(b&0x0f), depth)
+	case b <= 0xbf:
+		return d.decodeStr(uint64(b & 0x1f))
+	case b >= 0xe0:
+		return int(int8(b)), nil
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		bin, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, bin...), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (b - 0xcc))
+		return uintVal(u), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (b - 0xd0)
+		u, err := d.uint(n)
+		// shift the value up and back to extend its sign
+		shift := uint(64 - 8*n)
+		return intVal(int64(u<<shift) >> shift), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeStr(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n, depth)
+	}
+
+	return nil, fmt.Errorf("invalid format byte 0x%02x", b)
+}
+
+func (d *msgpackDecoder) decodeStr(n uint64) (interface{}, error) {
+	s, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(s), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n uint64, depth int) (interface{}, error) {
+	size, err := d.length(n)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, size)
+	for i := range result {
+		if result[i], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n uint64, depth int) (interface{}, error) {
+	size, err := d.length(n)
+	if err != nil {
+		return nil, err
+	}
+	result := make(STree, size)
+	for i := 0; i < size; i++ {
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if k, err = binaryKey(k); err != nil {
+			return nil, err
+		}
+		if result[k], err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// decodeExt decodes an extension of n data bytes, of which only timestamps
+// are understood.
+func (d *msgpackDecoder) decodeExt(n uint64) (interface{}, error) {
+
+	t, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(t) != msgpackTimestamp {
+		return nil, fmt.Errorf("unsupported extension type %d", int8(t))
+	}
+
+	var sec, nsec int64
+	switch n {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(data))
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		nsec, sec = int64(u>>34), int64(u&(1<<34-1))
+	case 12:
+		nsec = int64(binary.BigEndian.Uint32(data))
+		sec = int64(binary.BigEndian.Uint64(data[4:]))
+	default:
+		return nil, fmt.Errorf("invalid timestamp length %d", n)
+	}
+	return time.Unix(sec, nsec).UTC().Format(time.RFC3339Nano), nil
+}
+
+// WriteMsgpack marshals the STree as MessagePack, writing each number in its
+// smallest encoding and map keys in sorted order. *big.Float values are written
+// as float64, and an error is returned for *big.Int values beyond 64 bits.
+func (s STree) WriteMsgpack() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeMsgpack(buf, FieldPath{}, s); err != nil {
+		return nil, fmt.Errorf("WriteMsgpack %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackHead lists the formats of a MessagePack string, binary, array or map
+// header, with zero denoting a format the type lacks.
+type msgpackHead struct {
+	fix          byte
+	fixMax       uint64
+	f8, f16, f32 byte
+}
+
+var (
+	msgpackStrHead   = msgpackHead{0xa0, 31, 0xd9, 0xda, 0xdb}
+	msgpackBinHead   = msgpackHead{0, 0, 0xc4, 0xc5, 0xc6}
+	msgpackArrayHead = msgpackHead{0x90, 15, 0, 0xdc, 0xdd}
+	msgpackMapHead   = msgpackHead{0x80, 15, 0, 0xde, 0xdf}
+)
+
+// write writes the smallest header declaring n elements.
+func (h msgpackHead) write(buf *bytes.Buffer, n int) {
+	switch {
+	case h.fix != 0 && uint64(n) <= h.fixMax:
+		buf.WriteByte(h.fix | byte(n))
+	case h.f8 != 0 && n <= math.MaxUint8:
+		buf.Write([]byte{h.f8, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(h.f16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(h.f32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeMsgpack(buf *bytes.Buffer, path FieldPath, v interface{}) error {
+
+	switch tv := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+		return nil
+	case bool:
+		if tv {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+		return nil
+	case string:
+		msgpackStrHead.write(buf, len(tv))
+		buf.WriteString(tv)
+		return nil
+	case []byte:
+		msgpackBinHead.write(buf, len(tv))
+		buf.Write(tv)
+		return nil
+	case time.Time:
+		return writeMsgpack(buf, path, tv.Format(time.RFC3339Nano))
+	case []interface{}:
+		msgpackArrayHead.write(buf, len(tv))
+		for i, e := range tv {
+			if err := writeMsgpack(buf, indexPath(path, i), e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[interface{}]interface{}:
+		return writeMsgpack(buf, path, STree(tv))
+	case STree:
+		msgpackMapHead.write(buf, len(tv))
+		for _, k := range tv.sortedKeys() {
+			kPath := path.append(keyComponent(k))
+			if err := writeMsgpack(buf, kPath, k); err != nil {
+				return err
+			}
+			if err := writeMsgpack(buf, kPath, tv[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	n, ok := binaryNumber(v)
+	if !ok {
+		return fmt.Errorf("found unsupported value of type %T at %s", v, path)
+	}
+	switch tn := n.(type) {
+	case int64:
+		if tn >= 0 {
+			writeMsgpackUint(buf, uint64(tn))
+		} else if tn >= -32 {
+			buf.WriteByte(byte(tn))
+		} else if tn >= math.MinInt8 {
+			buf.Write([]byte{0xd0, byte(tn)})
+		} else if tn >= math.MinInt16 {
+			buf.WriteByte(0xd1)
+			binary.Write(buf, binary.BigEndian, int16(tn))
+		} else if tn >= math.MinInt32 {
+			buf.WriteByte(0xd2)
+			binary.Write(buf, binary.BigEndian, int32(tn))
+		} else {
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, tn)
+		}
+	case uint64:
+		writeMsgpackUint(buf, tn)
+	case float32:
+		buf.WriteByte(0xca)
+		binary.Write(buf, binary.BigEndian, tn)
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, tn)
+	case *big.Int:
+		return fmt.Errorf("found integer %s beyond 64 bits at %s", tn, path)
+	}
+	return nil
+}
+
+func writeMsgpackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.Write([]byte{0xcc, byte(u)})
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(u))
+	default:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+	}
+}
@@ -0,0 +1,141 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+// binaryJson exercises the header sizes of both binary formats, with a string
+// beyond 255 bytes and an array beyond 23 elements.
+var binaryJson = `{
+	"name": "gostree",
+	"version": 1.5,
+	"stars": 1024,
+	"fork": false,
+	"parent": null,
+	"owner": {"login": "oldenbur", "id": -70000, "ratio": -0.25},
+	"tags": ["go", "yaml", "json", "ünïcode"],
+	"matrix": [[1, 2], [3, 4]],
+	"range": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24],
+	"readme": "` + strings.Repeat("long text ", 40) + `",
+	"big": 12345678901234567890,
+	"huge": 123456789012345678901234567890
+}`
+
+func TestMsgpack(t *testing.T) {
+
+	defer log.Flush()
+
+	Convey("Test WriteMsgpack and NewSTreeMsgpack against json\n", t, func() {
+		for _, opts := range [][]JsonOption{nil, {WithJsonNumbers(JsonNumberExact)}} {
+			s, err := NewSTreeJson(strings.NewReader(binaryJson), opts...)
+			So(err, ShouldBeNil)
+			if len(opts) > 0 {
+				delete(s, "huge")
+			}
+
+			out, err := s.WriteMsgpack()
+			So(err, ShouldBeNil)
+			m, err := NewSTreeMsgpack(bytes.NewReader(out))
+			So(err, ShouldBeNil)
+
+			comp, err := s.CompareTo(m)
+			So(err, ShouldBeNil)
+			So(comp, ShouldHaveLength, len(s.FieldPaths()))
+			for _, c := range comp {
+				So(c, ShouldEqual, COMP_NO_DIFFERENCE)
+			}
+			comp, err = m.CompareTo(s)
+			So(err, ShouldBeNil)
+			for _, c := range comp {
+				So(c, ShouldEqual, COMP_NO_DIFFERENCE)
+			}
+		}
+	})
+
+	Convey("Test msgpack value mapping\n", t, func() {
+		s := STree{
+			"bin":  []byte{0, 1, 2},
+			"ints": []interface{}{0, 127, 128, -32, -33, -129, 65536, math.MinInt64, uint64(math.MaxUint64)},
+			"f32":  float32(0.5),
+			"keys": STree{1: "one", true: "yes", 2.5: "two and a half", nil: "none"},
+		}
+		out, err := s.WriteMsgpack()
+		So(err, ShouldBeNil)
+		m, err := NewSTreeMsgpack(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(m, ShouldResemble, STree{
+			"bin":  []byte{0, 1, 2},
+			"ints": []interface{}{0, 127, 128, -32, -33, -129, 65536, math.MinInt64, uint64(math.MaxUint64)},
+			"f32":  0.5,
+			"keys": STree{1: "one", true: "yes", 2.5: "two and a half", nil: "none"},
+		})
+		So(m.ValMust(".keys.{1}"), ShouldEqual, "one")
+
+		delete(m, "keys")
+		j, err := m.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(j), ShouldContainSubstring, `"bin":"AAEC"`)
+
+		c, err := NewSTreeCopy(m)
+		So(err, ShouldBeNil)
+		c["bin"].([]byte)[0] = 9
+		So(m["bin"], ShouldResemble, []byte{0, 1, 2})
+
+		_, err = STree{"n": new(big.Int).Lsh(big.NewInt(1), 64)}.WriteMsgpack()
+		So(err, ShouldNotBeNil)
+		_, err = STree{"n": STree{"c": make(chan int)}}.WriteMsgpack()
+		So(err.Error(), ShouldEqual, "WriteMsgpack found unsupported value of type chan int at .n.c")
+	})
+
+	Convey("Test NewSTreeMsgpack input\n", t, func() {
+		cases := []struct {
+			src  string
+			want STree
+		}{
+			// str8 key and bin8 binary key
+			{"81d9016b01", STree{"k": 1}},
+			{"81c4016b01", STree{"k": 1}},
+			// map16 holding an array16 of int8, int16, int32 and uint16
+			{"de0001a161dc0004d0ffd1fffed2fffffffdcd0100", STree{"a": []interface{}{-1, -2, -3, 256}}},
+			// timestamp 32, 64 and 96 as fixext4, fixext8 and ext8
+			{"81a174d6ff00000000", STree{"t": "1970-01-01T00:00:00Z"}},
+			{"81a174d7ff0000000400000001", STree{"t": "1970-01-01T00:00:01.000000001Z"}},
+			{"81a174c70cff000000000000000000000001", STree{"t": "1970-01-01T00:00:01Z"}},
+		}
+		for _, c := range cases {
+			data, _ := hex.DecodeString(c.src)
+			s, err := NewSTreeMsgpack(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+			So(s, ShouldResemble, c.want)
+		}
+
+		errs := []struct {
+			src, msg string
+		}{
+			{"81a16b", "NewSTreeMsgpack error at offset 3: unexpected end of data"},
+			{"81a16b01c0", "NewSTreeMsgpack error at offset 4: invalid data after top-level value"},
+			{"81a16bc1", "NewSTreeMsgpack error at offset 4: invalid format byte 0xc1"},
+			{"81a16bd40100", "NewSTreeMsgpack error at offset 6: unsupported extension type 1"},
+			{"81910101", "NewSTreeMsgpack error at offset 3: map key of type slice is not a scalar"},
+			{"81cb7ff8000000000000c3", "NewSTreeMsgpack error at offset 10: map key NaN is not supported"},
+			{"dfffffffff", "NewSTreeMsgpack error at offset 5: unexpected end of data"},
+			{"9101", "NewSTreeMsgpack found root of kind slice, expected a map"},
+		}
+		for _, e := range errs {
+			data, _ := hex.DecodeString(e.src)
+			_, err := NewSTreeMsgpack(bytes.NewReader(data))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, e.msg)
+		}
+	})
+}
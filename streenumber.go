@@ -0,0 +1,358 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JsonNumberMode selects how numbers are stored when json is read into an STree.
+type JsonNumberMode int
+
+const (
+	JsonNumberFloat64 JsonNumberMode = iota // every number is stored as a float64, as by encoding/json
+	JsonNumberRaw                           // every number is stored as a json.Number holding its literal text
+	JsonNumberExact                         // integers as int64 or *big.Int, others as float64 or *big.Float
+)
+
+// JsonOption configures the reading of json into STrees.
+type JsonOption func(*jsonCodec)
+
+// WithJsonNumbers sets how numbers are stored, JsonNumberFloat64 by default.
+// Integers beyond 2^53 lose precision as float64 values, so ids and the like
+// should be read using JsonNumberRaw, which round trips each number byte for byte
+// through WriteJson, or JsonNumberExact, which stores integers as int64 where they
+// fit and *big.Int otherwise, and other numbers as float64 where that preserves
+// their decimal value and *big.Float otherwise.
+func WithJsonNumbers(mode JsonNumberMode) JsonOption {
+	return func(c *jsonCodec) { c.numbers = mode }
+}
+
+type jsonCodec struct {
+	numbers JsonNumberMode
+	json5   bool
+}
+
+func newJsonCodec(opts []JsonOption) *jsonCodec {
+	c := &jsonCodec{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// unmarshal parses data as a single json object, storing numbers according to
+// the numbers mode of c.
+func (c *jsonCodec) unmarshal(data []byte) (STree, error) {
+
+	um := make(map[string]interface{})
+	if err := c.decode(data, &um); err != nil {
+		return nil, err
+	}
+	s, err := convertKeys(um)
+	if err != nil || c.numbers != JsonNumberExact {
+		return s, err
+	}
+	v, err := exactNumbers(s)
+	if err != nil {
+		return nil, err
+	}
+	return v.(STree), nil
+}
+
+// unmarshalValue parses data as a single json value of any type, storing numbers
+// according to the numbers mode of c.
+func (c *jsonCodec) unmarshalValue(data []byte) (interface{}, error) {
+
+	var uv interface{}
+	if err := c.decode(data, &uv); err != nil {
+		return nil, err
+	}
+	v, err := convertVal(uv)
+	if err != nil || c.numbers != JsonNumberExact {
+		return v, err
+	}
+	return exactNumbers(v)
+}
+
+func (c *jsonCodec) decode(data []byte, out interface{}) error {
+
+	if c.json5 {
+		var err error
+		if data, err = json5ToJson(data); err != nil {
+			return fmt.Errorf("error in json5ToJson: %w", err)
+		}
+	}
+
+	if c.numbers == JsonNumberFloat64 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("error in json.Unmarshal: %v", err)
+		}
+		return nil
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(out); err != nil {
+		return fmt.Errorf("error in json.Decode: %v", err)
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return fmt.Errorf("error in json.Decode: invalid data after top-level value")
+	}
+	return nil
+}
+
+// exactNumbers returns v with every json.Number replaced by its exactNumber.
+func exactNumbers(v interface{}) (interface{}, error) {
+
+	switch tv := v.(type) {
+
+	case STree:
+		for k, kv := range tv {
+			conv, err := exactNumbers(kv)
+			if err != nil {
+				return nil, err
+			}
+			tv[k] = conv
+		}
+		return tv, nil
+
+	case []interface{}:
+		for i, iv := range tv {
+			conv, err := exactNumbers(iv)
+			if err != nil {
+				return nil, err
+			}
+			tv[i] = conv
+		}
+		return tv, nil
+
+	case json.Number:
+		return exactNumber(tv)
+
+	default:
+		return v, nil
+	}
+}
+
+// exactNumber returns n as an int64 or *big.Int if it is written as an integer,
+// and otherwise as a float64 if that holds the same decimal value as n when
+// formatted, or else a *big.Float.
+func exactNumber(n json.Number) (interface{}, error) {
+
+	s := n.String()
+	if isJsonInteger(s) {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		b, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("exactNumber failed to parse integer %s", s)
+		}
+		return b, nil
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		r, okR := new(big.Rat).SetString(s)
+		rf, okF := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+		if okR && okF && r.Cmp(rf) == 0 {
+			return f, nil
+		}
+	}
+
+	prec := uint(len(s)) * 4
+	if prec < 64 {
+		prec = 64
+	}
+	b, ok := new(big.Float).SetPrec(prec).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("exactNumber failed to parse number %s", s)
+	}
+	return b, nil
+}
+
+// isJsonInteger returns true if the json number literal s has neither a fraction
+// nor an exponent.
+func isJsonInteger(s string) bool {
+	return !strings.ContainsAny(s, ".eE")
+}
+
+// isBigNumber returns true if v is a *big.Int or *big.Float.
+func isBigNumber(v interface{}) bool {
+	switch v.(type) {
+	case *big.Int, *big.Float:
+		return true
+	}
+	return false
+}
+
+// isExactNumber returns true if v is a json.Number, *big.Int or *big.Float, as
+// read by WithJsonNumbers, which CompareTo compares to other numbers by value.
+func isExactNumber(v interface{}) bool {
+	_, ok := v.(json.Number)
+	return ok || isBigNumber(v)
+}
+
+// isInteger returns true if v is of any signed or unsigned integer type.
+func isInteger(v interface{}) bool {
+	return IsInt(v) || IsUint(v)
+}
+
+// bigNumberJson returns the json.Number marshaled in place of the *big.Int or
+// *big.Float v.
+func bigNumberJson(v interface{}) json.Number {
+	switch tv := v.(type) {
+	case *big.Int:
+		return json.Number(tv.String())
+	case *big.Float:
+		return json.Number(tv.Text('g', -1))
+	}
+	return ""
+}
+
+// numberRat returns the exact value of v as a big.Rat if v is an integer, a
+// json.Number or a big number. float64 values are excluded, since their exact
+// values rarely match the decimals they were written as.
+func numberRat(v interface{}) (*big.Rat, bool) {
+	switch tv := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(tv.String())
+	case *big.Int:
+		return new(big.Rat).SetInt(tv), true
+	case *big.Float:
+		if tv.IsInf() {
+			return nil, false
+		}
+		r, _ := tv.Rat(nil)
+		return r, true
+	}
+	val := reflect.ValueOf(v)
+	switch {
+	case isIntKind(val.Kind()):
+		return new(big.Rat).SetInt64(val.Int()), true
+	case isUintKind(val.Kind()):
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(val.Uint())), true
+	}
+	return nil, false
+}
+
+// compareNumbers returns -1, 0 or 1 as a is less than, equal to or greater than
+// b, provided both are numbers. Numbers are compared exactly, unless either is a
+// binary float, in which case both are rounded to the precision of a *big.Float
+// operand, or else compared as float64 values.
+func compareNumbers(a, b interface{}) (int, bool) {
+
+	aBig, aIsBig := a.(*big.Float)
+	bBig, bIsBig := b.(*big.Float)
+	if aIsBig || bIsBig {
+		var prec uint
+		if aIsBig {
+			prec = aBig.Prec()
+		}
+		if bIsBig && bBig.Prec() > prec {
+			prec = bBig.Prec()
+		}
+		aF, ok := bigFloatVal(a, prec)
+		if !ok {
+			return 0, false
+		}
+		bF, ok := bigFloatVal(b, prec)
+		if !ok {
+			return 0, false
+		}
+		return aF.Cmp(bF), true
+	}
+
+	aRat, aExact := numberRat(a)
+	bRat, bExact := numberRat(b)
+	if aExact && bExact {
+		return aRat.Cmp(bRat), true
+	}
+
+	aNum, ok := numericVal(a)
+	if !ok {
+		return 0, false
+	}
+	bNum, ok := numericVal(b)
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case aNum < bNum:
+		return -1, true
+	case aNum > bNum:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+// bigFloatVal returns the value of the number v as a big.Float of at least the
+// specified precision.
+func bigFloatVal(v interface{}, prec uint) (*big.Float, bool) {
+	if f, ok := v.(*big.Float); ok {
+		return f, true
+	}
+	if n, ok := v.(json.Number); ok {
+		return new(big.Float).SetPrec(prec).SetString(n.String())
+	}
+	if r, ok := numberRat(v); ok {
+		return new(big.Float).SetPrec(prec).SetRat(r), true
+	}
+	if f, ok := numericVal(v); ok && !math.IsNaN(f) {
+		return new(big.Float).SetFloat64(f), true
+	}
+	return nil, false
+}
+
+// numericVal returns the value of v as a float64 if v is a number, rounding
+// json.Number and big number values to the nearest float64.
+func numericVal(v interface{}) (float64, bool) {
+	switch tv := v.(type) {
+	case json.Number:
+		f, err := strconv.ParseFloat(tv.String(), 64)
+		return f, err == nil || math.IsInf(f, 0)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(tv).Float64()
+		return f, true
+	case *big.Float:
+		f, _ := tv.Float64()
+		return f, true
+	}
+	val := reflect.ValueOf(v)
+	switch {
+	case isIntKind(val.Kind()):
+		return float64(val.Int()), true
+	case isUintKind(val.Kind()):
+		return float64(val.Uint()), true
+	case val.Kind() == reflect.Float32 || val.Kind() == reflect.Float64:
+		return val.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// integerVal returns the value of in as an int64, provided it is an integer or a
+// float with an integral value, and lies within the range of an int64.
+func integerVal(in interface{}) (int64, bool) {
+	if r, ok := numberRat(in); ok {
+		if !r.IsInt() || !r.Num().IsInt64() {
+			return 0, false
+		}
+		return r.Num().Int64(), true
+	}
+	v := reflect.ValueOf(in)
+	switch {
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		f := v.Float()
+		return int64(f), f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+	default:
+		return 0, false
+	}
+}
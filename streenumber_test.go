@@ -0,0 +1,145 @@
+package gostree
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeJsonNumbers(t *testing.T) {
+
+	defer log.Flush()
+
+	data := `{"id":9007199254740993,"big":123456789012345678901234567890,"small":-42,"ratio":0.1,"pi":3.14159265358979323846264338327950288,"exp":1.50e3,"list":[1,2.5]}`
+
+	Convey("Test WithJsonNumbers(JsonNumberRaw)\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(data), WithJsonNumbers(JsonNumberRaw))
+		So(err, ShouldBeNil)
+		So(s.ValMust(".id"), ShouldEqual, json.Number("9007199254740993"))
+		So(s.IntValMust(".id"), ShouldEqual, 9007199254740993)
+		So(s.IntValMust(".exp"), ShouldEqual, 1500)
+		So(s.FloatValMust(".ratio"), ShouldEqual, 0.1)
+
+		out, err := s.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `{"big":123456789012345678901234567890,"exp":1.50e3,"id":9007199254740993,"list":[1,2.5],"pi":3.14159265358979323846264338327950288,"ratio":0.1,"small":-42}`)
+
+		_, err = s.IntVal(".big")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		_, err = s.IntVal(".ratio")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "got float")
+		_, err = s.StrVal(".id")
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+
+		c, err := s.SetVal(".extra", 1)
+		So(err, ShouldBeNil)
+		So(c.ValMust(".id"), ShouldEqual, json.Number("9007199254740993"))
+
+		_, err = NewSTreeJson(strings.NewReader(`{"a":1} {"b":2}`), WithJsonNumbers(JsonNumberRaw))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test WithJsonNumbers(JsonNumberExact)\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(data), WithJsonNumbers(JsonNumberExact))
+		So(err, ShouldBeNil)
+		So(s.ValMust(".id"), ShouldEqual, int64(9007199254740993))
+		So(s.ValMust(".small"), ShouldEqual, int64(-42))
+		So(s.ValMust(".ratio"), ShouldEqual, 0.1)
+		So(s.ValMust(".exp"), ShouldEqual, 1500.0)
+		So(s.ValMust(".list"), ShouldResemble, []interface{}{int64(1), 2.5})
+
+		b, ok := s.ValMust(".big").(*big.Int)
+		So(ok, ShouldBeTrue)
+		So(b.String(), ShouldEqual, "123456789012345678901234567890")
+		_, ok = s.ValMust(".pi").(*big.Float)
+		So(ok, ShouldBeTrue)
+		So(s.FloatValMust(".pi"), ShouldEqual, 3.141592653589793)
+
+		out, err := s.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `{"big":123456789012345678901234567890,"exp":1500,"id":9007199254740993,"list":[1,2.5],"pi":3.14159265358979323846264338327950288,"ratio":0.1,"small":-42}`)
+
+		c, err := s.SetVal(".extra", 1)
+		So(err, ShouldBeNil)
+		So(DiffMust(s, c), ShouldHaveLength, 1)
+
+		paths := []string{}
+		err = s.Visit(NewVisitorBuilder().
+			WithPrimitiveVisitor(func(key string, val interface{}) error {
+				paths = append(paths, key)
+				return nil
+			}).
+			Visitor())
+		So(err, ShouldBeNil)
+		So(paths, ShouldContain, ".big")
+	})
+
+	Convey("Test comparison of json numbers\n", t, func() {
+		raw, err := NewSTreeJson(strings.NewReader(data), WithJsonNumbers(JsonNumberRaw))
+		So(err, ShouldBeNil)
+		exact, err := NewSTreeJson(strings.NewReader(data), WithJsonNumbers(JsonNumberExact))
+		So(err, ShouldBeNil)
+		float, err := NewSTreeJson(strings.NewReader(data))
+		So(err, ShouldBeNil)
+
+		comp, err := raw.CompareTo(exact)
+		So(err, ShouldBeNil)
+		for _, c := range comp {
+			So(c, ShouldEqual, COMP_NO_DIFFERENCE)
+		}
+
+		comp, err = exact.CompareTo(float)
+		So(err, ShouldBeNil)
+		So(comp[".ratio"], ShouldEqual, COMP_NO_DIFFERENCE)
+		So(comp[".small"], ShouldEqual, COMP_TYPES_DIFFER)
+		So(comp[".list[0]"], ShouldEqual, COMP_TYPES_DIFFER)
+
+		yml, err := NewSTreeYaml(strings.NewReader("small: -42\n"))
+		So(err, ShouldBeNil)
+		comp, err = yml.CompareTo(exact)
+		So(err, ShouldBeNil)
+		So(comp[".small"], ShouldEqual, COMP_NO_DIFFERENCE)
+
+		comp, err = raw.CompareTo(float)
+		So(err, ShouldBeNil)
+		So(comp[".small"], ShouldEqual, COMP_NO_DIFFERENCE)
+		So(comp[".list[0]"], ShouldEqual, COMP_NO_DIFFERENCE)
+
+		comp, err = STree{"a": 1, "b": int64(2), "c": uint8(3), "d": 4}.CompareTo(STree{"a": 1.0, "b": 2, "c": 3, "d": int64(5)})
+		So(err, ShouldBeNil)
+		So(comp[".a"], ShouldEqual, COMP_TYPES_DIFFER)
+		So(comp[".b"], ShouldEqual, COMP_NO_DIFFERENCE)
+		So(comp[".c"], ShouldEqual, COMP_NO_DIFFERENCE)
+		So(comp[".d"], ShouldEqual, COMP_VALUES_DIFFER)
+
+		next, err := NewSTreeJson(strings.NewReader(`{"id":9007199254740992}`), WithJsonNumbers(JsonNumberExact))
+		So(err, ShouldBeNil)
+		comp, err = exact.CompareTo(next)
+		So(err, ShouldBeNil)
+		So(comp[".id"], ShouldEqual, COMP_VALUES_DIFFER)
+
+		comp, err = STree{"a": json.Number("1")}.CompareTo(STree{"a": "1"})
+		So(err, ShouldBeNil)
+		So(comp[".a"], ShouldEqual, COMP_TYPES_DIFFER)
+
+		ids, err := exact.Query(".list[?(@ > 2)]")
+		So(err, ShouldBeNil)
+		So(ids, ShouldHaveLength, 1)
+		So(ids[0].Val, ShouldEqual, 2.5)
+	})
+
+	Convey("Test JsonLinesDecoder with WithJsonNumbers\n", t, func() {
+		d := NewJsonLinesDecoder(strings.NewReader("{\"id\":9007199254740993}\n"), WithJsonNumbers(JsonNumberRaw))
+		s, err := d.Next()
+		So(err, ShouldBeNil)
+		So(s.IntValMust(".id"), ShouldEqual, 9007199254740993)
+	})
+}
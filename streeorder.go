@@ -0,0 +1,499 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// OrderedSTree pairs an STree with the order of the keys of each STree within it,
+// as read from a document or as inserted, so that reformatting a document or a
+// read-modify-write cycle preserves the order chosen by its author. All STree
+// methods apply to the embedded STree; those redefined here also maintain the
+// order, and the writers, Visit and FieldPaths follow it.
+//
+// The order is recorded per path, and keys lacking a recorded position, e.g. those
+// of an STree added by a method not redefined here, follow the recorded keys in
+// sorted order. The result of any such method may be paired with the order using
+// WithSTree.
+type OrderedSTree struct {
+	STree
+	order keyOrder
+}
+
+// keyOrder holds the keys of each STree in order, indexed by the String of the
+// FieldPath of the STree, the empty string denoting the root.
+type keyOrder map[string][]interface{}
+
+// NewOrderedSTree returns an OrderedSTree holding s, with the keys of each of its
+// STrees in sorted order.
+func NewOrderedSTree(s STree) OrderedSTree {
+	return OrderedSTree{STree: s}.WithSTree(s)
+}
+
+// NewOrderedSTreeYaml reads yaml from the specified reader, as NewSTreeYaml does,
+// recording the order of the keys of each mapping.
+func NewOrderedSTreeYaml(r io.Reader) (OrderedSTree, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeYaml error reading bytes: %v", err)
+	}
+
+	var ms yaml.MapSlice
+	err = yaml.Unmarshal(buf.Bytes(), &ms)
+	if err != nil {
+		return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeYaml error in yaml.Unmarshal: %v", err)
+	}
+
+	order := keyOrder{}
+	s, err := orderedYamlVal(FieldPath{}, ms, order)
+	if err != nil {
+		return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeYaml %v", err)
+	}
+	return OrderedSTree{s.(STree), order}, nil
+}
+
+// orderedYamlVal returns v, found at path, with every yaml.MapSlice converted to an
+// STree whose key order is recorded in order.
+func orderedYamlVal(path FieldPath, v interface{}, order keyOrder) (interface{}, error) {
+
+	switch tv := v.(type) {
+
+	case yaml.MapSlice:
+		t := STree{}
+		keys := []interface{}{}
+		for _, item := range tv {
+			if _, dup := t[item.Key]; !dup {
+				keys = append(keys, item.Key)
+			}
+			val, err := orderedYamlVal(path.append(keyComponent(item.Key)), item.Value, order)
+			if err != nil {
+				return nil, err
+			}
+			t[item.Key] = val
+		}
+		order[path.String()] = keys
+		return t, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(tv))
+		for i, e := range tv {
+			val, err := orderedYamlVal(indexPath(path, i), e, order)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = val
+		}
+		return result, nil
+
+	default:
+		return convertVal(v)
+	}
+}
+
+// NewOrderedSTreeJson reads json from the specified reader, as NewSTreeJson does,
+// recording the order of the keys of each object.
+func NewOrderedSTreeJson(r io.Reader, opts ...JsonOption) (OrderedSTree, error) {
+
+	c := newJsonCodec(opts)
+	if c.json5 {
+		buf := bytes.NewBuffer([]byte{})
+		if _, err := buf.ReadFrom(r); err != nil {
+			return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeJson error reading bytes: %v", err)
+		}
+		data, err := json5ToJson(buf.Bytes())
+		if err != nil {
+			return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeJson error in json5ToJson: %w", err)
+		}
+		r = bytes.NewReader(data)
+	}
+
+	d := json.NewDecoder(r)
+	if c.numbers != JsonNumberFloat64 {
+		d.UseNumber()
+	}
+
+	tok, err := d.Token()
+	if err != nil {
+		return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeJson error in json.Token: %v", err)
+	}
+	if tok != json.Delim('{') {
+		return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeJson requires an object, found %v", tok)
+	}
+
+	order := keyOrder{}
+	s, err := c.orderedJsonObject(d, FieldPath{}, order)
+	if err != nil {
+		return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeJson %v", err)
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return OrderedSTree{}, fmt.Errorf("NewOrderedSTreeJson found invalid data after top-level value")
+	}
+	return OrderedSTree{s, order}, nil
+}
+
+// orderedJsonObject reads the remainder of an object found at path whose opening
+// brace has been consumed, recording the order of its keys in order.
+func (c *jsonCodec) orderedJsonObject(d *json.Decoder, path FieldPath, order keyOrder) (STree, error) {
+
+	t := STree{}
+	keys := []interface{}{}
+	for d.More() {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error in json.Token: %v", err)
+		}
+		key := tok.(string)
+		if _, dup := t[key]; !dup {
+			keys = append(keys, key)
+		}
+		val, err := c.orderedJsonVal(d, path.append(keyComponent(key)), order)
+		if err != nil {
+			return nil, err
+		}
+		t[key] = val
+	}
+	if _, err := d.Token(); err != nil {
+		return nil, fmt.Errorf("error in json.Token: %v", err)
+	}
+
+	order[path.String()] = keys
+	return t, nil
+}
+
+// orderedJsonVal reads the next value, found at path, storing numbers according to
+// the numbers mode of c.
+func (c *jsonCodec) orderedJsonVal(d *json.Decoder, path FieldPath, order keyOrder) (interface{}, error) {
+
+	tok, err := d.Token()
+	if err != nil {
+		return nil, fmt.Errorf("error in json.Token: %v", err)
+	}
+
+	switch tv := tok.(type) {
+
+	case json.Delim:
+		if tv == '{' {
+			return c.orderedJsonObject(d, path, order)
+		}
+		result := []interface{}{}
+		for d.More() {
+			val, err := c.orderedJsonVal(d, indexPath(path, len(result)), order)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, val)
+		}
+		if _, err := d.Token(); err != nil {
+			return nil, fmt.Errorf("error in json.Token: %v", err)
+		}
+		return result, nil
+
+	case json.Number:
+		if c.numbers == JsonNumberExact {
+			return exactNumber(tv)
+		}
+		return tv, nil
+
+	default:
+		return tok, nil
+	}
+}
+
+// WithSTree returns an OrderedSTree holding s, with the keys of each of its STrees
+// ordered as those of the STree at the same path of o, followed by any others in
+// sorted order.
+func (o OrderedSTree) WithSTree(s STree) OrderedSTree {
+	order := keyOrder{}
+	o.order.record(FieldPath{}, s, order)
+	return OrderedSTree{s, order}
+}
+
+// record stores the keys of each STree within v, found at path, in result, in the
+// order given by o.
+func (o keyOrder) record(path FieldPath, v interface{}, result keyOrder) {
+	switch tv := v.(type) {
+	case STree:
+		keys := o.keysOf(path, tv)
+		result[path.String()] = keys
+		for _, k := range keys {
+			o.record(path.append(keyComponent(k)), tv[k], result)
+		}
+	case []interface{}:
+		if len(path) < 1 {
+			return
+		}
+		for i, e := range tv {
+			o.record(indexPath(path, i), e, result)
+		}
+	}
+}
+
+// keysOf returns the keys of t, found at path, in the recorded order, followed by
+// any keys lacking a recorded position in sorted order.
+func (o keyOrder) keysOf(path FieldPath, t STree) []interface{} {
+	keys := []interface{}{}
+	seen := map[interface{}]bool{}
+	for _, k := range o[path.String()] {
+		if _, ok := t[k]; ok && !seen[k] {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+	for _, k := range t.sortedKeys() {
+		if !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// OrderedKeys returns the keys of the STree at the specified path in order, the
+// path . denoting the root.
+func (o OrderedSTree) OrderedKeys(path string) ([]interface{}, error) {
+	if path == "." {
+		return o.order.keysOf(FieldPath{}, o.STree), nil
+	}
+	p, err := o.fieldPathOf("OrderedKeys", path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := o.STreeVal(path)
+	if err != nil {
+		return nil, err
+	}
+	return o.order.keysOf(p, t), nil
+}
+
+// SetVal returns a copy of the OrderedSTree with val stored at path, as by
+// STree.SetVal. Keys added along the path follow the existing keys of their STree.
+func (o OrderedSTree) SetVal(path string, val interface{}) (OrderedSTree, error) {
+	s, err := o.STree.SetVal(path, val)
+	if err != nil {
+		return OrderedSTree{}, err
+	}
+	return o.WithSTree(s), nil
+}
+
+func (o OrderedSTree) SetValMust(path string, val interface{}) OrderedSTree {
+	u, err := o.SetVal(path, val)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// Delete returns a copy of the OrderedSTree with the value at path removed, as by
+// STree.Delete. The order recorded for the elements of a slice following a deleted
+// element moves with them.
+func (o OrderedSTree) Delete(path string) (OrderedSTree, error) {
+
+	p, err := o.fieldPathOf("Delete", path)
+	if err != nil {
+		return OrderedSTree{}, err
+	}
+	s, err := o.STree.Delete(path)
+	if err != nil {
+		return OrderedSTree{}, err
+	}
+
+	slicePath, idx, ok := deletedElement(p)
+	if !ok {
+		return o.WithSTree(s), nil
+	}
+	return OrderedSTree{o.STree, o.order.shifted(slicePath, idx)}.WithSTree(s), nil
+}
+
+func (o OrderedSTree) DeleteMust(path string) OrderedSTree {
+	u, err := o.Delete(path)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// shifted returns a copy of o in which the order recorded beneath each element of
+// the slice at slicePath following the deleted index idx moves to the preceding
+// index, and that recorded beneath the deleted element is dropped.
+func (o keyOrder) shifted(slicePath string, idx int) keyOrder {
+	result := keyOrder{}
+	for p, keys := range o {
+		if shifted, ok := shiftedPath(p, slicePath, idx); ok {
+			result[shifted] = keys
+		}
+	}
+	return result
+}
+
+// deletedElement returns the String of the FieldPath of the slice holding the
+// element at p, and the index of the element, or false if p is not an element.
+func deletedElement(p FieldPath) (string, int, bool) {
+	key, idxs, err := STree{}.parsePathComponent(p.last())
+	if err != nil || len(idxs) < 1 {
+		return "", 0, false
+	}
+	slicePath := p[:len(p)-1].append(subscripted(keyComponent(key), idxs[:len(idxs)-1]))
+	return slicePath.String(), idxs[len(idxs)-1], true
+}
+
+// shiftedPath returns the path string p as it becomes once the element at index
+// idx of the slice at slicePath is deleted, or false if p lies beneath the deleted
+// element.
+func shiftedPath(p, slicePath string, idx int) (string, bool) {
+	rest := strings.TrimPrefix(p, slicePath+"[")
+	end := strings.IndexByte(rest, ']')
+	if rest == p || end < 0 {
+		return p, true
+	}
+	i, err := strconv.Atoi(rest[:end])
+	if err != nil || (len(rest) > end+1 && rest[end+1] != '.' && rest[end+1] != '[') {
+		return p, true
+	} else if i > idx {
+		return fmt.Sprintf("%s[%d]%s", slicePath, i-1, rest[end+1:]), true
+	}
+	return p, i < idx
+}
+
+// Merge returns a copy of the OrderedSTree with other merged into it, as by
+// STree.Merge. Keys of other lacking from the subject follow the existing keys of
+// their STree, in the order recorded by other.
+func (o OrderedSTree) Merge(other OrderedSTree, opts ...MergeOption) (OrderedSTree, []FieldPath, error) {
+
+	s, overridden, err := o.STree.Merge(other.STree, opts...)
+	if err != nil {
+		return OrderedSTree{}, nil, err
+	}
+
+	order := keyOrder{}
+	for p, keys := range o.order {
+		order[p] = keys
+	}
+	for p, keys := range other.order {
+		order[p] = append(append([]interface{}{}, order[p]...), keys...)
+	}
+	return OrderedSTree{s, order}.WithSTree(s), overridden, nil
+}
+
+// FieldPaths returns the paths to each leaf of the OrderedSTree, in order.
+func (o OrderedSTree) FieldPaths() []FieldPath {
+	paths := []FieldPath{}
+	o.Visit(NewVisitorBuilder().
+		WithPrimitiveVisitor(func(key string, val interface{}) error {
+			paths = append(paths, ValueOfPathMust(key))
+			return nil
+		}).
+		Visitor())
+	return paths
+}
+
+// Visit traverses the OrderedSTree as STree.Visit does, visiting keys in order.
+func (o OrderedSTree) Visit(v Visitor) error {
+	vis := &visitation{v, nil, func(parentKey FieldPath, t STree) []string {
+		keys := []string{}
+		for _, k := range o.order.keysOf(parentKey, t) {
+			keys = append(keys, keyComponent(k))
+		}
+		return keys
+	}}
+	return vis.visitSTree(FieldPath{}, o.STree)
+}
+
+// WriteYaml marshals the OrderedSTree as yaml, writing keys in order.
+func (o OrderedSTree) WriteYaml() ([]byte, error) {
+	return yaml.Marshal(o.order.mapSliceOf(FieldPath{}, o.STree))
+}
+
+// mapSliceOf returns v, found at path, with each STree converted to a yaml.MapSlice
+// holding its keys in order.
+func (o keyOrder) mapSliceOf(path FieldPath, v interface{}) interface{} {
+	switch tv := v.(type) {
+	case STree:
+		ms := yaml.MapSlice{}
+		for _, k := range o.keysOf(path, tv) {
+			ms = append(ms, yaml.MapItem{Key: k, Value: o.mapSliceOf(path.append(keyComponent(k)), tv[k])})
+		}
+		return ms
+	case []interface{}:
+		result := make([]interface{}, len(tv))
+		for i, e := range tv {
+			result[i] = o.mapSliceOf(indexPath(path, i), e)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// WriteJson marshals the OrderedSTree as json, writing keys in order.
+func (o OrderedSTree) WriteJson(indent bool) ([]byte, error) {
+
+	var buf bytes.Buffer
+	if err := o.order.writeJson(&buf, FieldPath{}, o.STree); err != nil {
+		return nil, err
+	}
+	if !indent {
+		return buf.Bytes(), nil
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), ``, `  `); err != nil {
+		return nil, fmt.Errorf("WriteJson error in json.Indent: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+func (o keyOrder) writeJson(buf *bytes.Buffer, path FieldPath, v interface{}) error {
+
+	switch tv := v.(type) {
+
+	case STree:
+		if err := tv.keyCollision(); err != nil {
+			return fmt.Errorf("WriteJson error at %s: %v", path, err)
+		}
+		buf.WriteByte('{')
+		for i, k := range o.keysOf(path, tv) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			kOut, _ := json.Marshal(keyString(k))
+			buf.Write(kOut)
+			buf.WriteByte(':')
+			if err := o.writeJson(buf, path.append(keyComponent(k)), tv[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range tv {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := o.writeJson(buf, indexPath(path, i), e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	default:
+		cv, err := unconvertVal(v)
+		if err != nil {
+			return fmt.Errorf("WriteJson error at %s: %v", path, err)
+		}
+		out, err := json.Marshal(cv)
+		if err != nil {
+			return fmt.Errorf("WriteJson error at %s: %v", path, err)
+		}
+		buf.Write(out)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package gostree
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestOrderedSTree(t *testing.T) {
+
+	defer log.Flush()
+
+	config := `zeta: 1
+alpha:
+  name: svc
+  port: 8080
+  env:
+  - prod
+  - stage
+middle:
+- id: b
+  weight: 2
+- id: a
+  weight: 1
+  extra: true
+`
+
+	Convey("Test NewOrderedSTreeYaml and WriteYaml\n", t, func() {
+		o, err := NewOrderedSTreeYaml(strings.NewReader(config))
+		So(err, ShouldBeNil)
+		So(o.IntValMust(".alpha.port"), ShouldEqual, 8080)
+
+		keys, err := o.OrderedKeys(".")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"zeta", "alpha", "middle"})
+		keys, err = o.OrderedKeys(".middle[1]")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"id", "weight", "extra"})
+
+		out, err := o.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, config)
+
+		paths := []string{}
+		for _, p := range o.FieldPaths() {
+			paths = append(paths, p.String())
+		}
+		So(paths, ShouldResemble, []string{".zeta", ".alpha.name", ".alpha.port", ".alpha.env[0]", ".alpha.env[1]",
+			".middle[0].id", ".middle[0].weight", ".middle[1].id", ".middle[1].weight", ".middle[1].extra"})
+
+		_, err = NewOrderedSTreeYaml(strings.NewReader("- not a mapping\n"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test OrderedSTree edits\n", t, func() {
+		o, err := NewOrderedSTreeYaml(strings.NewReader(config))
+		So(err, ShouldBeNil)
+
+		e, err := o.SetVal(".alpha.port", 9090)
+		So(err, ShouldBeNil)
+		e, err = e.SetVal(".alpha.added", "new")
+		So(err, ShouldBeNil)
+		e, err = e.SetVal(".beta.b", 1)
+		So(err, ShouldBeNil)
+		e, err = e.SetVal(".beta.a", 2)
+		So(err, ShouldBeNil)
+
+		out, err := e.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `zeta: 1
+alpha:
+  name: svc
+  port: 9090
+  env:
+  - prod
+  - stage
+  added: new
+middle:
+- id: b
+  weight: 2
+- id: a
+  weight: 1
+  extra: true
+beta:
+  b: 1
+  a: 2
+`)
+
+		keys, err := e.OrderedKeys(".alpha")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"name", "port", "env", "added"})
+		keys, err = e.OrderedKeys(".")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"zeta", "alpha", "middle", "beta"})
+		keys, err = e.OrderedKeys(".beta")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"b", "a"})
+
+		d, err := o.Delete(".middle[0]")
+		So(err, ShouldBeNil)
+		keys, err = d.OrderedKeys(".middle[0]")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"id", "weight", "extra"})
+		d, err = d.Delete(".zeta")
+		So(err, ShouldBeNil)
+		d, err = d.SetVal(".zeta", 1)
+		So(err, ShouldBeNil)
+		keys, err = d.OrderedKeys(".")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"alpha", "middle", "zeta"})
+
+		other, err := NewOrderedSTreeJson(strings.NewReader(`{"omega": {"y": 1, "x": 2}, "alpha": {"port": 1, "tls": true}}`))
+		So(err, ShouldBeNil)
+		m, overridden, err := o.Merge(other)
+		So(err, ShouldBeNil)
+		So(overridden, ShouldResemble, []FieldPath{{"alpha", "port"}})
+		keys, err = m.OrderedKeys(".")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"zeta", "alpha", "middle", "omega"})
+		keys, err = m.OrderedKeys(".alpha")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"name", "port", "env", "tls"})
+		keys, err = m.OrderedKeys(".omega")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"y", "x"})
+
+		p, err := o.Prune(func(path FieldPath, val interface{}) bool { return path.String() == ".alpha.env" })
+		So(err, ShouldBeNil)
+		keys, err = o.WithSTree(p).OrderedKeys(".alpha")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"name", "port"})
+	})
+
+	Convey("Test NewOrderedSTreeJson and WriteJson\n", t, func() {
+		j := `{"z":1,"a":{"y":[{"q":true,"p":null}],"b":"x"},"big":9007199254740993}`
+		o, err := NewOrderedSTreeJson(strings.NewReader(j), WithJsonNumbers(JsonNumberRaw))
+		So(err, ShouldBeNil)
+
+		out, err := o.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, j)
+
+		out, err = o.WriteJson(true)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldStartWith, "{\n  \"z\": 1,\n  \"a\": {\n    \"y\": [")
+
+		y, err := o.WriteYaml()
+		So(err, ShouldBeNil)
+		fromYaml, err := NewOrderedSTreeYaml(strings.NewReader(string(y)))
+		So(err, ShouldBeNil)
+		keys, err := fromYaml.OrderedKeys(".a.y[0]")
+		So(err, ShouldBeNil)
+		So(keys, ShouldResemble, []interface{}{"q", "p"})
+
+		visited := []string{}
+		err = o.Visit(NewVisitorBuilder().
+			WithSTreeBeginVisitor(func(key string, val STree) error {
+				visited = append(visited, key)
+				return nil
+			}).
+			Visitor())
+		So(err, ShouldBeNil)
+		So(visited, ShouldResemble, []string{"", ".a", ".a.y[0]"})
+
+		f, err := NewOrderedSTreeJson(strings.NewReader(`{"n": 1.5}`))
+		So(err, ShouldBeNil)
+		So(f.FloatValMust(".n"), ShouldEqual, 1.5)
+
+		_, err = NewOrderedSTreeJson(strings.NewReader(`[1]`))
+		So(err, ShouldNotBeNil)
+		_, err = NewOrderedSTreeJson(strings.NewReader(`{"a": }`))
+		So(err, ShouldNotBeNil)
+		_, err = NewOrderedSTreeJson(strings.NewReader(`{"a": 1} 2`))
+		So(err, ShouldNotBeNil)
+
+		s := NewOrderedSTree(STree{"b": 1, "a": 2})
+		out, err = s.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `{"a":2,"b":1}`)
+	})
+}
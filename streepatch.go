@@ -0,0 +1,443 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RFC 6902 JSON Patch operation names
+const (
+	PATCH_ADD     = "add"
+	PATCH_REMOVE  = "remove"
+	PATCH_REPLACE = "replace"
+	PATCH_MOVE    = "move"
+	PATCH_COPY    = "copy"
+	PATCH_TEST    = "test"
+)
+
+// PatchOp is a single RFC 6902 JSON Patch operation. Path and From are RFC 6901
+// JSON Pointers, e.g. /a/b/0, which are translated to the equivalent STree path,
+// e.g. .a.b[0], against the tree the operation is applied to.
+type PatchOp struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// Patch is an RFC 6902 JSON Patch document, a sequence of operations applied in order.
+type Patch []PatchOp
+
+// NewPatchJson reads a JSON Patch document from the specified reader.
+func NewPatchJson(r io.Reader) (Patch, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return nil, fmt.Errorf("NewPatchJson error reading bytes: %v", err)
+	}
+
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  *string         `json:"path"`
+		From  *string         `json:"from"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err = json.Unmarshal(buf.Bytes(), &ops); err != nil {
+		return nil, fmt.Errorf("NewPatchJson error in json.Unmarshal: %v", err)
+	}
+
+	patch := Patch{}
+	for i, op := range ops {
+
+		if op.Path == nil {
+			return nil, fmt.Errorf("NewPatchJson operation %d lacks path", i)
+		}
+		pOp := PatchOp{Op: op.Op, Path: *op.Path}
+
+		if op.Op == PATCH_MOVE || op.Op == PATCH_COPY {
+			if op.From == nil {
+				return nil, fmt.Errorf("NewPatchJson operation %d (%s) lacks from", i, op.Op)
+			}
+			pOp.From = *op.From
+		}
+
+		if op.Op == PATCH_ADD || op.Op == PATCH_REPLACE || op.Op == PATCH_TEST {
+			if len(op.Value) < 1 {
+				return nil, fmt.Errorf("NewPatchJson operation %d (%s) lacks value", i, op.Op)
+			}
+			var v interface{}
+			if err = json.Unmarshal(op.Value, &v); err != nil {
+				return nil, fmt.Errorf("NewPatchJson operation %d error in json.Unmarshal: %v", i, err)
+			}
+			if pOp.Value, err = convertVal(v); err != nil {
+				return nil, fmt.Errorf("NewPatchJson operation %d error in convertVal: %v", i, err)
+			}
+		}
+
+		patch = append(patch, pOp)
+	}
+
+	return patch, nil
+}
+
+// MarshalJSON renders the operation as a JSON Patch object, including only the
+// members relevant to its op.
+func (o PatchOp) MarshalJSON() ([]byte, error) {
+
+	m := map[string]interface{}{"op": o.Op, "path": o.Path}
+	switch o.Op {
+	case PATCH_MOVE, PATCH_COPY:
+		m["from"] = o.From
+	case PATCH_ADD, PATCH_REPLACE, PATCH_TEST:
+		v, err := unconvertVal(o.Value)
+		if err != nil {
+			return nil, fmt.Errorf("PatchOp MarshalJSON error in unconvertVal: %v", err)
+		}
+		m["value"] = v
+	}
+
+	return json.Marshal(m)
+}
+
+func (p Patch) WriteJson(indent bool) ([]byte, error) {
+	if indent {
+		return json.MarshalIndent(p, ``, `  `)
+	}
+	return json.Marshal(p)
+}
+
+// ApplyPatch returns a copy of the STree with the operations of p applied in order.
+// The patch is applied atomically: if any operation fails, including a failed test
+// operation, an error is returned and no modified tree is produced.
+func (t STree) ApplyPatch(p Patch) (STree, error) {
+
+	doc, err := t.clone()
+	if err != nil {
+		return nil, fmt.Errorf("ApplyPatch clone error: %v", err)
+	}
+
+	for i, op := range p {
+		if doc, err = doc.applyPatchOp(op); err != nil {
+			return nil, fmt.Errorf("ApplyPatch operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func (t STree) ApplyPatchMust(p Patch) STree {
+	u, err := t.ApplyPatch(p)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func (t STree) applyPatchOp(op PatchOp) (STree, error) {
+
+	switch op.Op {
+
+	case PATCH_ADD:
+		val, err := cloneVal(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return t.patchAdd(op.Path, val)
+
+	case PATCH_REMOVE:
+		return t.patchRemove(op.Path)
+
+	case PATCH_REPLACE:
+		if _, err := t.patchGet(op.Path); err != nil {
+			return nil, err
+		}
+		val, err := cloneVal(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if op.Path == "" {
+			return t.patchAdd(op.Path, val)
+		}
+		if t, err = t.patchRemove(op.Path); err != nil {
+			return nil, err
+		}
+		return t.patchAdd(op.Path, val)
+
+	case PATCH_MOVE:
+		if op.From == op.Path {
+			return t, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("patch move from %s to its own child %s: %w", op.From, op.Path, ErrInvalidPath)
+		}
+		val, err := t.patchGet(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if t, err = t.patchRemove(op.From); err != nil {
+			return nil, err
+		}
+		return t.patchAdd(op.Path, val)
+
+	case PATCH_COPY:
+		val, err := t.patchGet(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if val, err = cloneVal(val); err != nil {
+			return nil, err
+		}
+		return t.patchAdd(op.Path, val)
+
+	case PATCH_TEST:
+		val, err := t.patchGet(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !valuesEqual(val, op.Value) {
+			return nil, fmt.Errorf("found %v, expected %v: %w", PrintValue(val), PrintValue(op.Value), ErrPatchTestFailed)
+		}
+		return t, nil
+
+	default:
+		return nil, fmt.Errorf("unknown patch op '%s'", op.Op)
+	}
+}
+
+func (t STree) patchGet(ptr string) (interface{}, error) {
+
+	path, err := t.patchPath(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) < 1 {
+		return t, nil
+	}
+	return t.val("ApplyPatch", path.String())
+}
+
+func (t STree) patchAdd(ptr string, val interface{}) (STree, error) {
+
+	path, err := t.patchPath(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) < 1 {
+		if tVal, ok := val.(STree); ok {
+			return tVal, nil
+		}
+		return nil, &PathError{Op: "ApplyPatch", Path: ptr, Expected: KindSTree, Actual: kindName(val), Err: ErrTypeMismatch}
+	}
+
+	key, idxs, err := t.parsePathComponent(path.last())
+	if err != nil {
+		return nil, &PathError{Op: "ApplyPatch", Path: ptr, Component: path.last(), Err: ErrInvalidPath}
+	}
+	if len(idxs) < 1 {
+		return t.setPathVal(path, val)
+	}
+
+	// insert into the slice holding the final element rather than replacing it
+	idx := idxs[len(idxs)-1]
+	parent := path[:len(path)-1].append(subscripted(keyComponent(key), idxs[:len(idxs)-1]))
+	sVal, err := t.val("ApplyPatch", parent.String())
+	if err != nil {
+		return nil, err
+	}
+	sOld := sVal.([]interface{})
+	if idx > len(sOld) {
+		return nil, &PathError{Op: "ApplyPatch", Path: ptr, Component: path.last(),
+			Expected: fmt.Sprintf("index in [0,%d]", len(sOld)), Actual: fmt.Sprintf("index %d", idx), Err: ErrIndexOutOfRange}
+	}
+
+	sNew := make([]interface{}, 0, len(sOld)+1)
+	sNew = append(sNew, sOld[:idx]...)
+	sNew = append(sNew, val)
+	sNew = append(sNew, sOld[idx:]...)
+	return t.setPathVal(parent, sNew)
+}
+
+func (t STree) patchRemove(ptr string) (STree, error) {
+
+	path, err := t.patchPath(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) < 1 {
+		return nil, &PathError{Op: "ApplyPatch", Path: ptr, Err: ErrInvalidPath}
+	}
+	return t, t.deletePathVal(path.String(), path)
+}
+
+// patchPath translates the JSON Pointer ptr of a patch operation into the
+// equivalent FieldPath within this STree.
+func (t STree) patchPath(ptr string) (FieldPath, error) {
+	p, err := ParsePointer(ptr)
+	if err != nil {
+		return nil, &PathError{Op: "ApplyPatch", Path: ptr, Err: ErrInvalidPath}
+	}
+	return t.resolvePointer("ApplyPatch", ptr, p)
+}
+
+// subscripted returns the path component consisting of key followed by the
+// subscripts idxs, e.g. key[1][2].
+func subscripted(key string, idxs []int) string {
+	var buf bytes.Buffer
+	buf.WriteString(key)
+	for _, idx := range idxs {
+		buf.WriteString(fmt.Sprintf("[%d]", idx))
+	}
+	return buf.String()
+}
+
+// cloneVal returns a deep copy of v, which must uphold the STree invariants.
+func cloneVal(v interface{}) (interface{}, error) {
+	conv, err := convertVal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cloneVal error in convertVal: %v", err)
+	}
+	c, err := STree{"v": conv}.clone()
+	if err != nil {
+		return nil, fmt.Errorf("cloneVal error: %v", err)
+	}
+	return c["v"], nil
+}
+
+// Diff returns a Patch which transforms a into b, such that a.ApplyPatch of the
+// patch compares to b without difference. It is built on a.CompareTo(b): values that
+// differ are replaced, and values lacking from either tree are added or removed at
+// the shallowest path at which they are lacking. Empty STrees and slices, which
+// hold no field paths to compare, are compared separately. Removals come first,
+// deepest slice indices first, followed by replacements and then additions. An
+// error is returned if the trees cannot be compared.
+func Diff(a, b STree) (Patch, error) {
+
+	comp, err := a.CompareTo(b)
+	if err != nil {
+		return nil, fmt.Errorf("Diff error in CompareTo: %w", err)
+	}
+	paths := []string{}
+	for p, r := range comp {
+		if r != COMP_NO_DIFFERENCE {
+			paths = append(paths, p)
+		}
+	}
+	for _, p := range append(a.emptyPaths(FieldPath{}, nil), b.emptyPaths(FieldPath{}, nil)...) {
+		paths = append(paths, p.String())
+	}
+
+	targets := map[string]PatchOp{}
+	for _, p := range paths {
+		path, err := ValueOfPath(p)
+		if err != nil {
+			return nil, fmt.Errorf("Diff error in ValueOfPath: %w", err)
+		}
+		if op, ok := diffOp(a, b, path); ok {
+			targets[op.Path] = op
+		}
+	}
+
+	var removes, replaces, adds []PatchOp
+	for _, op := range targets {
+		switch op.Op {
+		case PATCH_REMOVE:
+			removes = append(removes, op)
+		case PATCH_REPLACE:
+			replaces = append(replaces, op)
+		default:
+			adds = append(adds, op)
+		}
+	}
+	sortPatchOps(removes)
+	for i, j := 0, len(removes)-1; i < j; i, j = i+1, j-1 {
+		removes[i], removes[j] = removes[j], removes[i]
+	}
+	sortPatchOps(replaces)
+	sortPatchOps(adds)
+
+	patch := Patch{}
+	patch = append(patch, removes...)
+	patch = append(patch, replaces...)
+	return append(patch, adds...), nil
+}
+
+func DiffMust(a, b STree) Patch {
+	p, err := Diff(a, b)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// diffOp returns the operation of Diff for a path reported by CompareTo, which
+// applies to the shallowest prefix of the path lacking from either tree or holding
+// values other than an STree in both trees or a slice in both trees.
+func diffOp(a, b STree, path FieldPath) (PatchOp, bool) {
+
+	for _, prefix := range pathPrefixes(path) {
+		pStr := prefix.String()
+		aVal, aErr := a.Val(pStr)
+		bVal, bErr := b.Val(pStr)
+		ptr := prefix.Pointer().String()
+		switch {
+		case aErr != nil && bErr != nil:
+			return PatchOp{}, false
+		case aErr != nil:
+			return PatchOp{Op: PATCH_ADD, Path: ptr, Value: bVal}, true
+		case bErr != nil:
+			return PatchOp{Op: PATCH_REMOVE, Path: ptr}, true
+		}
+		_, aTree := aVal.(STree)
+		_, bTree := bVal.(STree)
+		if aTree && bTree || IsSlice(aVal) && IsSlice(bVal) {
+			continue
+		}
+		return PatchOp{Op: PATCH_REPLACE, Path: ptr, Value: bVal}, true
+	}
+	return PatchOp{}, false
+}
+
+// pathPrefixes returns each prefix of path in turn, from its first key to path
+// itself, with each subscript of a path component yielding a further prefix, e.g.
+// .a, .a.b, .a.b[0] and .a.b[0][1] for .a.b[0][1].
+func pathPrefixes(path FieldPath) []FieldPath {
+
+	prefixes := []FieldPath{}
+	for i, c := range path {
+		key, idxs, err := STree(nil).parsePathComponent(c)
+		if err != nil {
+			prefixes = append(prefixes, path[:i+1])
+			continue
+		}
+		for j := 0; j <= len(idxs); j++ {
+			prefixes = append(prefixes, path[:i].append(subscripted(keyComponent(key), idxs[:j])))
+		}
+	}
+	return prefixes
+}
+
+// sortPatchOps sorts ops by path, comparing reference tokens which are both
+// slice indices by their numeric value.
+func sortPatchOps(ops []PatchOp) {
+	sort.Slice(ops, func(i, j int) bool {
+		pi, pj := ParsePointerMust(ops[i].Path), ParsePointerMust(ops[j].Path)
+		for k := 0; k < len(pi) && k < len(pj); k++ {
+			if pi[k] == pj[k] {
+				continue
+			}
+			ni, errI := strconv.Atoi(pi[k])
+			nj, errJ := strconv.Atoi(pj[k])
+			if errI == nil && errJ == nil {
+				return ni < nj
+			}
+			return pi[k] < pj[k]
+		}
+		return len(pi) < len(pj)
+	})
+}
@@ -0,0 +1,203 @@
+package gostree
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreePatch(t *testing.T) {
+
+	defer log.Flush()
+
+	json := `
+	{
+		"key1": "val1",
+		"key2": {"key3": true, "a/b": 1, "m~n": 2},
+		"key4": [1, [2, 3], {"key5": "val5"}]
+	}`
+
+	Convey("Test ApplyPatch\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		patch, err := NewPatchJson(strings.NewReader(`[
+			{"op": "test", "path": "/key1", "value": "val1"},
+			{"op": "add", "path": "/key6", "value": {"key7": [null]}},
+			{"op": "add", "path": "/key4/1/1", "value": 2.5},
+			{"op": "add", "path": "/key4/-", "value": "last"},
+			{"op": "remove", "path": "/key2/m~0n"},
+			{"op": "replace", "path": "/key4/0", "value": "first"},
+			{"op": "move", "from": "/key2/a~1b", "path": "/key8"},
+			{"op": "copy", "from": "/key4/2", "path": "/key2/key9"}
+		]`))
+		So(err, ShouldBeNil)
+
+		p, err := s.ApplyPatch(patch)
+		So(err, ShouldBeNil)
+		So(p.SliceValMust(".key6.key7"), ShouldResemble, []interface{}{nil})
+		So(p.SliceValMust(".key4[1]"), ShouldResemble, []interface{}{2.0, 2.5, 3.0})
+		So(p.StrValMust(".key4[3]"), ShouldEqual, "last")
+		So(p.StrValMust(".key4[0]"), ShouldEqual, "first")
+		So(p.FloatValMust(".key8"), ShouldEqual, 1)
+		So(p.STreeValMust(".key2"), ShouldResemble, STree{"key3": true, "key9": STree{"key5": "val5"}})
+
+		p.STreeValMust(".key2.key9")["key5"] = "modified"
+		So(p.StrValMust(".key4[2].key5"), ShouldEqual, "val5")
+		So(s.SliceValMust(".key4"), ShouldHaveLength, 3)
+	})
+
+	Convey("Test ApplyPatch replace root\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		p, err := s.ApplyPatch(Patch{{Op: PATCH_REPLACE, Path: "", Value: STree{"key1": "new"}}})
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, STree{"key1": "new"})
+
+		_, err = s.ApplyPatch(Patch{{Op: PATCH_REPLACE, Path: "", Value: "new"}})
+		So(errors.Is(err, ErrTypeMismatch), ShouldBeTrue)
+	})
+
+	Convey("Test ApplyPatch is atomic\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		_, err = s.ApplyPatch(Patch{
+			{Op: PATCH_REMOVE, Path: "/key1"},
+			{Op: PATCH_TEST, Path: "/key2/key3", Value: false},
+		})
+		So(errors.Is(err, ErrPatchTestFailed), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "operation 1 (test /key2/key3)")
+		So(s.StrValMust(".key1"), ShouldEqual, "val1")
+	})
+
+	Convey("Test ApplyPatch errors\n", t, func() {
+		s, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+
+		_, err = s.ApplyPatch(Patch{{Op: PATCH_REMOVE, Path: "/key9"}})
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		_, err = s.ApplyPatch(Patch{{Op: PATCH_REPLACE, Path: "/key9", Value: 1}})
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		_, err = s.ApplyPatch(Patch{{Op: PATCH_ADD, Path: "/key9/key10", Value: 1}})
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		_, err = s.ApplyPatch(Patch{{Op: PATCH_ADD, Path: "/key4/5", Value: 1}})
+		So(errors.Is(err, ErrIndexOutOfRange), ShouldBeTrue)
+		_, err = s.ApplyPatch(Patch{{Op: PATCH_MOVE, From: "/key2", Path: "/key2/key3"}})
+		So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+		_, err = s.ApplyPatch(Patch{{Op: "frobnicate", Path: "/key1"}})
+		So(err, ShouldNotBeNil)
+
+		_, err = NewPatchJson(strings.NewReader(`[{"op": "add", "path": "/key1"}]`))
+		So(err, ShouldNotBeNil)
+		_, err = NewPatchJson(strings.NewReader(`[{"op": "remove"}]`))
+		So(err, ShouldNotBeNil)
+		_, err = NewPatchJson(strings.NewReader(`[{"op": "copy", "path": "/key9"}]`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "lacks from")
+		_, err = NewPatchJson(strings.NewReader(`[{"op": "move", "path": "/key9"}]`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "lacks from")
+	})
+
+	Convey("Test Diff\n", t, func() {
+		a, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+		b, err := NewSTreeJson(strings.NewReader(`
+		{
+			"key1": "val1new",
+			"key2": {"key3": true, "a/b": {"x": null}},
+			"key4": [1, [2], {"key5": "val5"}, 4, 5],
+			"key6": [null]
+		}`))
+		So(err, ShouldBeNil)
+
+		patch := DiffMust(a, b)
+		So(patch, ShouldResemble, Patch{
+			{Op: PATCH_REMOVE, Path: "/key4/1/1"},
+			{Op: PATCH_REMOVE, Path: "/key2/m~0n"},
+			{Op: PATCH_REPLACE, Path: "/key1", Value: "val1new"},
+			{Op: PATCH_REPLACE, Path: "/key2/a~1b", Value: STree{"x": nil}},
+			{Op: PATCH_ADD, Path: "/key4/3", Value: 4.0},
+			{Op: PATCH_ADD, Path: "/key4/4", Value: 5.0},
+			{Op: PATCH_ADD, Path: "/key6", Value: []interface{}{nil}},
+		})
+
+		p, err := a.ApplyPatch(patch)
+		So(err, ShouldBeNil)
+		r, err := p.CompareTo(b)
+		So(err, ShouldBeNil)
+		for _, rr := range r {
+			So(rr, ShouldEqual, COMP_NO_DIFFERENCE)
+		}
+		So(DiffMust(p, b), ShouldBeEmpty)
+	})
+
+	Convey("Test Diff of slices and empty values\n", t, func() {
+		a := STree{"l": []interface{}{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, "e": STree{}, "n": 1}
+		b := STree{"l": []interface{}{1}, "f": []interface{}{}, "n": 2}
+
+		patch := DiffMust(a, b)
+		So(patch[0], ShouldResemble, PatchOp{Op: PATCH_REMOVE, Path: "/l/10"})
+		So(patch[9], ShouldResemble, PatchOp{Op: PATCH_REMOVE, Path: "/l/1"})
+		So(patch[10:], ShouldResemble, Patch{
+			{Op: PATCH_REMOVE, Path: "/e"},
+			{Op: PATCH_REPLACE, Path: "/n", Value: 2},
+			{Op: PATCH_ADD, Path: "/f", Value: []interface{}{}},
+		})
+
+		p, err := a.ApplyPatch(patch)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, b)
+		So(DiffMust(p, b), ShouldBeEmpty)
+	})
+
+	Convey("Test Diff of keys holding braces and brackets\n", t, func() {
+		a := STree{"b}c[0]": 1, "z": 1}
+		b := STree{"b}c[0]": 2, "z": 2}
+
+		patch, err := Diff(a, b)
+		So(err, ShouldBeNil)
+		So(patch, ShouldResemble, Patch{
+			{Op: PATCH_REPLACE, Path: "/b}c[0]", Value: 2},
+			{Op: PATCH_REPLACE, Path: "/z", Value: 2},
+		})
+		p, err := a.ApplyPatch(patch)
+		So(err, ShouldBeNil)
+		So(p, ShouldResemble, b)
+	})
+
+	Convey("Test Diff errors\n", t, func() {
+		// a NaN key is never equal to itself, so its path cannot be resolved
+		a := STree{math.NaN(): 1, "z": 1}
+		b := STree{"z": 2}
+
+		patch, err := Diff(a, b)
+		So(err, ShouldNotBeNil)
+		So(patch, ShouldBeNil)
+		So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		So(func() { DiffMust(a, b) }, ShouldPanic)
+	})
+
+	Convey("Test Patch WriteJson round trip\n", t, func() {
+		a, err := NewSTreeJson(strings.NewReader(json))
+		So(err, ShouldBeNil)
+		b, err := a.SetVal(".key2.key3", STree{"key10": []interface{}{1.0, "x"}})
+		So(err, ShouldBeNil)
+
+		out, err := DiffMust(a, b).WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `[{"op":"replace","path":"/key2/key3","value":{"key10":[1,"x"]}}]`)
+
+		patch, err := NewPatchJson(strings.NewReader(string(out)))
+		So(err, ShouldBeNil)
+		So(patch, ShouldResemble, DiffMust(a, b))
+	})
+}
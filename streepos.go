@@ -0,0 +1,464 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// Pos is the position of a value within the document it was read from. Line and
+// Column count from 1, with columns in characters.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// String returns the position as line:column, as used in compiler messages.
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Positions holds the position within its source document of each value of an
+// STree, indexed by the String of its FieldPath, the empty string denoting the root.
+type Positions map[string]Pos
+
+// Position returns the position of the value at the specified path, which is
+// relative to the root of the STree as read.
+func (p Positions) Position(path string) (Pos, bool) {
+	fp, err := ValueOfPath(path)
+	if err != nil {
+		return Pos{}, false
+	}
+	pos, ok := p[fp.String()]
+	return pos, ok
+}
+
+// replaced returns the positions less those at or beneath the path of a replaced
+// value.
+func (p Positions) replaced(path FieldPath) Positions {
+	result, prefix := Positions{}, path.String()
+	for k, pos := range p {
+		if len(path) < 1 || !underPath(k, prefix) {
+			result[k] = pos
+		}
+	}
+	return result
+}
+
+// deleted returns the positions less those at or beneath the path of a deleted
+// value. If it is a slice element, the positions of the elements following it
+// move with them.
+func (p Positions) deleted(path FieldPath) Positions {
+	slicePath, idx, ok := deletedElement(path)
+	if !ok {
+		return p.replaced(path)
+	}
+	result := Positions{}
+	for k, pos := range p {
+		if shifted, ok := shiftedPath(k, slicePath, idx); ok {
+			result[shifted] = pos
+		}
+	}
+	return result
+}
+
+// PositionedSTree is an STree along with the position within its source document
+// of each of its values. SetVal and Delete carry the positions over to their
+// results, less those of the values they replace or remove. All other methods
+// apply to the embedded STree.
+type PositionedSTree struct {
+	STree
+	Positions Positions
+}
+
+// NewPositionedSTreeYaml reads yaml from the specified reader as NewSTreeYaml
+// does, recording the position of each value. An alias is given its own position
+// and the values within it those of the anchored values, and merged keys are given
+// the positions of the values they take under the alias mode of opts.
+func NewPositionedSTreeYaml(r io.Reader, opts ...YamlOption) (PositionedSTree, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := buf.ReadFrom(r); err != nil {
+		return PositionedSTree{}, fmt.Errorf("NewPositionedSTreeYaml error reading bytes: %v", err)
+	}
+
+	c := newYamlCodec(opts)
+	s, err := c.unmarshal(buf.Bytes())
+	if err != nil {
+		return PositionedSTree{}, fmt.Errorf("NewPositionedSTreeYaml %v", err)
+	}
+	p, err := c.yamlPositions(buf.Bytes())
+	if err != nil {
+		return PositionedSTree{}, fmt.Errorf("NewPositionedSTreeYaml %v", err)
+	}
+	return PositionedSTree{s, p}, nil
+}
+
+// NewPositionedSTreeJson reads json from the specified reader as NewSTreeJson
+// does, recording the position of each value. Positions refer to the document as
+// written, with WithJson5 as without.
+func NewPositionedSTreeJson(r io.Reader, opts ...JsonOption) (PositionedSTree, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := buf.ReadFrom(r); err != nil {
+		return PositionedSTree{}, fmt.Errorf("NewPositionedSTreeJson error reading bytes: %v", err)
+	}
+
+	c := newJsonCodec(opts)
+	s, err := c.unmarshal(buf.Bytes())
+	if err != nil {
+		return PositionedSTree{}, fmt.Errorf("NewPositionedSTreeJson %w", err)
+	}
+	p, err := c.jsonPositions(buf.Bytes())
+	if err != nil {
+		return PositionedSTree{}, fmt.Errorf("NewPositionedSTreeJson %w", err)
+	}
+	return PositionedSTree{s, p}, nil
+}
+
+// Position returns the position within its source document of the value at the
+// specified path, unless the value was replaced since it was read.
+func (t PositionedSTree) Position(path string) (Pos, bool) {
+	p, err := t.fieldPathOf("Position", path)
+	if err != nil {
+		return Pos{}, false
+	}
+	pos, ok := t.Positions[p.String()]
+	return pos, ok
+}
+
+// SetVal returns a copy of the PositionedSTree with val stored at path, as by
+// STree.SetVal, lacking the positions of the value replaced and those beneath it.
+func (t PositionedSTree) SetVal(path string, val interface{}) (PositionedSTree, error) {
+	p, err := t.fieldPathOf("SetVal", path)
+	if err != nil {
+		return PositionedSTree{}, fmt.Errorf("SetVal ValueOfPath error: %w", err)
+	}
+	s, err := t.STree.SetVal(path, val)
+	if err != nil {
+		return PositionedSTree{}, err
+	}
+	return PositionedSTree{s, t.Positions.replaced(p)}, nil
+}
+
+func (t PositionedSTree) SetValMust(path string, val interface{}) PositionedSTree {
+	u, err := t.SetVal(path, val)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// Delete returns a copy of the PositionedSTree with the value at path removed, as
+// by STree.Delete. The positions of the elements of a slice following a deleted
+// element move with them.
+func (t PositionedSTree) Delete(path string) (PositionedSTree, error) {
+	p, err := t.fieldPathOf("Delete", path)
+	if err != nil {
+		return PositionedSTree{}, err
+	}
+	s, err := t.STree.Delete(path)
+	if err != nil {
+		return PositionedSTree{}, err
+	}
+	return PositionedSTree{s, t.Positions.deleted(p)}, nil
+}
+
+func (t PositionedSTree) DeleteMust(path string) PositionedSTree {
+	u, err := t.Delete(path)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// underPath returns true if the path string p is prefix or lies beneath it.
+func underPath(p, prefix string) bool {
+	rest := strings.TrimPrefix(p, prefix)
+	return rest != p && (rest == "" || rest[0] == '.' || rest[0] == '[')
+}
+
+// recordYaml stores in t the position of the node n, found at path, and of each
+// value within it. Aliases in active are not followed again, so that a recursive
+// alias ends the walk.
+func (t Positions) recordYaml(path FieldPath, n *yaml3.Node, mode YamlAliasMode, active map[*yaml3.Node]bool) error {
+
+	t[path.String()] = Pos{n.Line, n.Column}
+
+	if n.Kind == yaml3.AliasNode {
+		if active[n.Alias] {
+			return nil
+		}
+		active[n.Alias] = true
+		defer delete(active, n.Alias)
+		n = n.Alias
+	}
+
+	switch n.Kind {
+
+	case yaml3.SequenceNode:
+		for i, e := range n.Content {
+			if err := t.recordYaml(indexPath(path, i), e, mode, active); err != nil {
+				return err
+			}
+		}
+
+	case yaml3.MappingNode:
+		entries, err := yamlEntries(n, mode, active)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err = t.recordYaml(path.append(keyComponent(e.key)), e.val, mode, active); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlEntry is a key of a yaml mapping along with its value node.
+type yamlEntry struct {
+	key interface{}
+	val *yaml3.Node
+}
+
+// yamlEntries returns the entries of the mapping n, with those of the mappings
+// merged into it included unless mode is YamlAliasKeep, taking precedence as they
+// do for the reader of that mode.
+func yamlEntries(n *yaml3.Node, mode YamlAliasMode, active map[*yaml3.Node]bool) ([]yamlEntry, error) {
+	e := &yamlEntryList{index: map[interface{}]int{}}
+	var err error
+	switch mode {
+	case YamlAliasKeep:
+		err = e.addAll(n, false, active)
+	case YamlAliasResolve:
+		err = e.addResolved(n, active)
+	default:
+		err = e.addAll(n, true, active)
+	}
+	return e.entries, err
+}
+
+// yamlEntryList accumulates the entries of a mapping, indexed by key.
+type yamlEntryList struct {
+	entries []yamlEntry
+	index   map[interface{}]int
+}
+
+// set stores the entry of key k, replacing any earlier entry of k if replace is
+// set and otherwise keeping it.
+func (e *yamlEntryList) set(k interface{}, val *yaml3.Node, replace bool) {
+	if i, ok := e.index[k]; !ok {
+		e.index[k] = len(e.entries)
+		e.entries = append(e.entries, yamlEntry{k, val})
+	} else if replace {
+		e.entries[i].val = val
+	}
+}
+
+// addAll sets the entries of the mapping n in document order, each replacing any
+// earlier entry of its key. If merge is set, merged mappings are set in place of
+// their << key, as by yaml.v2 under YamlAliasExpand, so that a merged key
+// overrides a key written before the << key, and is overridden by one written
+// after it. Earlier mappings of a merged sequence take precedence.
+func (e *yamlEntryList) addAll(n *yaml3.Node, merge bool, active map[*yaml3.Node]bool) error {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, err := yamlKeyVal(n.Content[i])
+		if err != nil {
+			return err
+		}
+		if k != mergeKey || !merge {
+			e.set(k, n.Content[i+1], true)
+			continue
+		}
+		sources := yamlMergeSources(n.Content[i+1])
+		for j := len(sources) - 1; j >= 0; j-- {
+			src := sources[j]
+			if active[src] {
+				continue
+			}
+			active[src] = true
+			err := e.addAll(src, merge, active)
+			delete(active, src)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addResolved sets the entries of the mapping n followed by those of the mappings
+// merged into it, as by YamlAliasResolve, so that keys written in n and earlier
+// merged mappings take precedence.
+func (e *yamlEntryList) addResolved(n *yaml3.Node, active map[*yaml3.Node]bool) error {
+	merged := []*yaml3.Node{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, err := yamlKeyVal(n.Content[i])
+		if err != nil {
+			return err
+		}
+		if k == mergeKey {
+			merged = append(merged, n.Content[i+1])
+			continue
+		}
+		e.set(k, n.Content[i+1], true)
+	}
+
+	for _, m := range merged {
+		for _, src := range yamlMergeSources(m) {
+			if active[src] {
+				continue
+			}
+			active[src] = true
+			sub := &yamlEntryList{index: map[interface{}]int{}}
+			err := sub.addResolved(src, active)
+			delete(active, src)
+			if err != nil {
+				return err
+			}
+			for _, se := range sub.entries {
+				e.set(se.key, se.val, false)
+			}
+		}
+	}
+	return nil
+}
+
+// yamlMergeSources returns the mappings merged by the value m of a << key.
+func yamlMergeSources(m *yaml3.Node) []*yaml3.Node {
+	sources := []*yaml3.Node{m}
+	if src := yamlAliased(m); src.Kind == yaml3.SequenceNode {
+		sources = src.Content
+	}
+	result := []*yaml3.Node{}
+	for _, src := range sources {
+		if src = yamlAliased(src); src.Kind == yaml3.MappingNode {
+			result = append(result, src)
+		}
+	}
+	return result
+}
+
+// yamlAliased returns the node aliased by n, or n itself if it is not an alias.
+func yamlAliased(n *yaml3.Node) *yaml3.Node {
+	if n.Kind == yaml3.AliasNode {
+		return n.Alias
+	}
+	return n
+}
+
+// yamlPositions returns the position of each value of the yaml document in data.
+func (c *yamlCodec) yamlPositions(data []byte) (Positions, error) {
+
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error in yaml3.Unmarshal: %v", err)
+	}
+	t := Positions{}
+	if doc.Kind != yaml3.DocumentNode || len(doc.Content) < 1 {
+		return t, nil
+	}
+	err := t.recordYaml(FieldPath{}, doc.Content[0], c.aliases, map[*yaml3.Node]bool{})
+	return t, err
+}
+
+// jsonPositions returns the position of each value of the json document in data,
+// read leniently if c is set to json5.
+func (c *jsonCodec) jsonPositions(data []byte) (Positions, error) {
+
+	src, starts := data, map[int]int(nil)
+	if c.json5 {
+		r, err := transcodeJson5(data)
+		if err != nil {
+			return nil, fmt.Errorf("error in transcodeJson5: %w", err)
+		}
+		src, data, starts = r.src, r.out.Bytes(), r.starts
+	}
+
+	w := &jsonPosWalker{data: data, starts: starts, lines: &lineCounter{src: src}}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	t := Positions{}
+	if err := w.record(d, FieldPath{}, t); err != nil {
+		return nil, fmt.Errorf("error in json.Decoder: %v", err)
+	}
+	return t, nil
+}
+
+// jsonPosWalker finds the positions of json values read by a json.Decoder from
+// data, which was transcoded from the source document if starts is not nil.
+type jsonPosWalker struct {
+	data   []byte
+	starts map[int]int
+	lines  *lineCounter
+}
+
+// record stores in t the position of the value next read by d, found at path,
+// and of each value within it.
+func (w *jsonPosWalker) record(d *json.Decoder, path FieldPath, t Positions) error {
+
+	// the decoder offset precedes any whitespace and separators before the value
+	off := int(d.InputOffset())
+	for off < len(w.data) && strings.IndexByte(" \t\r\n:,", w.data[off]) >= 0 {
+		off++
+	}
+	if w.starts != nil {
+		off = w.starts[off]
+	}
+	t[path.String()] = w.lines.pos(off)
+
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for d.More() {
+			k, err := d.Token()
+			if err != nil {
+				return err
+			}
+			if err = w.record(d, path.append(keyComponent(k)), t); err != nil {
+				return err
+			}
+		}
+		_, err = d.Token()
+	case json.Delim('['):
+		for i := 0; d.More(); i++ {
+			if err = w.record(d, indexPath(path, i), t); err != nil {
+				return err
+			}
+		}
+		_, err = d.Token()
+	}
+	return err
+}
+
+// lineCounter converts offsets within src, taken in increasing order, to
+// positions, counting lines and characters as it advances.
+type lineCounter struct {
+	src        []byte
+	off        int
+	line, char int
+}
+
+func (c *lineCounter) pos(off int) Pos {
+	if off < c.off {
+		*c = lineCounter{src: c.src}
+	}
+	for ; c.off < off && c.off < len(c.src); c.off++ {
+		if b := c.src[c.off]; b == '\n' {
+			c.line, c.char = c.line+1, 0
+		} else if b&0xc0 != 0x80 {
+			c.char++
+		}
+	}
+	return Pos{Line: c.line + 1, Column: c.char + 1}
+}
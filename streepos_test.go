@@ -0,0 +1,175 @@
+package gostree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestPositions(t *testing.T) {
+
+	defer log.Flush()
+
+	config := `defaults: &defaults
+  timeout: 30
+  retries: 3
+server:
+  <<: *defaults
+  host: "example.com"
+  port: eighty
+  tags:
+    - web
+    - {name: édge, weight: 2}
+`
+
+	Convey("Test NewPositionedSTreeYaml\n", t, func() {
+		s, err := NewPositionedSTreeYaml(strings.NewReader(config))
+		So(err, ShouldBeNil)
+
+		cases := map[string]Pos{
+			".":                      {1, 1},
+			".defaults":              {1, 11},
+			".server.port":           {7, 9},
+			".server.host":           {6, 9},
+			".server.retries":        {3, 12},
+			".server.tags[1]":        {10, 7},
+			".server.tags[1].weight": {10, 28},
+			"/server/tags/0":         {9, 7},
+		}
+		for path, want := range cases {
+			pos, ok := s.Position(path)
+			So(ok, ShouldBeTrue)
+			So(pos, ShouldResemble, want)
+		}
+		_, ok := s.Position(".server.missing")
+		So(ok, ShouldBeFalse)
+
+		_, err = s.IntVal(".server.port")
+		pos, _ := s.Position(".server.port")
+		msg := fmt.Sprintf("config.yaml:%s: %v", pos, err)
+		So(msg, ShouldStartWith, "config.yaml:7:9: ")
+
+		k, err := NewPositionedSTreeYaml(strings.NewReader(config), WithYamlAliases(YamlAliasKeep))
+		So(err, ShouldBeNil)
+		pos, ok = k.Position(".server.<<")
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldResemble, Pos{5, 7})
+		pos, _ = k.Position(".server.<<.timeout")
+		So(pos, ShouldResemble, Pos{2, 12})
+		_, ok = k.Position(".server.timeout")
+		So(ok, ShouldBeFalse)
+
+		pos, ok = s.Positions.Position(".server.tags[1].weight")
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldResemble, Pos{10, 28})
+		_, ok = s.Positions.Position("/server/port")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Test positions of merged keys follow the alias mode\n", t, func() {
+		merges := `d: &d {a: 1, c: 5}
+e: &e {a: 3, f: 6}
+x: {a: 2, <<: *d}
+y: {<<: *d, a: 2}
+z: {<<: [*e, *d], b: 0}
+`
+		lines := strings.Split(merges, "\n")
+		for _, mode := range []YamlAliasMode{YamlAliasExpand, YamlAliasResolve} {
+			s, err := NewPositionedSTreeYaml(strings.NewReader(merges), WithYamlAliases(mode))
+			So(err, ShouldBeNil)
+			for _, f := range s.FieldPaths() {
+				pos, ok := s.Position(f.String())
+				So(ok, ShouldBeTrue)
+				token := lines[pos.Line-1][pos.Column-1:]
+				token = token[:strings.IndexAny(token, ",}")]
+				So(token, ShouldEqual, fmt.Sprint(s.ValMust(f.String())))
+			}
+		}
+
+		s, err := NewPositionedSTreeYaml(strings.NewReader(merges))
+		So(err, ShouldBeNil)
+		So(s.IntValMust(".x.a"), ShouldEqual, 1)
+		pos, _ := s.Position(".x.a")
+		So(pos, ShouldResemble, Pos{1, 11})
+		pos, _ = s.Position(".z.a")
+		So(pos, ShouldResemble, Pos{2, 11})
+
+		s, err = NewPositionedSTreeYaml(strings.NewReader(merges), WithYamlAliases(YamlAliasResolve))
+		So(err, ShouldBeNil)
+		So(s.IntValMust(".x.a"), ShouldEqual, 2)
+		pos, _ = s.Position(".x.a")
+		So(pos, ShouldResemble, Pos{3, 8})
+	})
+
+	Convey("Test NewPositionedSTreeJson\n", t, func() {
+		data := "{\n  \"name\": \"gostree\",\n  \"server\": {\"port\" : 8080, \"hosts\": [ \"a\",\"b\" ]},\n  \"ünï\": null\n}"
+		s, err := NewPositionedSTreeJson(strings.NewReader(data))
+		So(err, ShouldBeNil)
+
+		cases := map[string]Pos{
+			".":                {1, 1},
+			".name":            {2, 11},
+			".server":          {3, 13},
+			".server.port":     {3, 23},
+			".server.hosts[0]": {3, 40},
+			".server.hosts[1]": {3, 44},
+			".ünï":             {4, 10},
+		}
+		for path, want := range cases {
+			pos, ok := s.Position(path)
+			So(ok, ShouldBeTrue)
+			So(pos, ShouldResemble, want)
+		}
+
+		j5 := "// settings\n{\n  name: 'gostree', /* inline */ port: 0x1F90,\n  list: [1, 2,],\n}"
+		s, err = NewPositionedSTreeJson(strings.NewReader(j5), WithJson5(true))
+		So(err, ShouldBeNil)
+		pos, _ := s.Position(".port")
+		So(pos, ShouldResemble, Pos{3, 39})
+		pos, _ = s.Position(".list[1]")
+		So(pos, ShouldResemble, Pos{4, 13})
+	})
+
+	Convey("Test positions carried through SetVal and Delete\n", t, func() {
+		s, err := NewPositionedSTreeYaml(strings.NewReader(config))
+		So(err, ShouldBeNil)
+
+		u, err := s.SetVal(".server.port", 80)
+		So(err, ShouldBeNil)
+		_, ok := u.Position(".server.port")
+		So(ok, ShouldBeFalse)
+		pos, ok := u.Position(".server.host")
+		So(ok, ShouldBeTrue)
+		So(pos, ShouldResemble, Pos{6, 9})
+		pos, _ = s.Position(".server.port")
+		So(pos, ShouldResemble, Pos{7, 9})
+		So(u.IntValMust(".server.port"), ShouldEqual, 80)
+
+		u = u.SetValMust(".server.tags", []interface{}{"x"})
+		_, ok = u.Position(".server.tags[1].weight")
+		So(ok, ShouldBeFalse)
+		_, ok = u.Position(".server.tags")
+		So(ok, ShouldBeFalse)
+
+		d, err := s.Delete(".server.tags[0]")
+		So(err, ShouldBeNil)
+		pos, _ = d.Position(".server.tags[0].weight")
+		So(pos, ShouldResemble, Pos{10, 28})
+		_, ok = d.Position(".server.tags[1]")
+		So(ok, ShouldBeFalse)
+
+		d = d.DeleteMust(".server")
+		_, ok = d.Position(".server.host")
+		So(ok, ShouldBeFalse)
+		pos, _ = d.Position(".defaults.retries")
+		So(pos, ShouldResemble, Pos{3, 12})
+
+		_, err = s.Delete(".server.missing")
+		So(err, ShouldNotBeNil)
+	})
+}
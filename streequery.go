@@ -0,0 +1,380 @@
+package gostree
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Match is a single result of Query, holding the concrete path of a matched value
+// along with the value itself.
+type Match struct {
+	Path FieldPath
+	Val  interface{}
+}
+
+// QuerySyntaxError reports a malformed Query expression, identifying the 1-based
+// column of the offending character.
+type QuerySyntaxError struct {
+	Expr string
+	Col  int
+	Msg  string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at column %d of %q: %s", e.Col, e.Expr, e.Msg)
+}
+
+func (e *QuerySyntaxError) Unwrap() error {
+	return ErrInvalidPath
+}
+
+// Query returns every value of the STree matching expr, which extends the path syntax
+// accepted by Val with the following:
+//
+//	.*        any key of an STree
+//	.{42}     the non-string key 42, as in the paths accepted by Val
+//	[*]       any index of a slice
+//	[1:3]     the indices of a slice from 1 up to but excluding 3; either bound may be
+//	          omitted, and a negative bound counts back from the end of the slice
+//	..key     key at any depth, including the top level; may also be followed by *
+//	          or a subscript
+//	[?(expr)] the elements of a slice for which the filter expression expr holds
+//
+// A filter expression compares values relative to the element, written as @ followed
+// by a path such as @.name or @.tags[0], against each other or against literal
+// strings, numbers, true, false and null, using ==, !=, <, <=, > and >=. Values may
+// also be matched against a regular expression with =~ /regexp/. A lone @ path holds
+// if the value exists. Expressions may be combined with &&, || and !, and grouped
+// with parentheses, for example:
+//
+//	.users[?(@.active == true && @.name =~ /^a/)].email
+//
+// Ordering comparisons hold only between two numbers or two strings, and no
+// comparison holds if a value is missing.
+//
+// A subscript may also follow a lone ., e.g. .[0] as in jq, which is how the
+// elements of a Document with a slice root are addressed.
+//
+// A lone . matches the STree itself. Matches are returned in document order, with
+// the keys of each STree visited in sorted order, so results are deterministic.
+func (t STree) Query(expr string) ([]Match, error) {
+	return queryFrom(Match{Path: FieldPath{}, Val: t}, expr)
+}
+
+// queryFrom returns every value matching expr relative to the match root.
+func queryFrom(root Match, expr string) ([]Match, error) {
+
+	sels, err := parseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []Match{root}
+	for _, sel := range sels {
+		next := []Match{}
+		for _, m := range matches {
+			next = sel.selectFrom(m, next)
+		}
+		matches = next
+	}
+
+	return matches, nil
+}
+
+func (t STree) QueryMust(expr string) []Match {
+	m, err := t.Query(expr)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// querySelector selects zero or more values relative to a single match.
+type querySelector interface {
+	selectFrom(m Match, result []Match) []Match
+}
+
+// keySelector selects the value stored under key in an STree.
+type keySelector struct {
+	key interface{}
+}
+
+func (s keySelector) selectFrom(m Match, result []Match) []Match {
+	if t, ok := m.Val.(STree); ok {
+		if v, ok := t[s.key]; ok {
+			result = append(result, Match{Path: m.Path.append(keyComponent(s.key)), Val: v})
+		}
+	}
+	return result
+}
+
+// anyKeySelector selects every value of an STree.
+type anyKeySelector struct{}
+
+func (s anyKeySelector) selectFrom(m Match, result []Match) []Match {
+	if t, ok := m.Val.(STree); ok {
+		for _, k := range t.sortedKeys() {
+			result = append(result, Match{Path: m.Path.append(keyComponent(k)), Val: t[k]})
+		}
+	}
+	return result
+}
+
+// rangeSelector selects the elements of a slice with indices in [start,end), where
+// nil bounds denote the respective end of the slice and negative bounds count back
+// from the end of the slice.
+type rangeSelector struct {
+	start, end *int
+}
+
+func (s rangeSelector) selectFrom(m Match, result []Match) []Match {
+
+	a, ok := m.Val.([]interface{})
+	if !ok || len(m.Path) < 1 {
+		return result
+	}
+
+	start, end := 0, len(a)
+	if s.start != nil {
+		start = sliceBound(*s.start, len(a))
+	}
+	if s.end != nil {
+		end = sliceBound(*s.end, len(a))
+	}
+
+	for i := start; i < end; i++ {
+		result = append(result, Match{Path: indexPath(m.Path, i), Val: a[i]})
+	}
+	return result
+}
+
+// sliceBound returns the index b clamped to [0,n], counting back from n if b is negative.
+func sliceBound(b, n int) int {
+	if b < 0 {
+		b += n
+	}
+	if b < 0 {
+		return 0
+	} else if b > n {
+		return n
+	}
+	return b
+}
+
+// descentSelector applies sel to a match and to every value nested beneath it.
+type descentSelector struct {
+	sel querySelector
+}
+
+func (s descentSelector) selectFrom(m Match, result []Match) []Match {
+
+	result = s.sel.selectFrom(m, result)
+
+	switch v := m.Val.(type) {
+	case STree:
+		for _, k := range v.sortedKeys() {
+			result = s.selectFrom(Match{Path: m.Path.append(keyComponent(k)), Val: v[k]}, result)
+		}
+	case []interface{}:
+		if len(m.Path) > 0 {
+			for i, e := range v {
+				result = s.selectFrom(Match{Path: indexPath(m.Path, i), Val: e}, result)
+			}
+		}
+	}
+	return result
+}
+
+// queryParser is a recursive descent parser for Query expressions. depth counts the
+// filter expressions enclosing the current position.
+type queryParser struct {
+	expr  string
+	pos   int
+	depth int
+}
+
+func parseQuery(expr string) ([]querySelector, error) {
+
+	p := &queryParser{expr: expr}
+	if expr == "." {
+		return []querySelector{}, nil
+	}
+	if len(expr) < 1 {
+		return nil, p.errorf("empty expression")
+	}
+
+	sels := []querySelector{}
+	for !p.done() {
+		sel, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	return sels, nil
+}
+
+func (p *queryParser) done() bool {
+	return p.pos >= len(p.expr)
+}
+
+func (p *queryParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.expr[p.pos]
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return &QuerySyntaxError{Expr: p.expr, Col: p.pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseSelector parses a single .key, .*, ..selector or [subscript] from the
+// current position.
+func (p *queryParser) parseSelector() (querySelector, error) {
+
+	switch {
+	case strings.HasPrefix(p.expr[p.pos:], ".."):
+		p.pos += 2
+		if p.peek() == '[' {
+			sel, err := p.parseSubscript()
+			return descentSelector{sel}, err
+		}
+		sel, err := p.parseKey()
+		return descentSelector{sel}, err
+
+	case p.peek() == '.':
+		p.pos++
+		if p.peek() == '[' {
+			return p.parseSubscript()
+		}
+		return p.parseKey()
+
+	case p.peek() == '[':
+		return p.parseSubscript()
+
+	default:
+		return nil, p.errorf("expected '.' or '[', found '%c'", p.peek())
+	}
+}
+
+// parseKey parses a key name, braced scalar key or * following a '.', with \.
+// denoting a literal '.'.
+// Within a filter expression, a key also ends at whitespace, ')' or an operator.
+func (p *queryParser) parseKey() (querySelector, error) {
+
+	if p.peek() == '*' {
+		p.pos++
+		return anyKeySelector{}, nil
+	}
+
+	if p.peek() == '{' {
+		begin := p.pos
+		end := bracedEnd(p.expr[p.pos:])
+		if end < 0 {
+			return nil, p.errorf("expected '}'")
+		}
+		p.pos += end
+		key, err := keyOf(unescapeBraced(p.expr[begin:p.pos]))
+		if err != nil {
+			p.pos = begin
+			return nil, p.errorf("invalid key: %v", err)
+		}
+		return keySelector{key}, nil
+	}
+
+	var key bytes.Buffer
+	for !p.done() && p.peek() != '.' && p.peek() != '[' {
+		if p.depth > 0 && strings.IndexByte(" \t)=!<>&|", p.peek()) >= 0 {
+			break
+		}
+		if p.peek() == ']' {
+			return nil, p.errorf("unexpected ']'")
+		}
+		if strings.HasPrefix(p.expr[p.pos:], `\.`) {
+			p.pos++
+		}
+		key.WriteByte(p.peek())
+		p.pos++
+	}
+
+	if key.Len() < 1 {
+		return nil, p.errorf("expected key name or '*'")
+	}
+	return keySelector{key.String()}, nil
+}
+
+// parseSubscript parses a bracketed index, wildcard, range or filter.
+func (p *queryParser) parseSubscript() (querySelector, error) {
+
+	p.pos++ // consume '['
+
+	var sel querySelector
+	if p.peek() == '*' {
+		p.pos++
+		sel = rangeSelector{}
+
+	} else if p.peek() == '?' {
+		var err error
+		sel, err = p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+
+	} else {
+		start, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() == ':' {
+			p.pos++
+			end, err := p.parseInt()
+			if err != nil {
+				return nil, err
+			}
+			sel = rangeSelector{start: start, end: end}
+		} else if start == nil {
+			return nil, p.errorf("expected index, range or '*'")
+		} else if *start == -1 {
+			sel = rangeSelector{start: start}
+		} else {
+			sel = rangeSelector{start: start, end: intPtr(*start + 1)}
+		}
+	}
+
+	if p.peek() != ']' {
+		return nil, p.errorf("expected ']'")
+	}
+	p.pos++
+	return sel, nil
+}
+
+// parseInt parses an optionally signed integer at the current position, returning
+// nil if there is none.
+func (p *queryParser) parseInt() (*int, error) {
+
+	begin := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	if p.pos == begin {
+		return nil, nil
+	}
+
+	num := p.expr[begin:p.pos]
+	i, err := strconv.Atoi(num)
+	if err != nil {
+		p.pos = begin
+		return nil, p.errorf("invalid integer %q", num)
+	}
+	return &i, nil
+}
+
+func intPtr(i int) *int {
+	return &i
+}
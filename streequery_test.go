@@ -0,0 +1,233 @@
+package gostree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeQuery(t *testing.T) {
+
+	defer log.Flush()
+
+	yaml := `
+---
+services:
+- name: web
+  image: web:1.0
+  db:
+    password: s3cret
+- name: db
+  image: db:2.0
+- name: cache
+  image: cache:1.0
+matrix: [[1, 2, 3], [4, 5, 6]]
+password: toplevel
+dotted.key: 7
+`
+
+	paths := func(matches []Match) []string {
+		result := []string{}
+		for _, m := range matches {
+			result = append(result, m.Path.String())
+		}
+		return result
+	}
+
+	Convey("Test Query plain path\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(yaml))
+		So(err, ShouldBeNil)
+
+		m, err := s.Query(".services[1].image")
+		So(err, ShouldBeNil)
+		So(m, ShouldResemble, []Match{{Path: ValueOfPathMust(".services[1].image"), Val: "db:2.0"}})
+
+		m, err = s.Query(".matrix[1][2]")
+		So(err, ShouldBeNil)
+		So(m, ShouldResemble, []Match{{Path: ValueOfPathMust(".matrix[1][2]"), Val: 6}})
+
+		m, err = s.Query(`.dotted\.key`)
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{`.dotted\.key`})
+
+		m, err = s.Query(".services[5].image")
+		So(err, ShouldBeNil)
+		So(m, ShouldBeEmpty)
+
+		m, err = s.Query(".")
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 1)
+		So(m[0].Path, ShouldBeEmpty)
+	})
+
+	Convey("Test Query wildcards\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(yaml))
+		So(err, ShouldBeNil)
+
+		m, err := s.Query(".services[*].image")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".services[0].image", ".services[1].image", ".services[2].image"})
+		So(m[2].Val, ShouldEqual, "cache:1.0")
+
+		m, err = s.Query(".services[0].*")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".services[0].db", ".services[0].image", ".services[0].name"})
+
+		m, err = s.Query(".matrix[*][0]")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".matrix[0][0]", ".matrix[1][0]"})
+
+		m, err = s.Query(".*.name")
+		So(err, ShouldBeNil)
+		So(m, ShouldBeEmpty)
+	})
+
+	Convey("Test Query ranges\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(yaml))
+		So(err, ShouldBeNil)
+
+		m, err := s.Query(".services[1:3].name")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".services[1].name", ".services[2].name"})
+
+		m, err = s.Query(".matrix[0][:2]")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".matrix[0][0]", ".matrix[0][1]"})
+
+		m, err = s.Query(".matrix[0][1:]")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".matrix[0][1]", ".matrix[0][2]"})
+
+		m, err = s.Query(".matrix[0][-2:]")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".matrix[0][1]", ".matrix[0][2]"})
+
+		m, err = s.Query(".matrix[1][-1]")
+		So(err, ShouldBeNil)
+		So(m, ShouldResemble, []Match{{Path: ValueOfPathMust(".matrix[1][2]"), Val: 6}})
+
+		m, err = s.Query(".matrix[0][2:10]")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".matrix[0][2]"})
+	})
+
+	Convey("Test Query recursive descent\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(yaml))
+		So(err, ShouldBeNil)
+
+		m, err := s.Query("..password")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".password", ".services[0].db.password"})
+
+		m, err = s.Query(".services..name")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".services[0].name", ".services[1].name", ".services[2].name"})
+
+		m, err = s.Query("..[1]")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".matrix[1]", ".matrix[0][1]", ".matrix[1][1]", ".services[1]"})
+
+		m, err = s.Query(".services[0]..*")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{
+			".services[0].db", ".services[0].image", ".services[0].name", ".services[0].db.password"})
+
+		for _, match := range s.QueryMust("..*") {
+			v, err := s.Val(match.Path.String())
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, match.Val)
+		}
+	})
+
+	Convey("Test Query filters\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(yaml + `
+users:
+- name: alice
+  active: true
+  age: 31
+  tags: [admin, dev]
+- name: bob
+  active: false
+  age: 25.5
+- name: carol
+  active: true
+  tags: [dev]
+`))
+		So(err, ShouldBeNil)
+
+		names := func(expr string) []interface{} {
+			result := []interface{}{}
+			for _, m := range s.QueryMust(expr) {
+				result = append(result, m.Val)
+			}
+			return result
+		}
+
+		m, err := s.Query(".users[?(@.active == true)].name")
+		So(err, ShouldBeNil)
+		So(paths(m), ShouldResemble, []string{".users[0].name", ".users[2].name"})
+
+		So(names(".users[?(@.active != true)].name"), ShouldResemble, []interface{}{"bob"})
+		So(names(".users[?(@.age > 30)].name"), ShouldResemble, []interface{}{"alice"})
+		So(names(".users[?(@.age <= 25.5)].name"), ShouldResemble, []interface{}{"bob"})
+		So(names(".users[?(@.age)].name"), ShouldResemble, []interface{}{"alice", "bob"})
+		So(names(".users[?(!@.age)].name"), ShouldResemble, []interface{}{"carol"})
+		So(names(`.users[?(@.name =~ /^[ab]/)].name`), ShouldResemble, []interface{}{"alice", "bob"})
+		So(names(`.users[?(@.name == "carol" || @.age < 30)].name`), ShouldResemble, []interface{}{"bob", "carol"})
+		So(names(`.users[?(@.active == true && (@.name > 'b' || @.age == 31))].name`), ShouldResemble, []interface{}{"alice", "carol"})
+		So(names(".users[?(@.tags[*] == 'admin')].name"), ShouldResemble, []interface{}{"alice"})
+		So(names(".users[?(@.tags[?(@ == 'dev')])].name"), ShouldResemble, []interface{}{"alice", "carol"})
+		So(names(".users[?(@.age > 'a')].name"), ShouldBeEmpty)
+		So(names(".users[*].tags[?(@ =~ /^d/)]"), ShouldResemble, []interface{}{"dev", "dev"})
+		So(names(".services[?(@.db.password == 's3cret')].image"), ShouldResemble, []interface{}{"web:1.0"})
+		So(names(".matrix[?(@[0] >= 4)][1]"), ShouldResemble, []interface{}{5})
+		So(names(".users[?(@.manager == null)]"), ShouldBeEmpty)
+		So(names(".name[?(@)]"), ShouldBeEmpty)
+	})
+
+	Convey("Test Query syntax errors\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(yaml))
+		So(err, ShouldBeNil)
+
+		for expr, col := range map[string]int{
+			"":                            1,
+			"services":                    1,
+			".services[":                  11,
+			".services[x]":                11,
+			".services[1":                 12,
+			".services[1:x]":              13,
+			".services.":                  11,
+			".services]":                  10,
+			".services[-]":                11,
+			"..":                          3,
+			".users[?@.active]":           9,
+			".users[?(@.active == )]":     22,
+			".users[?(@.active == true]":  26,
+			".users[?(@.active true)]":    19,
+			".users[?(@.name == 'alice)]": 20,
+			".users[?(@.name =~ alice)]":  20,
+			".users[?(@.name =~ /(/)]":    20,
+			".users[?(@.age > 1e)]":       18,
+			".users[?((@.age > 1)]":       21,
+			".users[?(@.active)":          19,
+		} {
+			_, err = s.Query(expr)
+			So(errors.Is(err, ErrInvalidPath), ShouldBeTrue)
+			var qErr *QuerySyntaxError
+			So(errors.As(err, &qErr), ShouldBeTrue)
+			So(qErr.Col, ShouldEqual, col)
+		}
+
+		_, err = s.Query(".services[x]")
+		So(err.Error(), ShouldEqual, `query syntax error at column 11 of ".services[x]": expected index, range or '*'`)
+		So(func() { s.QueryMust(".services[") }, ShouldPanic)
+
+		_, err = s.Query(".users[?(@.name =~ /(/)]")
+		So(err.Error(), ShouldStartWith, `query syntax error at column 20 of ".users[?(@.name =~ /(/)]": invalid regular expression:`)
+	})
+}
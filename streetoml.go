@@ -0,0 +1,344 @@
+package gostree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// NewSTreeToml reads toml from the specified reader, parses it and returns
+// the structure as an STree. Tables become nested STrees and arrays, including
+// arrays of tables, become slices. Integers are stored as int, as they are by
+// NewSTreeYaml, and datetimes as time.Time. Local dates and datetimes, which have
+// no offset, are read in the time.Local location, as the toml package also reads
+// an offset datetime whose offset is that of time.Local.
+func NewSTreeToml(r io.Reader) (stree STree, err error) {
+
+	um := make(map[string]interface{})
+	_, err = toml.DecodeReader(r, &um)
+	if err != nil {
+		return nil, fmt.Errorf("NewSTreeToml error in toml.DecodeReader: %v", err)
+	}
+
+	return convertTomlVal(um).(STree), nil
+}
+
+// WriteToml marshals the STree as toml. Nested STrees are written as tables,
+// and slices of STrees as arrays of tables, laid out as by the toml package with
+// keys sorted. Since toml has no null value, keys holding nil are omitted, and an
+// error is returned for slices holding nil or values of differing kinds. A
+// time.Time is written as an offset datetime, or as a local date or datetime if
+// it is in the time.Local location.
+func (s STree) WriteToml() ([]byte, error) {
+
+	iMap, err := s.unconvertKeys()
+	if err != nil {
+		return nil, fmt.Errorf("WriteToml error in unconvertKeys: %v", err)
+	}
+
+	// the toml encoder writes every time.Time in UTC, so the document is written
+	// here instead
+	w := &tomlWriter{}
+	if err = w.table(nil, iMap); err != nil {
+		return nil, fmt.Errorf("WriteToml %v", err)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// tomlWriter writes the values returned by unconvertKeys as a toml document.
+type tomlWriter struct {
+	buf bytes.Buffer
+}
+
+// table writes the keys of m, found at key, those holding primitives and arrays
+// first and then those holding tables and arrays of tables.
+func (w *tomlWriter) table(key []string, m map[string]interface{}) error {
+
+	direct, sub := []string{}, []string{}
+	for k, v := range m {
+		if v == nil {
+			continue
+		}
+		typ, err := tomlTypeOf(v)
+		if err != nil {
+			return fmt.Errorf("error at key %s: %v", tomlKey(append(key, k)), err)
+		}
+		if typ == tomlTable || typ == tomlTableArray {
+			sub = append(sub, k)
+		} else {
+			direct = append(direct, k)
+		}
+	}
+	sort.Strings(direct)
+	sort.Strings(sub)
+
+	for _, k := range append(direct, sub...) {
+		if err := w.keyVal(append(key[:len(key):len(key)], k), m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyVal writes the value v of key, as a table or array of tables if it is one.
+func (w *tomlWriter) keyVal(key []string, v interface{}) error {
+
+	if key[len(key)-1] == "" {
+		return fmt.Errorf("found an empty key in %s", tomlKey(key))
+	}
+	indent := strings.Repeat("  ", len(key)-1)
+
+	if m, ok := v.(map[string]interface{}); ok {
+		if len(key) == 1 {
+			w.newline()
+		}
+		fmt.Fprintf(&w.buf, "%s[%s]\n", indent, tomlKey(key))
+		return w.table(key, m)
+	}
+
+	if typ, _ := tomlTypeOf(v); typ == tomlTableArray {
+		for _, e := range v.([]interface{}) {
+			w.newline()
+			fmt.Fprintf(&w.buf, "%s[[%s]]\n", indent, tomlKey(key))
+			if err := w.table(key, e.(map[string]interface{})); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fmt.Fprintf(&w.buf, "%s%s = ", indent, tomlKey(key[len(key)-1:]))
+	if err := w.value(v); err != nil {
+		return fmt.Errorf("error at key %s: %v", tomlKey(key), err)
+	}
+	w.buf.WriteByte('\n')
+	return nil
+}
+
+// newline separates a table from anything written before it.
+func (w *tomlWriter) newline() {
+	if w.buf.Len() > 0 {
+		w.buf.WriteByte('\n')
+	}
+}
+
+// value writes the primitive or array v inline.
+func (w *tomlWriter) value(v interface{}) error {
+
+	if t, ok := v.(time.Time); ok {
+		w.buf.WriteString(tomlDatetime(t))
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		w.buf.WriteString(strconv.FormatBool(rv.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.buf.WriteString(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		w.buf.WriteString(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		w.buf.WriteString(tomlFloat(rv.Float(), rv.Type().Bits()))
+	case reflect.String:
+		w.buf.WriteString(tomlQuote(rv.String()))
+	case reflect.Slice, reflect.Array:
+		w.buf.WriteByte('[')
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				w.buf.WriteString(", ")
+			}
+			if err := w.value(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteByte(']')
+	default:
+		return fmt.Errorf("found unsupported type %T", v)
+	}
+	return nil
+}
+
+// tomlType classifies values by the toml types which may not be mixed within an
+// array.
+type tomlType int
+
+const (
+	tomlPrimitiveBool tomlType = iota
+	tomlPrimitiveInteger
+	tomlPrimitiveFloat
+	tomlPrimitiveString
+	tomlPrimitiveDatetime
+	tomlArray
+	tomlTable
+	tomlTableArray
+)
+
+// tomlTypeOf returns the toml type of v, a value other than nil returned by
+// unconvertKeys, or an error if v is an array which cannot be written as toml.
+func tomlTypeOf(v interface{}) (tomlType, error) {
+
+	switch v.(type) {
+	case time.Time:
+		return tomlPrimitiveDatetime, nil
+	case map[string]interface{}:
+		return tomlTable, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return tomlPrimitiveBool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return tomlPrimitiveInteger, nil
+	case reflect.Float32, reflect.Float64:
+		return tomlPrimitiveFloat, nil
+	case reflect.String:
+		return tomlPrimitiveString, nil
+	case reflect.Slice, reflect.Array:
+	default:
+		return 0, fmt.Errorf("found unsupported type %T", v)
+	}
+
+	if rv.Len() < 1 {
+		return tomlArray, nil
+	}
+	var first tomlType
+	for i := 0; i < rv.Len(); i++ {
+		e := rv.Index(i).Interface()
+		if e == nil {
+			return 0, fmt.Errorf("cannot write an array holding nil")
+		}
+		typ, err := tomlTypeOf(e)
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 {
+			first = typ
+		} else if typ != first {
+			return 0, fmt.Errorf("cannot write an array holding values of differing types")
+		}
+		if typ == tomlTableArray {
+			return 0, fmt.Errorf("cannot write a nested array holding tables")
+		}
+	}
+	if first == tomlTable {
+		return tomlTableArray, nil
+	}
+	return tomlArray, nil
+}
+
+// tomlKey returns the dotted toml key of the components of key, each quoted
+// unless it is a bare key.
+func tomlKey(key []string) string {
+	parts := make([]string, len(key))
+	for i, k := range key {
+		parts[i] = k
+		for _, c := range k {
+			if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+				parts[i] = tomlQuote(k)
+				break
+			}
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// tomlQuote returns s as a toml basic string.
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, c)
+			} else {
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlFloat returns f written as a toml float of the specified bit size, which
+// always has a fractional part or exponent.
+func tomlFloat(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	str := strconv.FormatFloat(f, 'f', -1, bits)
+	if !strings.Contains(str, ".") {
+		str += ".0"
+	}
+	return str
+}
+
+// tomlDatetime returns t written as a toml datetime.
+func tomlDatetime(t time.Time) string {
+	if t.Location() != time.Local {
+		return t.Format(time.RFC3339Nano)
+	} else if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02T15:04:05.999999999")
+}
+
+// convertTomlVal returns v, as decoded by the toml package, converted to uphold
+// the invariants of an STree structure.
+func convertTomlVal(v interface{}) interface{} {
+
+	switch tv := v.(type) {
+
+	case map[string]interface{}:
+		result := STree{}
+		for k, kv := range tv {
+			result[k] = convertTomlVal(kv)
+		}
+		return result
+
+	case []map[string]interface{}:
+		result := make([]interface{}, len(tv))
+		for i, e := range tv {
+			result[i] = convertTomlVal(e)
+		}
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(tv))
+		for i, e := range tv {
+			result[i] = convertTomlVal(e)
+		}
+		return result
+
+	case int64:
+		return int(tv)
+
+	default:
+		return v
+	}
+}
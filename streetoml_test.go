@@ -0,0 +1,200 @@
+package gostree
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeToml(t *testing.T) {
+
+	defer log.Flush()
+
+	tomlData := `
+title = "TOML Example"
+released = 1979-05-27T07:32:00Z
+
+[owner]
+name = "Tom"
+dotted = { "a.b" = true }
+
+[database]
+server = "192.168.1.1"
+ports = [ 8001, 8001, 8002 ]
+connection_max = 5000
+ratio = 0.75
+data = [ ["gamma", "delta"], [1, 2] ]
+
+[[products]]
+name = "Hammer"
+sku = 738594937
+
+[[products]]
+name = "Nail"
+sku = 284758393
+color = "gray"
+`
+
+	Convey("Test NewSTreeToml\n", t, func() {
+		s, err := NewSTreeToml(strings.NewReader(tomlData))
+		So(err, ShouldBeNil)
+
+		So(s.StrValMust(".title"), ShouldEqual, "TOML Example")
+		So(s.ValMust(".released"), ShouldResemble, time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC))
+		So(s.BoolValMust(`.owner.dotted.a\.b`), ShouldBeTrue)
+		So(s.IntValMust(".database.ports[2]"), ShouldEqual, 8002)
+		So(s.ValMust(".database.connection_max"), ShouldEqual, 5000)
+		So(s.FloatValMust(".database.ratio"), ShouldEqual, 0.75)
+		So(s.StrValMust(".database.data[0][1]"), ShouldEqual, "delta")
+		So(s.IntValMust(".database.data[1][0]"), ShouldEqual, 1)
+		So(s.StrValMust(".products[1].color"), ShouldEqual, "gray")
+		So(s.SliceValMust(".products"), ShouldHaveLength, 2)
+
+		paths := []string{}
+		err = s.Visit(NewVisitorBuilder().
+			WithPrimitiveVisitor(func(key string, val interface{}) error {
+				paths = append(paths, key)
+				return nil
+			}).
+			Visitor())
+		So(err, ShouldBeNil)
+		So(paths, ShouldContain, ".products[0].sku")
+		So(paths, ShouldContain, ".database.data[0][0]")
+
+		_, err = NewSTreeToml(strings.NewReader(`key = `))
+		So(err, ShouldNotBeNil)
+		_, err = NewSTreeToml(strings.NewReader("[a]\nb = 1\n[a]\nc = 2\n"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test WriteToml round trip\n", t, func() {
+		s, err := NewSTreeToml(strings.NewReader(tomlData))
+		So(err, ShouldBeNil)
+
+		out, err := s.WriteToml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldContainSubstring, "[[products]]")
+
+		r, err := NewSTreeToml(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, s)
+	})
+
+	Convey("Test WriteToml datetimes round trip\n", t, func() {
+		defer func(l *time.Location) { time.Local = l }(time.Local)
+		time.Local = time.FixedZone("Test", 3600)
+
+		data := `odt1 = 1979-05-27T07:32:00Z
+odt2 = 1979-05-27T00:32:00-07:00
+ldt = 1979-05-27T07:32:00
+ld = 1979-05-27
+dates = [1979-05-27, 2024-02-29]
+`
+		s, err := NewSTreeToml(strings.NewReader(data))
+		So(err, ShouldBeNil)
+		So(s.ValMust(".odt2"), ShouldHaveSameTypeAs, time.Time{})
+		So(s.ValMust(".odt2").(time.Time).Equal(s.ValMust(".odt1").(time.Time)), ShouldBeTrue)
+		So(s.ValMust(".ld"), ShouldResemble, time.Date(1979, 5, 27, 0, 0, 0, 0, time.Local))
+
+		out, err := s.WriteToml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `dates = [1979-05-27, 2024-02-29]
+ld = 1979-05-27
+ldt = 1979-05-27T07:32:00
+odt1 = 1979-05-27T07:32:00Z
+odt2 = 1979-05-27T00:32:00-07:00
+`)
+
+		r, err := NewSTreeToml(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(DiffMust(s, r), ShouldBeEmpty)
+		So(r.ValMust(".odt2").(time.Time).Format(time.RFC3339), ShouldEqual, "1979-05-27T00:32:00-07:00")
+		So(r.ValMust(".dates[1]").(time.Time).Location(), ShouldEqual, time.Local)
+
+		odt := time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)
+		s = STree{"a": "gostree-toml-datetime-0", "t": odt, "q": "say \"hi\"\t\\", "k y": 1.5}
+		out, err = s.WriteToml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `a = "gostree-toml-datetime-0"
+"k y" = 1.5
+q = "say \"hi\"\t\\"
+t = 1979-05-27T07:32:00Z
+`)
+		r, err = NewSTreeToml(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, s)
+	})
+
+	Convey("Test format conversion\n", t, func() {
+		s, err := NewSTreeToml(strings.NewReader(tomlData))
+		So(err, ShouldBeNil)
+
+		y, err := s.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(y), ShouldContainSubstring, "released: 1979-05-27T07:32:00Z\n")
+
+		// yaml and json hold datetimes as strings
+		s = s.SetValMust(".released", "1979-05-27T07:32:00Z")
+		fromYaml, err := NewSTreeYaml(bytes.NewReader(y))
+		So(err, ShouldBeNil)
+		So(fromYaml, ShouldResemble, s)
+
+		comp, err := s.CompareTo(fromYaml)
+		So(err, ShouldBeNil)
+		for _, c := range comp {
+			So(c, ShouldEqual, COMP_NO_DIFFERENCE)
+		}
+
+		j, err := s.WriteJson(false)
+		So(err, ShouldBeNil)
+		fromJson, err := NewSTreeJson(bytes.NewReader(j), WithJsonNumbers(JsonNumberExact))
+		So(err, ShouldBeNil)
+		So(DiffMust(s, fromJson), ShouldBeEmpty)
+
+		out, err := fromJson.WriteToml()
+		So(err, ShouldBeNil)
+		fromToml, err := NewSTreeToml(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(DiffMust(fromToml, fromJson), ShouldBeEmpty)
+		So(DiffMust(s, fromToml), ShouldBeEmpty)
+
+		y = []byte(`
+---
+key1: val1
+key2:
+  key3: [1, 2]
+  key4: null
+key5:
+- key6: true
+`)
+		fromYaml, err = NewSTreeYaml(bytes.NewReader(y))
+		So(err, ShouldBeNil)
+		out, err = fromYaml.WriteToml()
+		So(err, ShouldBeNil)
+		fromToml, err = NewSTreeToml(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(fromToml, ShouldResemble, STree{
+			"key1": "val1",
+			"key2": STree{"key3": []interface{}{1, 2}},
+			"key5": []interface{}{STree{"key6": true}},
+		})
+	})
+
+	Convey("Test WriteToml errors\n", t, func() {
+		_, err := STree{"key1": []interface{}{1, "two"}}.WriteToml()
+		So(err, ShouldNotBeNil)
+		_, err = STree{"key1": []interface{}{nil}}.WriteToml()
+		So(err, ShouldNotBeNil)
+		out, err := STree{1: "one"}.WriteToml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "1 = \"one\"\n")
+		_, err = STree{1: "one", "1": "two"}.WriteToml()
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,272 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XmlOption configures the conventions used to map XML documents to STrees.
+type XmlOption func(*xmlCodec)
+
+// WithXmlAttrPrefix sets the prefix distinguishing the keys of attributes from
+// those of child elements, "@" by default.
+func WithXmlAttrPrefix(prefix string) XmlOption {
+	return func(c *xmlCodec) { c.attrPrefix = prefix }
+}
+
+// WithXmlTextKey sets the key under which the text content of an element having
+// attributes or child elements is stored, "#text" by default.
+func WithXmlTextKey(key string) XmlOption {
+	return func(c *xmlCodec) { c.textKey = key }
+}
+
+// WithXmlNamespaces sets whether namespace prefixes are kept in element and
+// attribute names, e.g. as "atom:link", along with the xmlns attributes declaring
+// them. By default prefixes and xmlns attributes are dropped.
+func WithXmlNamespaces(keep bool) XmlOption {
+	return func(c *xmlCodec) { c.keepNamespaces = keep }
+}
+
+// WithXmlSliceElements names elements which are always collected into slices, even
+// when they occur only once, so that the shape of the STree does not depend on the
+// number of repetitions in a particular document.
+func WithXmlSliceElements(names ...string) XmlOption {
+	return func(c *xmlCodec) {
+		for _, n := range names {
+			c.sliceElements[n] = true
+		}
+	}
+}
+
+type xmlCodec struct {
+	attrPrefix     string
+	textKey        string
+	keepNamespaces bool
+	sliceElements  map[string]bool
+}
+
+func newXmlCodec(opts []XmlOption) *xmlCodec {
+	c := &xmlCodec{attrPrefix: "@", textKey: "#text", sliceElements: map[string]bool{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// xmlFrame holds the state of an element being read.
+type xmlFrame struct {
+	name string
+	tree STree
+	text bytes.Buffer
+}
+
+// NewSTreeXml reads XML from the specified reader, parses it and returns the
+// structure as an STree holding a single key, the name of the root element.
+//
+// An element having neither attributes nor child elements is stored as its text
+// content, with surrounding whitespace removed. Any other element is stored as an
+// STree holding its attributes under "@name" keys, its child elements under their
+// names and any text content under "#text". Child elements sharing a name are
+// collected into a slice in document order. Comments and processing instructions
+// are ignored. All values are strings.
+func NewSTreeXml(r io.Reader, opts ...XmlOption) (STree, error) {
+
+	c := newXmlCodec(opts)
+	d := xml.NewDecoder(r)
+
+	root := &xmlFrame{tree: STree{}}
+	stack := []*xmlFrame{root}
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("NewSTreeXml error in RawToken: %v", err)
+		}
+
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+
+		case xml.StartElement:
+			if top == root && len(root.tree) > 0 {
+				return nil, fmt.Errorf("NewSTreeXml found multiple root elements")
+			}
+			f := &xmlFrame{name: c.name(t.Name), tree: STree{}}
+			for _, a := range t.Attr {
+				if !c.keepNamespaces && (a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns")) {
+					continue
+				}
+				f.tree[c.attrPrefix+c.name(a.Name)] = a.Value
+			}
+			stack = append(stack, f)
+
+		case xml.EndElement:
+			if top == root || c.name(t.Name) != top.name {
+				return nil, fmt.Errorf("NewSTreeXml found unexpected end element </%s>", c.name(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+			c.addChild(stack[len(stack)-1].tree, top.name, top.value(c))
+
+		case xml.CharData:
+			top.text.Write(t)
+		}
+	}
+
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("NewSTreeXml found unclosed element <%s>", stack[len(stack)-1].name)
+	}
+	if len(root.tree) < 1 {
+		return nil, fmt.Errorf("NewSTreeXml found no root element")
+	}
+	return root.tree, nil
+}
+
+func (c *xmlCodec) name(n xml.Name) string {
+	if c.keepNamespaces && len(n.Space) > 0 {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+// value returns the STree value of the element held by f.
+func (f *xmlFrame) value(c *xmlCodec) interface{} {
+	text := strings.TrimSpace(f.text.String())
+	if len(f.tree) < 1 {
+		return text
+	}
+	if len(text) > 0 {
+		f.tree[c.textKey] = text
+	}
+	return f.tree
+}
+
+// addChild stores the value of a child element named name in t, collecting the
+// values of repeated elements into a slice.
+func (c *xmlCodec) addChild(t STree, name string, val interface{}) {
+	if existing, ok := t[name]; ok {
+		if s, isSlice := existing.([]interface{}); isSlice {
+			t[name] = append(s, val)
+		} else {
+			t[name] = []interface{}{existing, val}
+		}
+	} else if c.sliceElements[name] {
+		t[name] = []interface{}{val}
+	} else {
+		t[name] = val
+	}
+}
+
+// WriteXml marshals the STree as an XML document, following the conventions of
+// NewSTreeXml. The STree must hold a single key, naming the root element. Slices
+// are written as repeated elements, nil values as empty elements, and primitives
+// as text content.
+func (s STree) WriteXml(indent bool, opts ...XmlOption) ([]byte, error) {
+
+	c := newXmlCodec(opts)
+	if len(s) != 1 {
+		return nil, fmt.Errorf("WriteXml requires a single root element, found %d keys", len(s))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	e := xml.NewEncoder(&buf)
+	if indent {
+		e.Indent("", "  ")
+	}
+
+	for k, v := range s {
+		name, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("WriteXml failed to convert key: %v", k)
+		}
+		if _, isSlice := v.([]interface{}); isSlice {
+			return nil, fmt.Errorf("WriteXml requires a single root element, found slice %s", name)
+		}
+		if err := c.writeElement(e, FieldPath{name}, name, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := e.Flush(); err != nil {
+		return nil, fmt.Errorf("WriteXml error in Flush: %v", err)
+	}
+	if indent {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *xmlCodec) writeElement(e *xml.Encoder, path FieldPath, name string, v interface{}) error {
+
+	if (len(c.attrPrefix) > 0 && strings.HasPrefix(name, c.attrPrefix)) || name == c.textKey {
+		return fmt.Errorf("WriteXml invalid element name at %s", path)
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	var text string
+	var children []string
+
+	switch tv := v.(type) {
+
+	case STree:
+		for _, k := range tv.sortedKeys() {
+			kStr, ok := k.(string)
+			if !ok {
+				return fmt.Errorf("WriteXml failed to convert key %v at %s", k, path)
+			}
+			switch {
+			case kStr == c.textKey:
+				text = fmt.Sprintf("%v", tv[k])
+			case len(c.attrPrefix) > 0 && strings.HasPrefix(kStr, c.attrPrefix):
+				if !IsPrimitive(tv[k]) && tv[k] != nil {
+					return fmt.Errorf("WriteXml attribute %s at %s is not a primitive", kStr, path)
+				}
+				val := ""
+				if tv[k] != nil {
+					val = fmt.Sprintf("%v", tv[k])
+				}
+				start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: kStr[len(c.attrPrefix):]}, Value: val})
+			default:
+				children = append(children, kStr)
+			}
+		}
+
+	case []interface{}:
+		return fmt.Errorf("WriteXml found nested slice at %s", path)
+
+	case nil:
+
+	default:
+		text = fmt.Sprintf("%v", tv)
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return fmt.Errorf("WriteXml error in EncodeToken at %s: %v", path, err)
+	}
+	if len(text) > 0 {
+		if err := e.EncodeToken(xml.CharData(text)); err != nil {
+			return fmt.Errorf("WriteXml error in EncodeToken at %s: %v", path, err)
+		}
+	}
+
+	for _, k := range children {
+		cv := v.(STree)[k]
+		if cs, ok := cv.([]interface{}); ok {
+			for i, ce := range cs {
+				if err := c.writeElement(e, indexPath(path.append(k), i), k, ce); err != nil {
+					return err
+				}
+			}
+		} else if err := c.writeElement(e, path.append(k), k, cv); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeToken(start.End()); err != nil {
+		return fmt.Errorf("WriteXml error in EncodeToken at %s: %v", path, err)
+	}
+	return nil
+}
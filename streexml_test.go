@@ -0,0 +1,146 @@
+package gostree
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeXml(t *testing.T) {
+
+	defer log.Flush()
+
+	xmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- vendor feed -->
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" version="2">
+  <title>Example Feed</title>
+  <entry id="1">
+    <title>First</title>
+    <media:thumbnail url="http://example.com/1.png"/>
+    <tag>a</tag>
+    <tag>b</tag>
+  </entry>
+  <entry id="2">
+    <title>Second &amp; last</title>
+    <summary type="text">  Short   summary </summary>
+    <tag>c</tag>
+  </entry>
+  <empty/>
+</feed>
+`
+
+	Convey("Test NewSTreeXml\n", t, func() {
+		s, err := NewSTreeXml(strings.NewReader(xmlData))
+		So(err, ShouldBeNil)
+
+		So(s.Keys(), ShouldResemble, []interface{}{"feed"})
+		So(s.StrValMust(".feed.@version"), ShouldEqual, "2")
+		So(s.StrValMust(".feed.title"), ShouldEqual, "Example Feed")
+		So(s.SliceValMust(".feed.entry"), ShouldHaveLength, 2)
+		So(s.StrValMust(".feed.entry[0].@id"), ShouldEqual, "1")
+		So(s.SliceValMust(".feed.entry[0].tag"), ShouldResemble, []interface{}{"a", "b"})
+		So(s.StrValMust(".feed.entry[0].thumbnail.@url"), ShouldEqual, "http://example.com/1.png")
+		So(s.StrValMust(".feed.entry[1].title"), ShouldEqual, "Second & last")
+		So(s.StrValMust(".feed.entry[1].summary.#text"), ShouldEqual, "Short   summary")
+		So(s.StrValMust(".feed.entry[1].tag"), ShouldEqual, "c")
+		So(s.StrValMust(".feed.empty"), ShouldEqual, "")
+		_, err = s.Val(".feed.@xmlns")
+		So(err, ShouldNotBeNil)
+
+		m, err := s.Query(".feed.entry[?(@.@id == '2')].title")
+		So(err, ShouldBeNil)
+		So(m[0].Val, ShouldEqual, "Second & last")
+	})
+
+	Convey("Test NewSTreeXml options\n", t, func() {
+		s, err := NewSTreeXml(strings.NewReader(xmlData),
+			WithXmlNamespaces(true),
+			WithXmlAttrPrefix("-"),
+			WithXmlTextKey("_"),
+			WithXmlSliceElements("tag"))
+		So(err, ShouldBeNil)
+
+		So(s.StrValMust(".feed.-xmlns"), ShouldEqual, "http://www.w3.org/2005/Atom")
+		So(s.StrValMust(".feed.-xmlns:media"), ShouldEqual, "http://search.yahoo.com/mrss/")
+		So(s.StrValMust(".feed.entry[0].media:thumbnail.-url"), ShouldEqual, "http://example.com/1.png")
+		So(s.StrValMust(".feed.entry[1].summary._"), ShouldEqual, "Short   summary")
+		So(s.SliceValMust(".feed.entry[1].tag"), ShouldResemble, []interface{}{"c"})
+	})
+
+	Convey("Test WriteXml round trip\n", t, func() {
+		for _, opts := range [][]XmlOption{{}, {WithXmlNamespaces(true), WithXmlSliceElements("tag")}} {
+			s, err := NewSTreeXml(strings.NewReader(xmlData), opts...)
+			So(err, ShouldBeNil)
+
+			for _, indent := range []bool{false, true} {
+				out, err := s.WriteXml(indent, opts...)
+				So(err, ShouldBeNil)
+				So(string(out), ShouldStartWith, `<?xml version="1.0" encoding="UTF-8"?>`)
+
+				r, err := NewSTreeXml(bytes.NewReader(out), opts...)
+				So(err, ShouldBeNil)
+				So(r, ShouldResemble, s)
+			}
+		}
+
+		out, err := STree{"root": STree{"@a": 1, "#text": "x < y", "b": []interface{}{1, nil}}}.WriteXml(false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<root a="1">x &lt; y<b>1</b><b></b></root>`)
+	})
+
+	Convey("Test format conversion\n", t, func() {
+		s, err := NewSTreeYaml(strings.NewReader(`
+---
+catalog:
+  "@version": "1"
+  book:
+  - title: Go
+    author: [A, B]
+  - title: XML
+`))
+		So(err, ShouldBeNil)
+
+		out, err := s.WriteXml(false)
+		So(err, ShouldBeNil)
+		x, err := NewSTreeXml(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(x, ShouldResemble, s)
+
+		j, err := x.WriteJson(false)
+		So(err, ShouldBeNil)
+		So(string(j), ShouldEqual, `{"catalog":{"@version":"1","book":[{"author":["A","B"],"title":"Go"},{"title":"XML"}]}}`)
+
+		g, err := x.GoStruct("Catalog")
+		So(err, ShouldBeNil)
+		So(g, ShouldNotBeNil)
+	})
+
+	Convey("Test XML errors\n", t, func() {
+		for _, doc := range []string{
+			``,
+			`<a><b></a>`,
+			`<a>`,
+			`<a></a><b></b>`,
+			`<a attr=1></a>`,
+		} {
+			_, err := NewSTreeXml(strings.NewReader(doc))
+			So(err, ShouldNotBeNil)
+		}
+
+		for _, s := range []STree{
+			{},
+			{"a": 1, "b": 2},
+			{"a": []interface{}{1, 2}},
+			{"a": STree{"b": []interface{}{[]interface{}{1}}}},
+			{"a": STree{"@b": STree{}}},
+		} {
+			_, err := s.WriteXml(false)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
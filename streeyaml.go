@@ -0,0 +1,142 @@
+package gostree
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// YamlDecoder reads a stream of yaml documents separated by --- markers, such as
+// a file of Kubernetes manifests, returning one STree per document. The stream is
+// read incrementally, so only a single document is held in memory at a time.
+type YamlDecoder struct {
+	r       *bufio.Reader
+	line    int    // the number of lines read so far
+	pending string // a document start marker read ahead of its document
+	doc     int    // the number of documents read so far
+	done    bool
+}
+
+// NewYamlDecoder returns a YamlDecoder reading from the specified reader.
+func NewYamlDecoder(r io.Reader) *YamlDecoder {
+	return &YamlDecoder{r: bufio.NewReader(r)}
+}
+
+// Next returns the next document in the stream, or io.EOF once the stream is
+// exhausted. Empty and null documents are skipped, and documents which are not
+// mappings yield an error.
+func (d *YamlDecoder) Next() (STree, error) {
+
+	for {
+		chunk, start, err := d.nextChunk()
+		if err != nil {
+			return nil, err
+		}
+		d.doc++
+
+		var t STree
+		err = yaml.Unmarshal(chunk, &t)
+		if err != nil {
+			return nil, fmt.Errorf("YamlDecoder error in yaml.Unmarshal of document %d at line %d: %v", d.doc, start, err)
+		}
+		if t != nil {
+			return t, nil
+		}
+	}
+}
+
+// nextChunk returns the text of the next document in the stream along with the
+// number of the line on which it starts.
+func (d *YamlDecoder) nextChunk() ([]byte, int, error) {
+
+	if d.done {
+		return nil, 0, io.EOF
+	}
+
+	var buf bytes.Buffer
+	start := d.line + 1
+	started, hasContent := false, false
+	if len(d.pending) > 0 {
+		buf.WriteString(d.pending)
+		start, started, d.pending = d.line, true, ""
+	}
+
+	for {
+		line, err := d.r.ReadString('\n')
+		if len(line) > 0 {
+			d.line++
+
+			if isYamlMarker(line, "---") && (started || hasContent) {
+				d.pending = line
+				return buf.Bytes(), start, nil
+			}
+
+			buf.WriteString(line)
+			if isYamlMarker(line, "---") {
+				started = true
+			} else if isYamlMarker(line, "...") {
+				return buf.Bytes(), start, nil
+			} else if trimmed := strings.TrimSpace(line); len(trimmed) > 0 && trimmed[0] != '#' && trimmed[0] != '%' {
+				hasContent = true
+			}
+		}
+
+		if err == io.EOF {
+			d.done = true
+			if started || hasContent {
+				return buf.Bytes(), start, nil
+			}
+			return nil, 0, io.EOF
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("YamlDecoder error reading bytes: %v", err)
+		}
+	}
+}
+
+// isYamlMarker returns true if line begins with the document marker, i.e. --- or
+// ..., followed by whitespace or the end of the line. The yaml spec forbids such
+// lines within scalar content, so they always delimit documents.
+func isYamlMarker(line, marker string) bool {
+	if !strings.HasPrefix(line, marker) {
+		return false
+	}
+	rest := line[len(marker):]
+	return len(rest) < 1 || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r'
+}
+
+// NewSTreesYaml reads a stream of yaml documents from the specified reader and
+// returns one STree per document, as read by YamlDecoder.
+func NewSTreesYaml(r io.Reader) ([]STree, error) {
+
+	result := []STree{}
+	d := NewYamlDecoder(r)
+	for {
+		t, err := d.Next()
+		if err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+}
+
+// WriteYamlStream marshals each of the STrees as a yaml document, preceded by a
+// --- marker.
+func WriteYamlStream(trees []STree) ([]byte, error) {
+
+	var buf bytes.Buffer
+	for i, t := range trees {
+		out, err := t.WriteYaml()
+		if err != nil {
+			return nil, fmt.Errorf("WriteYamlStream error marshaling document %d: %v", i+1, err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
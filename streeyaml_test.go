@@ -0,0 +1,105 @@
+package gostree
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestSTreeYamlStream(t *testing.T) {
+
+	defer log.Flush()
+
+	manifests := `# leading comment
+%YAML 1.1
+---
+kind: ConfigMap
+data:
+  script: |
+    echo start
+    --- not a marker, indented
+    echo done
+---
+# empty document
+---
+kind: Service
+spec: {ports: [80, 443]}
+...
+kind: Deployment
+--- {kind: Secret}
+---
+`
+
+	Convey("Test NewSTreesYaml\n", t, func() {
+		trees, err := NewSTreesYaml(strings.NewReader(manifests))
+		So(err, ShouldBeNil)
+		So(trees, ShouldHaveLength, 4)
+		So(trees[0].StrValMust(".kind"), ShouldEqual, "ConfigMap")
+		So(trees[0].StrValMust(".data.script"), ShouldEqual, "echo start\n--- not a marker, indented\necho done\n")
+		So(trees[1].IntValMust(".spec.ports[1]"), ShouldEqual, 443)
+		So(trees[2], ShouldResemble, STree{"kind": "Deployment"})
+		So(trees[3], ShouldResemble, STree{"kind": "Secret"})
+
+		trees, err = NewSTreesYaml(strings.NewReader("key1: val1\n"))
+		So(err, ShouldBeNil)
+		So(trees, ShouldResemble, []STree{{"key1": "val1"}})
+
+		trees, err = NewSTreesYaml(strings.NewReader(""))
+		So(err, ShouldBeNil)
+		So(trees, ShouldBeEmpty)
+	})
+
+	Convey("Test YamlDecoder\n", t, func() {
+		d := NewYamlDecoder(strings.NewReader(manifests))
+		kinds := []string{}
+		for {
+			s, err := d.Next()
+			if err == io.EOF {
+				break
+			}
+			So(err, ShouldBeNil)
+			kinds = append(kinds, s.StrValMust(".kind"))
+		}
+		So(kinds, ShouldResemble, []string{"ConfigMap", "Service", "Deployment", "Secret"})
+
+		_, err := d.Next()
+		So(err, ShouldEqual, io.EOF)
+
+		d = NewYamlDecoder(strings.NewReader("a: 1\n---\nb: [\n---\nc: 3\n"))
+		s, err := d.Next()
+		So(err, ShouldBeNil)
+		So(s, ShouldResemble, STree{"a": 1})
+		_, err = d.Next()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "document 2 at line 2")
+
+		d = NewYamlDecoder(strings.NewReader("---\n- not\n- a mapping\n"))
+		_, err = d.Next()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test WriteYamlStream\n", t, func() {
+		trees := []STree{
+			{"kind": "ConfigMap", "data": STree{"key": "value"}},
+			{"kind": "Service", "ports": []interface{}{80, 443}},
+		}
+		out, err := WriteYamlStream(trees)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldStartWith, "---\n")
+		So(strings.Count(string(out), "---\n"), ShouldEqual, 2)
+
+		r, err := NewSTreesYaml(bytes.NewReader(out))
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, trees)
+
+		out, err = WriteYamlStream(nil)
+		So(err, ShouldBeNil)
+		So(out, ShouldBeEmpty)
+	})
+}
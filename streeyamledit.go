@@ -0,0 +1,855 @@
+package gostree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	yaml "gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// YamlSource holds the text of a human-maintained yaml document together with the
+// STree it parses to. SetVal and Delete edit the text itself, rewriting only the
+// affected scalar, mapping or sequence entry, so that comments, blank lines,
+// anchors, key order and quoting styles elsewhere in the document are reproduced
+// verbatim by WriteYaml. A replaced scalar keeps its quoting or block style where
+// the new value allows it.
+//
+// After each edit the text is parsed again and compared with the result of the
+// same edit applied to the STree, and an error is returned should the two differ,
+// e.g. when the edited value is shared with an alias elsewhere in the document.
+type YamlSource struct {
+	src   []byte
+	lines []int // the offset of the start of each line of src
+	tree  STree
+	root  *yaml3.Node // the root mapping, nil for an empty document
+}
+
+// yamlLoc describes the position of the node at a path within the node tree of a
+// YamlSource.
+type yamlLoc struct {
+	node   *yaml3.Node // the node at the path, nil if its key is missing
+	parent *yaml3.Node // the mapping or sequence holding node, nil for the root
+	index  int         // the index of node within parent.Content
+	indent int         // the indentation of parent, if it is a block collection
+	flow   bool        // whether node lies within a flow collection
+}
+
+// NewYamlSource reads a yaml document from the specified reader. The root of the
+// document must be a mapping, as for NewSTreeYaml.
+func NewYamlSource(r io.Reader) (YamlSource, error) {
+
+	buf := bytes.NewBuffer([]byte{})
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("NewYamlSource error reading bytes: %v", err)
+	}
+
+	y, err := newYamlSource(buf.Bytes())
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("NewYamlSource %v", err)
+	}
+	return y, nil
+}
+
+func newYamlSource(src []byte) (YamlSource, error) {
+
+	y := YamlSource{src: src, lines: []int{0}, tree: STree{}}
+	for i, b := range src {
+		if b == '\n' {
+			y.lines = append(y.lines, i+1)
+		}
+	}
+
+	err := yaml.Unmarshal(src, &y.tree)
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("error in yaml.Unmarshal: %v", err)
+	}
+	if y.tree == nil {
+		y.tree = STree{}
+	}
+
+	var doc yaml3.Node
+	err = yaml3.Unmarshal(src, &doc)
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("error in yaml3.Unmarshal: %v", err)
+	}
+	if doc.Kind == yaml3.DocumentNode && len(doc.Content) > 0 {
+		y.root = doc.Content[0]
+		if y.root.Kind != yaml3.MappingNode {
+			return YamlSource{}, fmt.Errorf("document root is not a mapping")
+		}
+	}
+
+	return y, nil
+}
+
+// STree returns the STree parsed from the document, which must not be modified.
+func (y YamlSource) STree() STree {
+	return y.tree
+}
+
+// WriteYaml returns the text of the document.
+func (y YamlSource) WriteYaml() ([]byte, error) {
+	return append([]byte{}, y.src...), nil
+}
+
+// SetVal returns a copy of the YamlSource with val stored at path, as by
+// STree.SetVal. An existing value is replaced in place, and a missing key is
+// appended to the end of its mapping.
+func (y YamlSource) SetVal(path string, val interface{}) (YamlSource, error) {
+
+	val, err := convertVal(val)
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("SetVal unsupported value at %s: %v", path, err)
+	}
+
+	expected, err := y.tree.SetVal(path, val)
+	if err != nil {
+		return YamlSource{}, err
+	}
+
+	p, err := y.tree.fieldPathOf("SetVal", path)
+	if err != nil {
+		return YamlSource{}, err
+	}
+
+	return y.setPathVal("SetVal", path, p, val, expected)
+}
+
+func (y YamlSource) SetValMust(path string, val interface{}) YamlSource {
+	u, err := y.SetVal(path, val)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func (y YamlSource) setPathVal(op, path string, p FieldPath, val interface{}, expected STree) (YamlSource, error) {
+
+	loc, rest, err := y.locate(p)
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("%s unable to edit yaml source at %s: %v", op, path, err)
+	}
+
+	var src []byte
+	if loc.node == nil {
+		src, err = y.insert(loc, rest, val)
+	} else {
+		src, err = y.replace(loc, val)
+	}
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("%s unable to edit yaml source at %s: %v", op, path, err)
+	}
+
+	return y.edited(op, path, src, expected)
+}
+
+// Delete returns a copy of the YamlSource with the value at path removed, as by
+// STree.Delete. The lines holding a removed block entry are dropped along with any
+// comment lines directly above it. Removing the last entry of a nested mapping or
+// sequence leaves an empty {} or [] in its place.
+func (y YamlSource) Delete(path string) (YamlSource, error) {
+
+	expected, err := y.tree.Delete(path)
+	if err != nil {
+		return YamlSource{}, err
+	}
+
+	p, err := y.tree.fieldPathOf("Delete", path)
+	if err != nil {
+		return YamlSource{}, err
+	}
+
+	loc, _, err := y.locate(p)
+	if err == nil && loc.node == nil {
+		err = fmt.Errorf("node not found")
+	}
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("Delete unable to edit yaml source at %s: %v", path, err)
+	}
+
+	entries := len(loc.parent.Content)
+	if loc.parent.Kind == yaml3.MappingNode {
+		entries /= 2
+	}
+	if entries == 1 && !loc.flow && loc.parent != y.root {
+		var empty interface{} = STree{}
+		if loc.parent.Kind == yaml3.SequenceNode {
+			empty = []interface{}{}
+		}
+		return y.setPathVal("Delete", path, parentPath(p), empty, expected)
+	}
+
+	src, err := y.remove(loc)
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("Delete unable to edit yaml source at %s: %v", path, err)
+	}
+	return y.edited("Delete", path, src, expected)
+}
+
+func (y YamlSource) DeleteMust(path string) YamlSource {
+	u, err := y.Delete(path)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// parentPath returns the path of the STree or slice holding the value at p.
+func parentPath(p FieldPath) FieldPath {
+	if key, subs, ok := splitComponent(p.last()); ok && len(subs) > 0 {
+		return append(p[:len(p)-1:len(p)-1], key+subs[:strings.LastIndex(subs, "[")])
+	}
+	return p[:len(p)-1]
+}
+
+// edited returns the YamlSource parsed from src, provided its STree matches the
+// expected result of the edit.
+func (y YamlSource) edited(op, path string, src []byte, expected STree) (YamlSource, error) {
+	result, err := newYamlSource(src)
+	if err != nil {
+		return YamlSource{}, fmt.Errorf("%s unable to edit yaml source at %s: %v", op, path, err)
+	}
+	if !valuesEqual(result.tree, expected) {
+		return YamlSource{}, fmt.Errorf("%s unable to edit yaml source at %s: edited document does not match", op, path)
+	}
+	return result, nil
+}
+
+// locate follows p through the node tree, returning the location of the node it
+// addresses. If a key along p is missing, the mapping that should hold it is
+// returned along with the remainder of p, beginning with that key.
+func (y YamlSource) locate(p FieldPath) (yamlLoc, FieldPath, error) {
+
+	loc := yamlLoc{node: y.root}
+	for i, c := range p {
+
+		key, idxs, err := y.tree.parsePathComponent(c)
+		if err != nil {
+			return loc, nil, err
+		}
+
+		m := loc.node
+		if m == nil {
+			return yamlLoc{}, p[i:], nil
+		} else if m.Kind != yaml3.MappingNode {
+			return loc, nil, fmt.Errorf("unsupported %s node at %s", yamlKindName(m), c)
+		}
+
+		flow := loc.flow || m.Style&yaml3.FlowStyle != 0
+		loc = yamlLoc{parent: m, indent: y.blockIndent(m), flow: flow}
+		for j := 0; j+1 < len(m.Content); j += 2 {
+			if k, err := y.keyOf(m.Content[j]); err == nil && k == key {
+				loc.node, loc.index = m.Content[j+1], j+1
+				break
+			}
+		}
+		if loc.node == nil {
+			return loc, p[i:], nil
+		}
+
+		for _, idx := range idxs {
+			s := loc.node
+			if s.Kind != yaml3.SequenceNode || idx >= len(s.Content) {
+				return loc, nil, fmt.Errorf("unsupported %s node at %s", yamlKindName(s), c)
+			}
+			flow = flow || s.Style&yaml3.FlowStyle != 0
+			loc = yamlLoc{node: s.Content[idx], parent: s, index: idx, indent: y.blockIndent(s), flow: flow}
+		}
+	}
+
+	return loc, nil, nil
+}
+
+func yamlKindName(n *yaml3.Node) string {
+	switch n.Kind {
+	case yaml3.MappingNode:
+		return "mapping"
+	case yaml3.SequenceNode:
+		return "sequence"
+	case yaml3.AliasNode:
+		return "alias"
+	default:
+		return "scalar"
+	}
+}
+
+// keyOf returns the STree key read from the text of the key node k.
+func (y YamlSource) keyOf(k *yaml3.Node) (interface{}, error) {
+	end, err := y.keyEnd(k)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	err = yaml.Unmarshal(y.src[y.start(k):end], &key)
+	return key, err
+}
+
+// insert returns the text of the document with the remaining path rest added to
+// the mapping at loc, holding val.
+func (y YamlSource) insert(loc yamlLoc, rest FieldPath, val interface{}) ([]byte, error) {
+
+	entry, err := STree{}.addPathVal(rest, val)
+	if err != nil {
+		return nil, err
+	}
+
+	if loc.parent == nil {
+		text, err := blockYaml(entry, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(y.src) > 0 && y.src[len(y.src)-1] != '\n' {
+			text = "\n" + text
+		}
+		return y.splice(len(y.src), len(y.src), text), nil
+	}
+
+	m := loc.parent
+	if loc.flow {
+		var text string
+		for k, v := range entry {
+			text = flowScalar(k) + ": " + flowYaml(v)
+		}
+		if len(m.Content) < 1 {
+			open := y.skipProps(y.start(m))
+			return y.splice(open+1, open+1, text), nil
+		}
+		end := y.end(m.Content[len(m.Content)-1], 0, true)
+		return y.splice(end, end, ", "+text), nil
+	}
+
+	text, err := blockYaml(entry, loc.indent)
+	if err != nil {
+		return nil, err
+	}
+	at := y.lineEnd(y.end(m.Content[len(m.Content)-1], loc.indent, false))
+	if at < len(y.src) {
+		at++
+	} else {
+		text = "\n" + text
+	}
+	return y.splice(at, at, text), nil
+}
+
+// replace returns the text of the document with the node at loc replaced by val.
+func (y YamlSource) replace(loc yamlLoc, val interface{}) ([]byte, error) {
+
+	n := loc.node
+	start, end := y.start(n), y.end(n, loc.indent, loc.flow)
+	anchors, valStart := y.props(start)
+	block := !loc.flow && (n.Kind == yaml3.MappingNode || n.Kind == yaml3.SequenceNode) && n.Style&yaml3.FlowStyle == 0
+
+	if val == nil || IsPrimitive(val) {
+		text := anchors + y.renderScalar(n, val, loc.flow, loc.indent)
+		if block {
+			at, err := y.afterIndicator(loc)
+			if err != nil {
+				return nil, err
+			}
+			return y.splice(at, end, " "+text), nil
+		}
+		if valStart == start && start > 0 && (y.src[start-1] == ':' || y.src[start-1] == '-') {
+			text = " " + text
+		}
+		return y.splice(start, end, text), nil
+	}
+
+	if loc.flow || (n.Kind != yaml3.ScalarNode && n.Kind != yaml3.AliasNode && !block) {
+		return y.splice(start, end, anchors+flowYaml(val)), nil
+	}
+
+	at, err := y.afterIndicator(loc)
+	if err != nil {
+		return nil, err
+	}
+	if isEmptyComposite(val) {
+		return y.splice(at, end, " "+flowYaml(val)), nil
+	}
+
+	if loc.parent.Kind == yaml3.SequenceNode {
+		dash := at - 1
+		text, err := blockYaml(val, dash-y.lineStart(dash)+2)
+		if err != nil {
+			return nil, err
+		}
+		return y.splice(at, end, " "+strings.TrimSuffix(strings.TrimLeft(text, " "), "\n")), nil
+	}
+
+	text, err := blockYaml(val, loc.indent+2)
+	if err != nil {
+		return nil, err
+	}
+	return y.splice(at, end, "\n"+strings.TrimSuffix(text, "\n")), nil
+}
+
+// remove returns the text of the document with the entry at loc removed from its
+// mapping or sequence, which holds at least one other entry.
+func (y YamlSource) remove(loc yamlLoc) ([]byte, error) {
+
+	m, i := loc.parent, loc.index
+	entryStart := func(j int) (int, error) {
+		if m.Kind == yaml3.MappingNode {
+			return y.start(m.Content[j-1]), nil
+		} else if loc.flow {
+			return y.start(m.Content[j]), nil
+		}
+		at, err := y.afterIndicator(yamlLoc{node: m.Content[j], parent: m, index: j})
+		return at - 1, err
+	}
+
+	step := 1
+	if m.Kind == yaml3.MappingNode {
+		step = 2
+	}
+	from, err := entryStart(i)
+	if err != nil {
+		return nil, err
+	}
+	to := y.end(m.Content[i], loc.indent, loc.flow)
+
+	if loc.flow {
+		if i+step < len(m.Content) {
+			to, err = entryStart(i + step)
+		} else if i-step >= 0 {
+			from = y.end(m.Content[i-step], loc.indent, true)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return y.splice(from, to, ""), nil
+	}
+
+	ls := y.lineStart(from)
+	if len(bytes.TrimSpace(y.src[ls:from])) > 0 {
+		if i+step >= len(m.Content) {
+			return nil, fmt.Errorf("unsupported layout of %s entry", yamlKindName(m))
+		}
+		to, err = entryStart(i + step)
+		if err != nil {
+			return nil, err
+		}
+		return y.splice(from, to, ""), nil
+	}
+
+	// drop the comment lines directly above the entry, at its indentation
+	indent := from - ls
+	for from = ls; from > 0; {
+		prev := y.lineStart(from - 1)
+		line := y.src[prev : from-1]
+		trimmed := bytes.TrimLeft(line, " ")
+		if len(trimmed) < 1 || trimmed[0] != '#' || len(line)-len(trimmed) != indent {
+			break
+		}
+		from = prev
+	}
+
+	to = y.lineEnd(to)
+	if to < len(y.src) {
+		to++
+	}
+	return y.splice(from, to, ""), nil
+}
+
+func (y YamlSource) splice(from, to int, text string) []byte {
+	result := make([]byte, 0, len(y.src)-(to-from)+len(text))
+	result = append(result, y.src[:from]...)
+	result = append(result, text...)
+	return append(result, y.src[to:]...)
+}
+
+// start returns the offset at which the node n begins, including any anchor or
+// tag. Node columns count characters rather than bytes.
+func (y YamlSource) start(n *yaml3.Node) int {
+	off := y.lines[n.Line-1]
+	for c := 1; c < n.Column && off < len(y.src); c++ {
+		_, size := utf8.DecodeRune(y.src[off:])
+		off += size
+	}
+	return off
+}
+
+func (y YamlSource) lineStart(off int) int {
+	return bytes.LastIndexByte(y.src[:off], '\n') + 1
+}
+
+func (y YamlSource) lineEnd(off int) int {
+	if i := bytes.IndexByte(y.src[off:], '\n'); i >= 0 {
+		return off + i
+	}
+	return len(y.src)
+}
+
+// lineIndent returns the number of spaces beginning the line starting at off, and
+// whether the line is blank.
+func (y YamlSource) lineIndent(off int) (int, bool) {
+	line := y.src[off:y.lineEnd(off)]
+	trimmed := bytes.TrimLeft(line, " ")
+	return len(line) - len(trimmed), len(bytes.TrimSpace(trimmed)) < 1
+}
+
+// blockIndent returns the column of the keys of a block mapping, or of the dashes
+// of a block sequence.
+func (y YamlSource) blockIndent(n *yaml3.Node) int {
+	if len(n.Content) < 1 || n.Style&yaml3.FlowStyle != 0 {
+		return 0
+	}
+	off := y.start(n.Content[0])
+	if n.Kind == yaml3.SequenceNode {
+		if at, err := y.afterIndicator(yamlLoc{node: n.Content[0], parent: n}); err == nil {
+			off = at - 1
+		}
+	}
+	return off - y.lineStart(off)
+}
+
+// props returns the anchors beginning the node at off, each followed by a space,
+// along with the offset of the node content following any anchors and tags.
+func (y YamlSource) props(off int) (string, int) {
+	var anchors string
+	for off < len(y.src) && (y.src[off] == '&' || y.src[off] == '!') {
+		tok := off
+		for off < len(y.src) && !isYamlSpace(y.src[off]) {
+			off++
+		}
+		if y.src[tok] == '&' {
+			anchors += string(y.src[tok:off]) + " "
+		}
+		for off < len(y.src) && isYamlSpace(y.src[off]) {
+			off++
+		}
+	}
+	return anchors, off
+}
+
+func (y YamlSource) skipProps(off int) int {
+	_, off = y.props(off)
+	return off
+}
+
+func isYamlSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// afterIndicator returns the offset following the : of the key of the node at
+// loc, or the - introducing it within a block sequence.
+func (y YamlSource) afterIndicator(loc yamlLoc) (int, error) {
+
+	if loc.parent.Kind == yaml3.MappingNode {
+		off, err := y.keyEnd(loc.parent.Content[loc.index-1])
+		if err != nil {
+			return 0, err
+		}
+		for off < len(y.src) && (y.src[off] == ' ' || y.src[off] == '\t') {
+			off++
+		}
+		if off >= len(y.src) || y.src[off] != ':' {
+			return 0, fmt.Errorf("unsupported layout of mapping key")
+		}
+		return off + 1, nil
+	}
+
+	off := y.start(loc.node)
+	for off > 0 && isYamlSpace(y.src[off-1]) {
+		off--
+	}
+	if off < 1 || y.src[off-1] != '-' {
+		return 0, fmt.Errorf("unsupported layout of sequence entry")
+	}
+	return off, nil
+}
+
+// keyEnd returns the offset following the text of the key node k.
+func (y YamlSource) keyEnd(k *yaml3.Node) (int, error) {
+
+	if k.Kind != yaml3.ScalarNode {
+		return 0, fmt.Errorf("unsupported %s key", yamlKindName(k))
+	}
+
+	off := y.skipProps(y.start(k))
+	switch {
+	case k.Style&yaml3.DoubleQuotedStyle != 0:
+		off = y.quotedEnd(off, '"')
+	case k.Style&yaml3.SingleQuotedStyle != 0:
+		off = y.quotedEnd(off, '\'')
+	default:
+		off = y.plainLineEnd(off, true)
+	}
+	return off, nil
+}
+
+// end returns the offset following the text of the node n, excluding any trailing
+// comment. Block scalars and multi-line plain scalars extend over the following
+// lines indented beyond indent, the indentation of the enclosing collection.
+func (y YamlSource) end(n *yaml3.Node, indent int, flow bool) int {
+
+	off := y.skipProps(y.start(n))
+	switch n.Kind {
+
+	case yaml3.AliasNode:
+		for off < len(y.src) && !isYamlSpace(y.src[off]) && !strings.ContainsRune(",[]{}", rune(y.src[off])) {
+			off++
+		}
+		return off
+
+	case yaml3.MappingNode, yaml3.SequenceNode:
+		if n.Style&yaml3.FlowStyle != 0 {
+			return y.flowEnd(off)
+		}
+		return y.end(n.Content[len(n.Content)-1], y.blockIndent(n), false)
+	}
+
+	switch {
+	case n.Style&yaml3.DoubleQuotedStyle != 0:
+		return y.quotedEnd(off, '"')
+	case n.Style&yaml3.SingleQuotedStyle != 0:
+		return y.quotedEnd(off, '\'')
+	case n.Style&(yaml3.LiteralStyle|yaml3.FoldedStyle) != 0:
+		return y.continuedEnd(y.lineEnd(off), indent, false)
+	}
+
+	end := y.plainLineEnd(off, flow)
+	if flow || end == off {
+		return end
+	}
+	return y.continuedEnd(end, indent, true)
+}
+
+// continuedEnd returns the end of the last of the lines following off which are
+// indented beyond indent, skipping blank lines. If plain is set, comment lines
+// end the scalar and the trailing comment of a line is excluded.
+func (y YamlSource) continuedEnd(off, indent int, plain bool) int {
+
+	end := off
+	for next := y.lineEnd(off) + 1; next < len(y.src); next = y.lineEnd(next) + 1 {
+		lineIndent, blank := y.lineIndent(next)
+		if blank {
+			continue
+		} else if lineIndent <= indent || (plain && y.src[next+lineIndent] == '#') {
+			break
+		}
+		if plain {
+			end = y.plainLineEnd(next+lineIndent, false)
+		} else {
+			end = y.lineEnd(next)
+			for end > next && (y.src[end-1] == ' ' || y.src[end-1] == '\r') {
+				end--
+			}
+		}
+	}
+	return end
+}
+
+// plainLineEnd returns the end of the part of a plain scalar beginning at off
+// which lies on the same line, excluding trailing whitespace.
+func (y YamlSource) plainLineEnd(off int, flow bool) int {
+
+	end := off
+	for i := off; i < len(y.src) && y.src[i] != '\n'; i++ {
+		b := y.src[i]
+		if b == '#' && i > off && (y.src[i-1] == ' ' || y.src[i-1] == '\t') {
+			break
+		}
+		if b == ':' && (i+1 >= len(y.src) || isYamlSpace(y.src[i+1]) || (flow && strings.ContainsRune(",[]{}", rune(y.src[i+1])))) {
+			break
+		}
+		if flow && strings.ContainsRune(",[]{}", rune(b)) {
+			break
+		}
+		if !isYamlSpace(b) {
+			end = i + 1
+		}
+	}
+	return end
+}
+
+// quotedEnd returns the offset following the quoted scalar beginning at off.
+func (y YamlSource) quotedEnd(off int, quote byte) int {
+	for i := off + 1; i < len(y.src); i++ {
+		switch {
+		case quote == '"' && y.src[i] == '\\':
+			i++
+		case quote == '\'' && y.src[i] == '\'' && i+1 < len(y.src) && y.src[i+1] == '\'':
+			i++
+		case y.src[i] == quote:
+			return i + 1
+		}
+	}
+	return len(y.src)
+}
+
+// flowEnd returns the offset following the flow collection beginning at off.
+func (y YamlSource) flowEnd(off int) int {
+	depth := 0
+	for i := off; i < len(y.src); i++ {
+		b := y.src[i]
+		tokenStart := i == off || isYamlSpace(y.src[i-1]) || strings.ContainsRune(",[]{}:", rune(y.src[i-1]))
+		switch {
+		case b == '[' || b == '{':
+			depth++
+		case b == ']' || b == '}':
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		case (b == '"' || b == '\'') && tokenStart:
+			i = y.quotedEnd(i, b) - 1
+		case b == '#' && i > off && isYamlSpace(y.src[i-1]):
+			i = y.lineEnd(i)
+		}
+	}
+	return len(y.src)
+}
+
+// renderScalar returns the text of the primitive val replacing the scalar node n,
+// preserving the quoting or block style of n where the value allows it.
+func (y YamlSource) renderScalar(n *yaml3.Node, val interface{}, flow bool, indent int) string {
+
+	s, ok := val.(string)
+	if !ok || n.Kind != yaml3.ScalarNode {
+		return flowScalar(val)
+	}
+
+	switch {
+	case n.Style&yaml3.DoubleQuotedStyle != 0:
+		return jsonQuote(s)
+	case n.Style&yaml3.SingleQuotedStyle != 0:
+		if strings.ContainsAny(s, "\n\r\t") {
+			return jsonQuote(s)
+		}
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	case n.Style&(yaml3.LiteralStyle|yaml3.FoldedStyle) != 0 && !flow:
+		return y.blockScalar(n, s, indent)
+	}
+
+	return plainYaml(s, flow)
+}
+
+// blockScalar returns s as a block scalar replacing the block scalar node n, with
+// its content indented as that of n. Strings which a block scalar cannot express
+// are double quoted instead.
+func (y YamlSource) blockScalar(n *yaml3.Node, s string, indent int) string {
+
+	body := strings.TrimSuffix(s, "\n")
+	if len(body) < 1 || strings.HasSuffix(body, "\n") || strings.ContainsAny(body, "\r") ||
+		body[0] == ' ' || body[0] == '\t' {
+		return jsonQuote(s)
+	}
+
+	header := "|"
+	if n.Style&yaml3.FoldedStyle != 0 && !strings.Contains(body, "\n") {
+		header = ">"
+	}
+	if body == s {
+		header += "-"
+	}
+
+	contentIndent := indent + 2
+	for next := y.lineEnd(y.skipProps(y.start(n))) + 1; next < len(y.src); next = y.lineEnd(next) + 1 {
+		if lineIndent, blank := y.lineIndent(next); !blank {
+			if lineIndent > indent {
+				contentIndent = lineIndent
+			}
+			break
+		}
+	}
+
+	pad := strings.Repeat(" ", contentIndent)
+	lines := strings.Split(body, "\n")
+	for i, l := range lines {
+		if len(l) > 0 {
+			lines[i] = pad + l
+		}
+	}
+	return header + "\n" + strings.Join(lines, "\n")
+}
+
+// plainYaml returns s as a plain scalar, or quoted if it would otherwise be read
+// as some other value or span several lines.
+func plainYaml(s string, flow bool) string {
+	out, err := yaml.Marshal(s)
+	text := strings.TrimSuffix(string(out), "\n")
+	if err != nil || strings.Contains(text, "\n") ||
+		(flow && text[0] != '"' && text[0] != '\'' && strings.ContainsAny(text, ",[]{}")) {
+		return jsonQuote(s)
+	}
+	return text
+}
+
+func jsonQuote(s string) string {
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	e.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// flowScalar returns the primitive val as yaml text suited to a flow collection.
+func flowScalar(val interface{}) string {
+	switch tv := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return plainYaml(tv, true)
+	case json.Number:
+		return tv.String()
+	}
+	if isBigNumber(val) {
+		return bigNumberJson(val).String()
+	}
+	out, err := yaml.Marshal(val)
+	if err != nil {
+		return jsonQuote(fmt.Sprintf("%v", val))
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// flowYaml returns val as yaml in flow style, e.g. {a: 1, b: [x, y]}.
+func flowYaml(val interface{}) string {
+	switch tv := val.(type) {
+	case STree:
+		entries := []string{}
+		for _, k := range tv.sortedKeys() {
+			entries = append(entries, flowScalar(k)+": "+flowYaml(tv[k]))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case []interface{}:
+		elems := []string{}
+		for _, e := range tv {
+			elems = append(elems, flowYaml(e))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	return flowScalar(val)
+}
+
+// blockYaml returns val marshaled as block yaml, with each line indented by the
+// specified number of spaces.
+func blockYaml(val interface{}, indent int) (string, error) {
+	out, err := yaml.Marshal(val)
+	if err != nil {
+		return "", fmt.Errorf("error in yaml.Marshal: %v", err)
+	}
+	pad := strings.Repeat(" ", indent)
+	lines := strings.SplitAfter(string(out), "\n")
+	for i, l := range lines {
+		if len(l) > 0 {
+			lines[i] = pad + l
+		}
+	}
+	return strings.Join(lines, ""), nil
+}
+
+func isEmptyComposite(val interface{}) bool {
+	switch tv := val.(type) {
+	case STree:
+		return len(tv) < 1
+	case []interface{}:
+		return len(tv) < 1
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package gostree
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() { configureTestLogger() }
+
+func TestYamlSource(t *testing.T) {
+
+	defer log.Flush()
+
+	config := `# deployment settings
+
+name: web   # the service name
+image:
+  repo: "registry.local/web"
+  tag: '1.4.2'
+
+defaults: &defaults
+  replicas: 2
+  timeout: 30
+
+# environments in rollout order
+envs:
+  - stage
+  - prod   # last
+notes: |
+  first line
+  second line
+ports: {http: 80, https: 443}
+empty:
+`
+
+	edit := func(y YamlSource, path string, val interface{}) string {
+		u, err := y.SetVal(path, val)
+		So(err, ShouldBeNil)
+		out, err := u.WriteYaml()
+		So(err, ShouldBeNil)
+		return string(out)
+	}
+
+	remove := func(y YamlSource, path string) string {
+		u, err := y.Delete(path)
+		So(err, ShouldBeNil)
+		out, err := u.WriteYaml()
+		So(err, ShouldBeNil)
+		return string(out)
+	}
+
+	Convey("Test NewYamlSource and WriteYaml\n", t, func() {
+		y, err := NewYamlSource(strings.NewReader(config))
+		So(err, ShouldBeNil)
+		So(y.STree().StrValMust(".image.tag"), ShouldEqual, "1.4.2")
+		So(y.STree().IntValMust(".defaults.replicas"), ShouldEqual, 2)
+
+		out, err := y.WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, config)
+
+		y, err = NewYamlSource(strings.NewReader(""))
+		So(err, ShouldBeNil)
+		So(y.STree(), ShouldResemble, STree{})
+
+		_, err = NewYamlSource(strings.NewReader("- not a mapping\n"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test YamlSource SetVal of scalars preserves style\n", t, func() {
+		y, err := NewYamlSource(strings.NewReader(config))
+		So(err, ShouldBeNil)
+
+		So(edit(y, ".image.tag", "1.5.0"), ShouldEqual, strings.Replace(config, "'1.4.2'", "'1.5.0'", 1))
+		So(edit(y, ".image.repo", "registry.local/api"), ShouldEqual,
+			strings.Replace(config, `"registry.local/web"`, `"registry.local/api"`, 1))
+		So(edit(y, ".name", "api"), ShouldEqual, strings.Replace(config, "name: web ", "name: api ", 1))
+		So(edit(y, ".name", "true"), ShouldEqual, strings.Replace(config, "name: web ", `name: "true" `, 1))
+		So(edit(y, "/envs/1", "live"), ShouldEqual, strings.Replace(config, "- prod   # last", "- live   # last", 1))
+		So(edit(y, ".defaults.timeout", 45), ShouldEqual, strings.Replace(config, "timeout: 30", "timeout: 45", 1))
+		So(edit(y, ".ports.http", 8080), ShouldEqual, strings.Replace(config, "http: 80,", "http: 8080,", 1))
+		So(edit(y, ".empty", "set"), ShouldEqual, strings.Replace(config, "empty:\n", "empty: set\n", 1))
+		So(edit(y, ".notes", "only line\n"), ShouldEqual,
+			strings.Replace(config, "  first line\n  second line\n", "  only line\n", 1))
+		So(edit(y, ".notes", "no newline"), ShouldEqual,
+			strings.Replace(config, "|\n  first line\n  second line\n", "|-\n  no newline\n", 1))
+
+		u, err := y.SetVal(".image.tag", "1.5.0")
+		So(err, ShouldBeNil)
+		So(u.STree().StrValMust(".image.tag"), ShouldEqual, "1.5.0")
+		So(y.STree().StrValMust(".image.tag"), ShouldEqual, "1.4.2")
+	})
+
+	Convey("Test YamlSource SetVal of composites and new keys\n", t, func() {
+		y, err := NewYamlSource(strings.NewReader(config))
+		So(err, ShouldBeNil)
+
+		So(edit(y, ".image.pullPolicy", "Always"), ShouldEqual,
+			strings.Replace(config, "  tag: '1.4.2'\n", "  tag: '1.4.2'\n  pullPolicy: Always\n", 1))
+		So(edit(y, ".image.tag", STree{"major": 1, "minor": 5}), ShouldEqual,
+			strings.Replace(config, "  tag: '1.4.2'\n", "  tag:\n    major: 1\n    minor: 5\n", 1))
+		So(edit(y, ".ports.admin", 9000), ShouldEqual, strings.Replace(config, "https: 443}", "https: 443, admin: 9000}", 1))
+		So(edit(y, ".ports", STree{"grpc": 50051}), ShouldEqual, strings.Replace(config, "{http: 80, https: 443}", "{grpc: 50051}", 1))
+		So(edit(y, ".envs", []interface{}{"dev"}), ShouldEqual,
+			strings.Replace(config, "\n  - stage\n  - prod   # last", "\n  - dev   # last", 1))
+		So(edit(y, ".envs[0]", STree{"name": "stage", "weight": 1}), ShouldEqual,
+			strings.Replace(config, "  - stage\n", "  - name: stage\n    weight: 1\n", 1))
+		So(edit(y, ".monitoring.alerts[0]", "pager"), ShouldEqual, config+"monitoring:\n  alerts:\n  - pager\n")
+		So(edit(y, ".image", "web:latest"), ShouldEqual,
+			strings.Replace(config, "image:\n  repo: \"registry.local/web\"\n  tag: '1.4.2'\n", "image: web:latest\n", 1))
+
+		y, err = NewYamlSource(strings.NewReader("# empty\n"))
+		So(err, ShouldBeNil)
+		So(edit(y, ".a.b", 1), ShouldEqual, "# empty\na:\n  b: 1\n")
+	})
+
+	Convey("Test YamlSource Delete\n", t, func() {
+		y, err := NewYamlSource(strings.NewReader(config))
+		So(err, ShouldBeNil)
+
+		So(remove(y, ".name"), ShouldEqual, strings.Replace(config, "name: web   # the service name\n", "", 1))
+		So(remove(y, ".envs"), ShouldEqual,
+			strings.Replace(config, "# environments in rollout order\nenvs:\n  - stage\n  - prod   # last\n", "", 1))
+		So(remove(y, ".envs[0]"), ShouldEqual, strings.Replace(config, "  - stage\n", "", 1))
+		So(remove(y, ".notes"), ShouldEqual, strings.Replace(config, "notes: |\n  first line\n  second line\n", "", 1))
+		So(remove(y, ".ports.http"), ShouldEqual, strings.Replace(config, "{http: 80, https: 443}", "{https: 443}", 1))
+		So(remove(y, ".ports.https"), ShouldEqual, strings.Replace(config, "{http: 80, https: 443}", "{http: 80}", 1))
+
+		u, err := y.Delete(".envs[0]")
+		So(err, ShouldBeNil)
+		out, err := u.DeleteMust(".envs[0]").WriteYaml()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, strings.Replace(config, "envs:\n  - stage\n  - prod   # last\n", "envs: []   # last\n", 1))
+
+		_, err = y.Delete(".missing")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test YamlSource compact and anchored entries\n", t, func() {
+		src := `base: &base
+  size: 1
+copy: *base
+items:
+- id: a
+  enabled: true
+- - x
+  - y
+`
+		y, err := NewYamlSource(strings.NewReader(src))
+		So(err, ShouldBeNil)
+
+		So(remove(y, ".items[0].id"), ShouldEqual, strings.Replace(src, "- id: a\n  enabled: true", "- enabled: true", 1))
+		So(remove(y, ".items[1][0]"), ShouldEqual, strings.Replace(src, "- - x\n  - y", "- - y", 1))
+		So(edit(y, ".items[1][1]", "z"), ShouldEqual, strings.Replace(src, "  - y\n", "  - z\n", 1))
+		So(edit(y, ".copy", "plain"), ShouldEqual, strings.Replace(src, "*base", "plain", 1))
+
+		_, err = y.SetVal(".base.size", 2)
+		So(err, ShouldNotBeNil)
+		_, err = y.SetVal(".copy.size", 2)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -9,7 +9,7 @@ import (
 	"unicode"
 )
 
-var indexRegexp *regexp.Regexp = regexp.MustCompile(`\[\d+\]$`)
+var indexRegexp *regexp.Regexp = regexp.MustCompile(`(?:\[\d+\])+$`)
 
 func (s STree) GoStruct(structName string) (io.Reader, error) {
 
@@ -70,10 +70,7 @@ func (s STree) GoStruct(structName string) (io.Reader, error) {
 
 func (s STree) sliceSetup(key, name string) (bool, string, string) {
 
-	typePre := ""
-	if indexRegexp.MatchString(name) {
-		typePre = "[]"
-	}
+	typePre := strings.Repeat("[]", len(subscriptRegexp.FindAllString(indexRegexp.FindString(name), -1)))
 
 	return !s.isFirst(key), indexRegexp.ReplaceAllString(name, ""), typePre
 }
@@ -82,12 +79,15 @@ func (s STree) isFirst(key string) bool {
 	p := ValueOfPathMust(key)
 	if len(p) < 1 {
 		return true
-	} else if _, idx, err := s.parsePathComponent(p[0]); err != nil {
+	} else if _, idxs, err := s.parsePathComponent(p[0]); err != nil {
 		return true
-	} else if idx == 0 || (idx < 0 && len(p) > 1) {
-		return s.isFirst(p.shift().String())
 	} else {
-		return (idx < 0)
+		for _, idx := range idxs {
+			if idx != 0 {
+				return false
+			}
+		}
+		return s.isFirst(p.shift().String())
 	}
 }
 
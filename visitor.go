@@ -75,7 +75,7 @@ func (b *VisitorBuilder) Visitor() Visitor {
 }
 
 func (s STree) Visit(v Visitor) error {
-	vis := &visitation{v, nil}
+	vis := &visitation{v, nil, nil}
 	return vis.visitSTree(FieldPath([]string{}), s)
 }
 
@@ -84,13 +84,14 @@ type KeySorter func([]string) []string
 var KeySorterAlpha KeySorter = func(keys []string) []string { sort.StringSlice(keys).Sort(); return keys }
 
 func (s STree) VisitSorted(v Visitor, sortFunc KeySorter) error {
-	vis := &visitation{v, sortFunc}
+	vis := &visitation{v, sortFunc, nil}
 	return vis.visitSTree(FieldPath([]string{}), s)
 }
 
 type visitation struct {
-	visitor  Visitor
-	sortFunc func(keys []string) []string
+	visitor   Visitor
+	sortFunc  func(keys []string) []string
+	orderFunc func(parentKey FieldPath, t STree) []string // takes precedence over sortFunc
 }
 
 func (v *visitation) visitSTree(parentKey FieldPath, t STree) error {
@@ -101,7 +102,9 @@ func (v *visitation) visitSTree(parentKey FieldPath, t STree) error {
 		return fmt.Errorf("visit KeyStrings error: %v", err)
 	}
 
-	if v.sortFunc != nil {
+	if v.orderFunc != nil {
+		keys = v.orderFunc(parentKey, t)
+	} else if v.sortFunc != nil {
 		keys = v.sortFunc(keys)
 	}
 
@@ -127,7 +130,7 @@ func (v *visitation) visitSTree(parentKey FieldPath, t STree) error {
 
 func (v *visitation) visitVal(key FieldPath, val interface{}) error {
 
-	if IsPrimitive(val) {
+	if val == nil || IsPrimitive(val) {
 
 		return v.visitor.VisitPrimitive(key.String(), val)
 
@@ -161,11 +164,11 @@ func (v *visitation) visitSlice(parentKey FieldPath, a []interface{}) error {
 		return err
 	}
 
-	keyBase := parentKey[len(parentKey)-1]
+	keyBase := parentKey.last()
 	for i, aval := range a {
 
-		parentKey[len(parentKey)-1] = fmt.Sprintf("%s[%d]", keyBase, i)
-		if err = v.visitVal(parentKey, aval); err != nil {
+		key := parentKey[:len(parentKey)-1].append(fmt.Sprintf("%s[%d]", keyBase, i))
+		if err = v.visitVal(key, aval); err != nil {
 			return err
 		}
 	}